@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/schema"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/tool"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DefaultMaxSteps is the default maximum number of model calls
+const DefaultMaxSteps = 10
+
+// statuses of step
+const (
+	// StatusAnswered is the step which the model answers in text
+	StatusAnswered = "answered"
+	// StatusExecuted is the step which the tool is executed successfully
+	StatusExecuted = "executed"
+	// StatusFailed is the step which the tool can't be prepared or its execution is failed
+	StatusFailed = "failed"
+	// StatusInvalid is the step which the model calls unknown tool or gives invalid arguments
+	StatusInvalid = "invalid"
+	// StatusDeclined is the step which the execution of tool is declined by the user
+	StatusDeclined = "declined"
+)
+
+// declinedMessage is given to the model as the result of declined tool call
+const declinedMessage = "the user declined to execute the tool"
+
+// Tool is a local tool which the model can call, the definition is given to the model as a function
+type Tool struct {
+	Definition openai.FunctionDefinition
+	Executor   tool.Executor
+}
+
+// Step is a record of a model call or a tool call
+type Step struct {
+	Step      int       `json:"step"`
+	Time      time.Time `json:"time"`
+	Tool      string    `json:"tool,omitempty"`
+	Arguments string    `json:"arguments,omitempty"`
+	// Action is the description of prepared execution
+	Action string `json:"action,omitempty"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// New creates a new agent app, maxSteps is the maximum number of model calls
+func New(client *chatgpt.Client, tools []Tool, maxSteps int) *App {
+	if maxSteps < 1 {
+		maxSteps = DefaultMaxSteps
+	}
+
+	return &App{
+		client:   client,
+		tools:    tools,
+		maxSteps: maxSteps,
+	}
+}
+
+// App is the agent app, it executes tools called by the model and gives the results back until the model answers
+type App struct {
+	client   *chatgpt.Client
+	tools    []Tool
+	maxSteps int
+
+	// Confirm asks whether to execute the action of the tool, nil means every action is executed without confirmation
+	Confirm func(name string, action *tool.Action) (bool, error)
+	// Log is called for each step, nil means steps are not logged
+	Log func(step Step)
+}
+
+// Run runs the app, and returns the answer of the model, tokens of all model calls are summed up in its usage.
+// failures of tool are given to the model as the result, so that the model can try another way.
+func (a *App) Run(role string, prompt string, input string) (*chatgpt.Answer, error) {
+	funcs := make([]openai.FunctionDefinition, 0, len(a.tools))
+	for _, t := range a.tools {
+		funcs = append(funcs, t.Definition)
+	}
+
+	msgs := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: role},
+		{Role: openai.ChatMessageRoleUser, Content: chatgpt.UserMessage(prompt, input)},
+	}
+
+	answer := &chatgpt.Answer{}
+	for step := 1; step <= a.maxSteps; step++ {
+		called, err := a.client.ChatWithTools(msgs, funcs)
+		if err != nil {
+			return nil, err
+		}
+		answer.Add(called)
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   called.Content,
+			ToolCalls: called.ToolCalls,
+		})
+
+		if len(called.ToolCalls) == 0 {
+			a.log(Step{Step: step, Status: StatusAnswered})
+			return answer, nil
+		}
+
+		for _, call := range called.ToolCalls {
+			output, err := a.call(step, call)
+			if err != nil {
+				return nil, err
+			}
+
+			msgs = append(msgs, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    output,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	return nil, fmt.Errorf("max steps of %d reached without an answer", a.maxSteps)
+}
+
+// call executes the tool of the call, and returns the result given to the model.
+// error is returned only if the confirmation is failed.
+func (a *App) call(step int, call openai.ToolCall) (string, error) {
+	record := Step{Step: step, Tool: call.Function.Name, Arguments: call.Function.Arguments}
+	result := func(status string, output string, err error) string {
+		record.Status, record.Output = status, output
+		if err != nil {
+			record.Error = err.Error()
+			output = strings.TrimLeft(fmt.Sprintf("%s\nerror: %s", output, err), "\n")
+		}
+		a.log(record)
+		return output
+	}
+
+	t, args, err := a.validate(call)
+	if err != nil {
+		return result(StatusInvalid, "", err), nil
+	}
+
+	action, err := t.Executor.Prepare(args)
+	if err != nil {
+		return result(StatusFailed, "", err), nil
+	}
+	record.Action = action.Description
+
+	if a.Confirm != nil {
+		ok, err := a.Confirm(t.Definition.Name, action)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return result(StatusDeclined, declinedMessage, nil), nil
+		}
+	}
+
+	output, err := action.Run()
+	if err != nil {
+		return result(StatusFailed, output, err), nil
+	}
+
+	return result(StatusExecuted, output, nil), nil
+}
+
+// validate finds the tool of the call, and validates arguments against parameters of it
+func (a *App) validate(call openai.ToolCall) (*Tool, map[string]interface{}, error) {
+	var t *Tool
+	for i := range a.tools {
+		if a.tools[i].Definition.Name == call.Function.Name {
+			t = &a.tools[i]
+		}
+	}
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown tool: %s", call.Function.Name)
+	}
+
+	args := map[string]interface{}{}
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return nil, nil, fmt.Errorf("arguments are not a JSON object: %w", err)
+		}
+	}
+
+	def, err := schema.FromParameters(t.Definition.Parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := schema.Validate(def, args); err != nil {
+		return nil, nil, fmt.Errorf("arguments are invalid: %w", err)
+	}
+
+	return t, args, nil
+}
+
+// log calls Log with the time of the step
+func (a *App) log(step Step) {
+	if a.Log == nil {
+		return
+	}
+
+	step.Time = time.Now().Round(0)
+	a.Log(step)
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/tool"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// scriptedProvider answers each request with the next message of the script, and records the requests
+type scriptedProvider struct {
+	script   []openai.ChatCompletionMessage
+	requests []openai.ChatCompletionRequest
+}
+
+// CreateChatCompletion answers the next message of the script
+func (p *scriptedProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.requests = append(p.requests, req)
+	if len(p.script) == 0 {
+		return openai.ChatCompletionResponse{}, errors.New("script is over")
+	}
+
+	message := p.script[0]
+	p.script = p.script[1:]
+
+	reason := openai.FinishReasonStop
+	if len(message.ToolCalls) > 0 {
+		reason = openai.FinishReasonToolCalls
+	}
+
+	return openai.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: message, FinishReason: reason}},
+		Usage:   openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+// CreateChatCompletionStream is not used by the agent
+func (p *scriptedProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatgpt.Stream, error) {
+	return nil, errors.New("stream is not supported")
+}
+
+// toolCalls makes a message of the model which calls tools, each call is a pair of name and arguments
+func toolCalls(nameAndArgs ...string) openai.ChatCompletionMessage {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	for i := 0; i < len(nameAndArgs); i += 2 {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:       fmt.Sprintf("call_%d", i/2),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: nameAndArgs[i], Arguments: nameAndArgs[i+1]},
+		})
+	}
+	return message
+}
+
+// text makes a message of the model which answers in text
+func text(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+}
+
+// echoTool is a tool which prints the message
+var echoTool = Tool{
+	Definition: openai.FunctionDefinition{
+		Name:       "echo",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"msg":{"type":"string"}},"required":["msg"]}`),
+	},
+	Executor: &tool.Shell{Command: "printf %s {{.msg}}"},
+}
+
+// failTool is a tool whose command fails
+var failTool = Tool{
+	Definition: openai.FunctionDefinition{Name: "fail", Parameters: json.RawMessage(`{"type":"object"}`)},
+	Executor:   &tool.Shell{Command: "printf partial; exit 3"},
+}
+
+func TestAppRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  []openai.ChatCompletionMessage
+		confirm func(name string, action *tool.Action) (bool, error)
+		// results are contents of tool messages given to the model in order
+		results  []string
+		statuses []string
+		answer   string
+	}{
+		{
+			name:     "answer without tools",
+			script:   []openai.ChatCompletionMessage{text("done")},
+			statuses: []string{StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:     "tool is executed",
+			script:   []openai.ChatCompletionMessage{toolCalls("echo", `{"msg":"hi; echo injected"}`), text("done")},
+			results:  []string{"hi; echo injected"},
+			statuses: []string{StatusExecuted, StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:     "parallel calls",
+			script:   []openai.ChatCompletionMessage{toolCalls("echo", `{"msg":"a"}`, "echo", `{"msg":"b"}`), text("done")},
+			results:  []string{"a", "b"},
+			statuses: []string{StatusExecuted, StatusExecuted, StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:     "unknown tool",
+			script:   []openai.ChatCompletionMessage{toolCalls("rm", `{}`), text("done")},
+			results:  []string{"error: unknown tool: rm"},
+			statuses: []string{StatusInvalid, StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:     "invalid arguments",
+			script:   []openai.ChatCompletionMessage{toolCalls("echo", `{"message":"hi"}`), toolCalls("echo", `not json`), text("done")},
+			results:  []string{"error: arguments are invalid: ", "error: arguments are not a JSON object: "},
+			statuses: []string{StatusInvalid, StatusInvalid, StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:     "failed execution",
+			script:   []openai.ChatCompletionMessage{toolCalls("fail", `{}`), text("done")},
+			results:  []string{"partial\nerror: exit status 3"},
+			statuses: []string{StatusFailed, StatusAnswered},
+			answer:   "done",
+		},
+		{
+			name:   "declined execution",
+			script: []openai.ChatCompletionMessage{toolCalls("echo", `{"msg":"a"}`, "echo", `{"msg":"b"}`), text("done")},
+			confirm: func(name string, action *tool.Action) (bool, error) {
+				return action.Description == "run shell command: printf %s 'b'", nil
+			},
+			results:  []string{declinedMessage, "b"},
+			statuses: []string{StatusDeclined, StatusExecuted, StatusAnswered},
+			answer:   "done",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &scriptedProvider{script: tt.script}
+			app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute), []Tool{echoTool, failTool}, 0)
+			app.Confirm = tt.confirm
+
+			statuses := []string{}
+			app.Log = func(step Step) {
+				if step.Time.IsZero() {
+					t.Errorf("step %d has no time", step.Step)
+				}
+				statuses = append(statuses, step.Status)
+			}
+
+			answer, err := app.Run("role", "prompt", "input")
+			if err != nil {
+				t.Fatalf("Run() returned error: %s", err)
+			}
+			if answer.Content != tt.answer {
+				t.Errorf("answer = %q, want %q", answer.Content, tt.answer)
+			}
+			if calls := len(tt.script); answer.Usage.TotalTokens != 15*calls {
+				t.Errorf("total tokens = %d, want %d of %d calls", answer.Usage.TotalTokens, 15*calls, calls)
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.statuses)
+			}
+
+			// tools are given to the model, and the results are given back with IDs of the calls
+			last := provider.requests[len(provider.requests)-1]
+			if len(last.Tools) != 2 || last.Tools[0].Function.Name != "echo" {
+				t.Errorf("tools = %+v, want echo and fail", last.Tools)
+			}
+			results := []string{}
+			for _, msg := range last.Messages {
+				if msg.Role != openai.ChatMessageRoleTool {
+					continue
+				}
+				results = append(results, msg.Content)
+				if !strings.HasPrefix(msg.ToolCallID, "call_") {
+					t.Errorf("tool message has no ID of the call: %+v", msg)
+				}
+			}
+			if len(results) != len(tt.results) {
+				t.Fatalf("results = %q, want %q", results, tt.results)
+			}
+			for i := range results {
+				if !strings.HasPrefix(results[i], tt.results[i]) {
+					t.Errorf("result %d = %q, want %q", i, results[i], tt.results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAppRunMaxSteps(t *testing.T) {
+	provider := &scriptedProvider{script: []openai.ChatCompletionMessage{
+		toolCalls("echo", `{"msg":"a"}`),
+		toolCalls("echo", `{"msg":"b"}`),
+		text("never reached"),
+	}}
+	app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute), []Tool{echoTool}, 2)
+
+	_, err := app.Run("role", "prompt", "input")
+	if err == nil || err.Error() != "max steps of 2 reached without an answer" {
+		t.Errorf("Run() error = %v, want max steps reached", err)
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("model is called %d times, want 2", len(provider.requests))
+	}
+}
+
+func TestAppRunConfirmError(t *testing.T) {
+	provider := &scriptedProvider{script: []openai.ChatCompletionMessage{toolCalls("echo", `{"msg":"a"}`)}}
+	app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute), []Tool{echoTool}, 0)
+	app.Confirm = func(name string, action *tool.Action) (bool, error) {
+		return false, errors.New("no terminal")
+	}
+
+	if _, err := app.Run("role", "prompt", "input"); err == nil || err.Error() != "no terminal" {
+		t.Errorf("Run() error = %v, want error of confirmation", err)
+	}
+}
@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// help is the help message of slash commands in REPL
+const help = `/reset          clear the conversation, the role is kept
+/role [role]    show or replace the role of the AI assistant
+/save <path>    save the conversation to the file as JSON
+/help           show this help message
+/exit, /quit    exit chat mode
+`
+
+// New creates a new multi-turn chat app
+func New(client *chatgpt.Client, role string) *App {
+	a := &App{
+		client: client,
+		role:   role,
+	}
+	a.Reset()
+
+	return a
+}
+
+// App is the multi-turn chat app, it keeps the message history of the conversation
+type App struct {
+	client  *chatgpt.Client
+	role    string
+	history []openai.ChatCompletionMessage
+}
+
+// Ask appends the question to the history, and returns the answer with the full context
+func (a *App) Ask(question string) (string, error) {
+	return a.ask(question, func(msgs []openai.ChatCompletionMessage) (string, error) {
+		return a.client.Chat(msgs)
+	})
+}
+
+// AskStream appends the question to the history, and writes the answer to w as it arrives
+func (a *App) AskStream(question string, w io.Writer) (string, error) {
+	return a.ask(question, func(msgs []openai.ChatCompletionMessage) (string, error) {
+		return a.client.ChatStream(msgs, w)
+	})
+}
+
+// ask appends the question to the history, and the answer from given chat function if it succeeds
+func (a *App) ask(question string, chat func([]openai.ChatCompletionMessage) (string, error)) (string, error) {
+	msgs := append(a.Messages(), openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: question,
+	})
+
+	answer, err := chat(msgs)
+	if err != nil {
+		return "", err
+	}
+
+	a.history = append(msgs, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: answer,
+	})
+	return answer, nil
+}
+
+// Reset clears the conversation, only the role is kept
+func (a *App) Reset() {
+	a.history = []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: a.role,
+		},
+	}
+}
+
+// Restore replaces the history with given messages, the role is prepended if it is missing
+func (a *App) Restore(msgs []openai.ChatCompletionMessage) {
+	if len(msgs) == 0 || msgs[0].Role != openai.ChatMessageRoleSystem {
+		a.Reset()
+		a.history = append(a.history, msgs...)
+		return
+	}
+
+	a.history = make([]openai.ChatCompletionMessage, len(msgs))
+	copy(a.history, msgs)
+	a.role = msgs[0].Content
+}
+
+// Role returns the role of the AI assistant
+func (a *App) Role() string {
+	return a.role
+}
+
+// SetRole replaces the role of the AI assistant, the conversation is kept
+func (a *App) SetRole(role string) {
+	a.role = role
+	a.history[0].Content = role
+}
+
+// Messages returns a copy of the message history
+func (a *App) Messages() []openai.ChatCompletionMessage {
+	msgs := make([]openai.ChatCompletionMessage, len(a.history))
+	copy(msgs, a.history)
+
+	return msgs
+}
+
+// Save writes the message history to given path as JSON
+func (a *App) Save(path string) error {
+	raw, err := json.MarshalIndent(a.history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// REPL reads follow-up questions and slash commands from r until exit or EOF, and writes the prompt and messages to w.
+// answer is called to ask a question and print its answer, and save is called whenever the conversation is changed.
+func (a *App) REPL(r io.Reader, w io.Writer, answer func(question string) error, save func() error) {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// otherwise, ask a follow-up question
+		if !strings.HasPrefix(line, "/") {
+			if err := answer(line); err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			if err := save(); err != nil {
+				fmt.Fprintln(w, err)
+			}
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case "/reset":
+			a.Reset()
+			if err := save(); err != nil {
+				fmt.Fprintln(w, err)
+			}
+			fmt.Fprintln(w, "conversation is cleared")
+		case "/role":
+			if arg != "" {
+				a.SetRole(arg)
+				if err := save(); err != nil {
+					fmt.Fprintln(w, err)
+				}
+			}
+			fmt.Fprintln(w, a.Role())
+		case "/save":
+			if arg == "" {
+				fmt.Fprintln(w, "usage: /save <path>")
+				continue
+			}
+			if err := a.Save(arg); err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			fmt.Fprintf(w, "conversation is saved to %s\n", arg)
+		case "/help":
+			fmt.Fprint(w, help)
+		case "/exit", "/quit":
+			return
+		default:
+			fmt.Fprintf(w, "unknown command: %s, see /help\n", command)
+		}
+	}
+}
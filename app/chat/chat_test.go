@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// countProvider answers "answer N" to N-th request, or fails if the question starts with "fail", and records the requests
+type countProvider struct {
+	requests [][]openai.ChatCompletionMessage
+}
+
+// CreateChatCompletion answers the number of the request
+func (p *countProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.requests = append(p.requests, req.Messages)
+	if question := req.Messages[len(req.Messages)-1].Content; strings.HasPrefix(question, "fail") {
+		return openai.ChatCompletionResponse{}, errors.New(question)
+	}
+
+	return openai.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: fmt.Sprintf("answer %d", len(p.requests))}}},
+	}, nil
+}
+
+// CreateChatCompletionStream is not used by Ask
+func (p *countProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatgpt.Stream, error) {
+	return nil, errors.New("stream is not supported")
+}
+
+// message makes a message of the role
+func message(role string, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: role, Content: content}
+}
+
+// runREPL drives REPL of a new app with the script as the terminal input, and returns the app, the provider,
+// what is written to the terminal, the answers and the number of saves
+func runREPL(t *testing.T, script string) (*App, *countProvider, string, []string, int) {
+	t.Helper()
+
+	provider := &countProvider{}
+	app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute), "role")
+
+	var tty bytes.Buffer
+	answers := []string{}
+	saves := 0
+	app.REPL(strings.NewReader(script), &tty, func(question string) error {
+		answer, err := app.Ask(question)
+		if err != nil {
+			return err
+		}
+		answers = append(answers, answer)
+		return nil
+	}, func() error {
+		saves++
+		return nil
+	})
+
+	return app, provider, tty.String(), answers, saves
+}
+
+func TestREPL(t *testing.T) {
+	t.Run("history accumulates", func(t *testing.T) {
+		app, provider, _, answers, saves := runREPL(t, "hello\nhow are you?\n")
+
+		if want := []string{"answer 1", "answer 2"}; !reflect.DeepEqual(answers, want) {
+			t.Errorf("answers = %q, want %q", answers, want)
+		}
+		if saves != 2 {
+			t.Errorf("saved %d times, want after each answer", saves)
+		}
+
+		// the second question is asked with the first question and its answer
+		want := []openai.ChatCompletionMessage{
+			message(openai.ChatMessageRoleSystem, "role"),
+			message(openai.ChatMessageRoleUser, "hello"),
+			message(openai.ChatMessageRoleAssistant, "answer 1"),
+			message(openai.ChatMessageRoleUser, "how are you?"),
+		}
+		if len(provider.requests) != 2 || !reflect.DeepEqual(provider.requests[1], want) {
+			t.Errorf("requests = %+v, want the second with the history %+v", provider.requests, want)
+		}
+		if got := app.Messages(); !reflect.DeepEqual(got, append(want, message(openai.ChatMessageRoleAssistant, "answer 2"))) {
+			t.Errorf("Messages() = %+v, want the history of both turns", got)
+		}
+	})
+
+	t.Run("empty lines are skipped", func(t *testing.T) {
+		_, provider, tty, answers, saves := runREPL(t, "\n   \nhello\n\t\n")
+
+		if len(provider.requests) != 1 || len(answers) != 1 || saves != 1 {
+			t.Errorf("%d requests, %d answers and %d saves, want only the question asked", len(provider.requests), len(answers), saves)
+		}
+		if prompts := strings.Count(tty, "> "); prompts != 5 {
+			t.Errorf("prompted %d times, want for each line and EOF", prompts)
+		}
+	})
+
+	t.Run("exit", func(t *testing.T) {
+		for _, command := range []string{"/exit", "/quit"} {
+			_, provider, tty, _, _ := runREPL(t, "hello\n"+command+"\nnever asked\n")
+
+			if len(provider.requests) != 1 {
+				t.Errorf("%d requests after %s, want lines after it are not read", len(provider.requests), command)
+			}
+			if strings.HasSuffix(tty, "\n") {
+				t.Errorf("terminal = %q, want no newline of EOF after %s", tty, command)
+			}
+		}
+	})
+
+	t.Run("EOF", func(t *testing.T) {
+		_, provider, tty, _, _ := runREPL(t, "hello")
+
+		if len(provider.requests) != 1 || !strings.HasSuffix(tty, "> \n") {
+			t.Errorf("%d requests and terminal %q, want the last line asked and a newline at EOF", len(provider.requests), tty)
+		}
+	})
+
+	t.Run("failed question", func(t *testing.T) {
+		app, _, tty, _, saves := runREPL(t, "fail once\nhello\n")
+
+		if !strings.Contains(tty, "fail once\n") || saves != 1 {
+			t.Errorf("terminal = %q, %d saves, want the error shown and not saved", tty, saves)
+		}
+		// the failed question is not kept in the history
+		if got := app.Messages(); len(got) != 3 || got[1].Content != "hello" {
+			t.Errorf("Messages() = %+v, want only the answered question", got)
+		}
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "chat.json")
+		app, provider, tty, _, saves := runREPL(t, "hello\n/reset\n/role  translator \nhi\n/role\n/save "+path+"\n/save\n/help\n/unknown\n")
+
+		if len(provider.requests) != 2 || len(provider.requests[1]) != 2 {
+			t.Fatalf("requests = %+v, want the second without the history cleared by /reset", provider.requests)
+		}
+		if provider.requests[1][0].Content != "translator" || app.Role() != "translator" {
+			t.Errorf("role = %q, want replaced by /role", provider.requests[1][0].Content)
+		}
+		// saved after each answer, /reset and /role with an argument
+		if saves != 4 {
+			t.Errorf("saved %d times, want 4", saves)
+		}
+
+		for _, want := range []string{"conversation is cleared\n", "translator\n", "conversation is saved to " + path + "\n", "usage: /save <path>\n", help, "unknown command: /unknown, see /help\n"} {
+			if !strings.Contains(tty, want) {
+				t.Errorf("terminal = %q, want %q", tty, want)
+			}
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("conversation is not saved: %s", err)
+		}
+		var saved []openai.ChatCompletionMessage
+		if err := json.Unmarshal(raw, &saved); err != nil || !reflect.DeepEqual(saved, app.Messages()) {
+			t.Errorf("saved conversation = %+v, %v, want %+v", saved, err, app.Messages())
+		}
+	})
+}
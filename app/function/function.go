@@ -21,14 +21,15 @@ type App struct {
 	client *chatgpt.Client
 }
 
-// Run runs the app
-func (a *App) Run(role string, prompt string, input string, funcs []openai.FunctionDefinition) (map[string]interface{}, error) {
-	res, err := a.client.FunctionCall(role, prompt, input, funcs)
+// Run runs the app, call chooses the function to call, empty means the model chooses it.
+// the answer has metadata of the responses, it is returned even if the function call is failed.
+func (a *App) Run(role string, prompt string, input string, funcs []openai.FunctionDefinition, call string) ([]*chatgpt.FunctionCallResult, *chatgpt.Answer, error) {
+	res, answer, err := a.client.FunctionCall(role, prompt, input, funcs, call)
 	if err != nil {
-		return map[string]interface{}{}, err
+		return nil, answer, err
 	}
 
-	return res, nil
+	return res, answer, nil
 }
 
 // ToFunctionSchema converts a yaml definition to a JSONSchema for function call
@@ -1,6 +1,10 @@
 package generic
 
 import (
+	"fmt"
+	"io"
+	"sync"
+
 	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
 )
 
@@ -17,6 +21,67 @@ type App struct {
 }
 
 // Run runs the app
-func (a *App) Run(role string, prompt string, input string) (string, error) {
-	return a.client.Question(role, prompt, input)
+func (a *App) Run(role string, prompt string, input string) (*chatgpt.Answer, error) {
+	return a.client.Ask(role, prompt, input)
+}
+
+// RunStream runs the app, and writes the answer to w as it arrives
+func (a *App) RunStream(role string, prompt string, input string, w io.Writer) (*chatgpt.Answer, error) {
+	return a.client.AskStream(role, prompt, input, w)
+}
+
+// RunEach runs the app for each input concurrently, at most concurrency questions are asked at once.
+// answers are in the order of inputs, and the first error stops asking the rest.
+func (a *App) RunEach(role string, prompt string, inputs []string, concurrency int) ([]*chatgpt.Answer, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	answers := make([]*chatgpt.Answer, len(inputs))
+	errs := make([]error, len(inputs))
+	sem := make(chan struct{}, concurrency)
+	failed := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+
+	for i, input := range inputs {
+		// do not start the rest if any question is failed
+		select {
+		case sem <- struct{}{}:
+		case <-failed:
+		}
+		if isClosed(failed) {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			answers[i], errs[i] = a.Run(role, prompt, input)
+			if errs[i] != nil {
+				once.Do(func() { close(failed) })
+			}
+		}(i, input)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d of %d: %w", i+1, len(inputs), err)
+		}
+	}
+
+	return answers, nil
+}
+
+// isClosed returns whether the channel is closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,134 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// echoProvider answers the input of each request after its delay, or fails if the input starts with "fail"
+type echoProvider struct {
+	delays map[string]time.Duration
+
+	mu     sync.Mutex
+	inputs []string
+}
+
+// CreateChatCompletion answers the input, which follows the prompt in the user message
+func (p *echoProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	message := req.Messages[len(req.Messages)-1].Content
+	input := strings.TrimPrefix(message, "prompt\n---\n")
+	p.mu.Lock()
+	p.inputs = append(p.inputs, input)
+	p.mu.Unlock()
+
+	time.Sleep(p.delays[input])
+	if strings.HasPrefix(input, "fail") {
+		return openai.ChatCompletionResponse{}, errors.New(input)
+	}
+
+	return openai.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "answer of " + input}}},
+	}, nil
+}
+
+// CreateChatCompletionStream is not used by RunEach
+func (p *echoProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (chatgpt.Stream, error) {
+	return nil, errors.New("stream is not supported")
+}
+
+func TestRunEach(t *testing.T) {
+	// answers are in order of inputs, even if later inputs are answered first
+	provider := &echoProvider{delays: map[string]time.Duration{"a": 30 * time.Millisecond, "b": 10 * time.Millisecond}}
+	app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute))
+
+	answers, err := app.RunEach("role", "prompt", []string{"a", "b", "c", "d"}, 3)
+	if err != nil {
+		t.Fatalf("RunEach() returned error: %s", err)
+	}
+
+	got := []string{}
+	for _, answer := range answers {
+		got = append(got, answer.Content)
+	}
+	if want := "answer of a,answer of b,answer of c,answer of d"; strings.Join(got, ",") != want {
+		t.Errorf("answers = %q, want %q", got, want)
+	}
+}
+
+func TestRunEachCanceled(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputs      []string
+		delays      map[string]time.Duration
+		concurrency int
+		// asked are the inputs which are asked before the failure stops the rest
+		asked []string
+		err   string
+	}{
+		{
+			name:        "sequential",
+			inputs:      []string{"a", "fail b", "c", "d"},
+			concurrency: 1,
+			asked:       []string{"a", "fail b"},
+			err:         "chunk 2 of 4: fail b",
+		},
+		{
+			name:        "concurrent",
+			inputs:      []string{"fail a", "b", "c", "d", "e"},
+			delays:      map[string]time.Duration{"b": 50 * time.Millisecond},
+			concurrency: 2,
+			asked:       []string{"fail a", "b"},
+			err:         "chunk 1 of 5: fail a",
+		},
+		{
+			name:        "error of first input is returned",
+			inputs:      []string{"a", "fail b", "fail c"},
+			delays:      map[string]time.Duration{"fail b": 50 * time.Millisecond},
+			concurrency: 3,
+			asked:       []string{"a", "fail b", "fail c"},
+			err:         "chunk 2 of 3: fail b",
+		},
+		{
+			name:        "invalid concurrency is taken as 1",
+			inputs:      []string{"fail a", "b"},
+			concurrency: 0,
+			asked:       []string{"fail a"},
+			err:         "chunk 1 of 2: fail a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &echoProvider{delays: tt.delays}
+			app := New(chatgpt.NewClientWithProvider(provider, "gpt-4o", time.Minute))
+
+			answers, err := app.RunEach("role", "prompt", tt.inputs, tt.concurrency)
+			if answers != nil || err == nil || err.Error() != tt.err {
+				t.Errorf("RunEach() = %v, %v, want error %q", answers, err, tt.err)
+			}
+
+			// the order of concurrent questions is not fixed
+			asked := map[string]bool{}
+			for _, input := range provider.inputs {
+				asked[input] = true
+			}
+			if len(provider.inputs) != len(tt.asked) {
+				t.Errorf("asked = %q, want %q", provider.inputs, tt.asked)
+			}
+			for _, input := range tt.asked {
+				if !asked[input] {
+					t.Errorf("asked = %q, want %q", provider.inputs, tt.asked)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package structured
+
+import (
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+)
+
+// New creates a new structured output app
+func New(client *chatgpt.Client) *App {
+	return &App{
+		client: client,
+	}
+}
+
+// App is the structured output app
+type App struct {
+	client *chatgpt.Client
+}
+
+// Run runs the app, and returns the answer in JSON of the format with metadata of the responses
+func (a *App) Run(role string, prompt string, input string, format *chatgpt.OutputFormat) (interface{}, *chatgpt.Answer, error) {
+	return a.client.StructuredOutput(role, prompt, input, format)
+}
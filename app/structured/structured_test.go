@@ -0,0 +1,61 @@
+package structured
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+)
+
+func TestRun(t *testing.T) {
+	var body struct {
+		ResponseFormat struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name   string          `json:"name"`
+				Schema json.RawMessage `json:"schema"`
+				Strict bool            `json:"strict"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("request is not JSON: %s", err)
+		}
+		_, _ = io.WriteString(w, `{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"{\"firstName\":\"Miku\",\"age\":16}"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	format := &chatgpt.OutputFormat{
+		Name:   "person",
+		Schema: json.RawMessage(`{"type":"object","additionalProperties":false,"properties":{"firstName":{"type":"string"},"age":{"type":"integer"}},"required":["firstName","age"]}`),
+		Strict: true,
+	}
+	client := chatgpt.NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+
+	output, _, err := New(client).Run("role", "extract the person", "Miku is 16 years old.", format)
+	if err != nil {
+		t.Fatalf("Run() returned error: %s", err)
+	}
+	if want := map[string]interface{}{"firstName": "Miku", "age": float64(16)}; !reflect.DeepEqual(output, want) {
+		t.Errorf("Run() = %v, want %v", output, want)
+	}
+
+	// the schema is sent as it is, camelCase of property names and keywords is kept
+	if body.ResponseFormat.Type != "json_schema" || body.ResponseFormat.JSONSchema.Name != "person" || !body.ResponseFormat.JSONSchema.Strict {
+		t.Errorf("response_format = %+v, want strict json_schema of person", body.ResponseFormat)
+	}
+	var sent, want interface{}
+	if err := json.Unmarshal(body.ResponseFormat.JSONSchema.Schema, &sent); err != nil {
+		t.Fatalf("schema is not JSON: %s", err)
+	}
+	_ = json.Unmarshal(format.Schema, &want)
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("schema = %s, want %s", body.ResponseFormat.JSONSchema.Schema, format.Schema)
+	}
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/app/agent"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/schema"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/tool"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// createAgentCommand creates an agent subcommand
+func createAgentCommand(name string, definition *config.Subcommand) error {
+	// prepare tools from configuration
+	tools, err := agentTools(definition)
+	if err != nil {
+		return err
+	}
+
+	// create subcommand
+	subcmd := &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Ask a question with predefined role and prompt for %s task, and let the AI assistant use local tools", name),
+		Long: fmt.Sprintf(`Ask a question with predefined role and prompt for %s task, and let the AI assistant use local tools.
+
+The AI assistant calls tools declared in local-tools of the subcommand, and the results are given back to it
+until it answers in text or the maximum number of steps is reached.
+Each execution of tool is confirmed on the terminal unless --yes is given, and each step is logged to stderr.
+`, name),
+		Run: func(cmd *cobra.Command, args []string) {
+			prompt := viper.GetString(fmt.Sprintf("%s.prompt", name))
+			role := viper.GetString(fmt.Sprintf("%s.role", name))
+			input := in.New(os.Stdin).Consume(byte('\n'))
+
+			input, err := attachFiles(definition, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			vars, err := templateVars(cmd.Flags(), definition)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			role, prompt, input, err = renderPrompt(definition, role, prompt, input, args, vars)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			client, err := createClient(name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			maxSteps := agent.DefaultMaxSteps
+			if definition.MaxSteps != nil {
+				maxSteps = *definition.MaxSteps
+			}
+			if cmd.Flags().Changed("max-steps") {
+				maxSteps, _ = cmd.Flags().GetInt("max-steps")
+			}
+			if maxSteps < 1 {
+				fmt.Printf("'--max-steps' must be greater than or equal to 1: %d\n", maxSteps)
+				os.Exit(1)
+			}
+
+			output, err := resolveAnswerOutput(name, out.FormatRaw)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			app := agent.New(client, tools, maxSteps)
+
+			// steps are logged to stderr, and also to the log file in JSON lines if it is given
+			logger, err := newStepLogger(cmd)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			defer logger.Close()
+			app.Log = logger.Log
+
+			if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+				tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+				if err != nil {
+					fmt.Printf("can't open terminal to confirm execution of tools, use --yes to execute them without confirmation: %s\n", err)
+					os.Exit(1)
+				}
+				defer tty.Close()
+				app.Confirm = confirmAction(tty)
+			}
+
+			answer, err := app.Run(role, prompt, input)
+			if err != nil {
+				fmt.Println(err)
+				logger.Close()
+				os.Exit(1)
+			}
+
+			// the answer is terminated by a newline unless it is in an envelope
+			if !out.IsEnvelope(output.format) {
+				answer.Content = terminateLine(answer.Content)
+			}
+			if err := output.emit(answer); err != nil {
+				fmt.Println(err)
+				logger.Close()
+				os.Exit(1)
+			}
+		},
+	}
+
+	// add flags
+	subcmd.Flags().StringP("role", "r", "",
+		fmt.Sprintf("role for the AI assistant, you can also set it with PIPEGPT_%s_ROLE environment variable or config file", strings.ToUpper(name)),
+	)
+	subcmd.Flags().StringP("prompt", "p", "",
+		fmt.Sprintf("prompt for the AI assistant, you can also set it with PIPEGPT_%s_PROMPT environment variable or config file", strings.ToUpper(name)),
+	)
+	subcmd.Flags().Int("max-steps", agent.DefaultMaxSteps, "maximum number of model calls, you can also set it with max_steps of config file")
+	subcmd.Flags().String("log", "", "file which steps are appended to in JSON lines")
+
+	if err := addVarFlags(subcmd, definition); err != nil {
+		return err
+	}
+
+	// bind flags to viper
+	if err := viper.BindPFlag(fmt.Sprintf("%s.role", name), subcmd.Flags().Lookup("role")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag(fmt.Sprintf("%s.prompt", name), subcmd.Flags().Lookup("prompt")); err != nil {
+		return err
+	}
+
+	// add to root command
+	RootCmd.AddCommand(subcmd)
+	return nil
+}
+
+// agentTools is function to build tools of agent subcommand from local tools of the definition
+func agentTools(definition *config.Subcommand) ([]agent.Tool, error) {
+	tools := make([]agent.Tool, 0, len(definition.LocalTools))
+	for _, t := range definition.LocalTools {
+		// tool without parameters takes no arguments
+		parameters := t.Parameters
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+
+		def, err := schema.FromParameters(parameters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameters of tool %s: %w", t.Name, err)
+		}
+
+		var executor tool.Executor
+		switch {
+		case t.Shell != "":
+			executor = &tool.Shell{Command: t.Shell}
+		case t.HTTP != nil:
+			executor = &tool.HTTP{Method: t.HTTP.Method, URL: t.HTTP.URL, Body: t.HTTP.Body, Headers: t.HTTP.Headers}
+		case t.File != nil:
+			executor = &tool.File{Dir: t.File.Dir, Path: t.File.Path}
+		}
+
+		tools = append(tools, agent.Tool{
+			Definition: openai.FunctionDefinition{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  def,
+			},
+			Executor: executor,
+		})
+	}
+
+	return tools, nil
+}
+
+// confirmAction is function to ask the user on the terminal whether to execute the action of the tool
+func confirmAction(tty *os.File) func(name string, action *tool.Action) (bool, error) {
+	reader := bufio.NewReader(tty)
+	return func(name string, action *tool.Action) (bool, error) {
+		fmt.Fprintf(tty, "%s wants to %s\nexecute it? [y/N] ", name, action.Description)
+
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("can't read confirmation: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
+// stepLogger logs steps of agent to stderr, and to the log file in JSON lines
+type stepLogger struct {
+	file *os.File
+}
+
+// newStepLogger is function to create step logger with the log file given by --log flag
+func newStepLogger(cmd *cobra.Command) (*stepLogger, error) {
+	path, _ := cmd.Flags().GetString("log")
+	if path == "" {
+		return &stepLogger{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stepLogger{file: file}, nil
+}
+
+// Log writes the step
+func (l *stepLogger) Log(step agent.Step) {
+	switch {
+	case step.Tool == "":
+		fmt.Fprintf(os.Stderr, "[step %d] %s\n", step.Step, step.Status)
+	case step.Error != "":
+		fmt.Fprintf(os.Stderr, "[step %d] %s %s: %s: %s\n", step.Step, step.Tool, step.Arguments, step.Status, step.Error)
+	default:
+		fmt.Fprintf(os.Stderr, "[step %d] %s %s: %s\n", step.Step, step.Tool, step.Arguments, step.Status)
+	}
+
+	if l.file == nil {
+		return
+	}
+
+	raw, err := json.Marshal(step)
+	if err != nil {
+		return
+	}
+	// failure of logging does not stop the agent, it is reported to stderr
+	if _, err := fmt.Fprintln(l.file, string(raw)); err != nil {
+		fmt.Fprintf(os.Stderr, "can't write log: %s\n", err)
+	}
+}
+
+// Close closes the log file
+func (l *stepLogger) Close() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/HatsuneMiku3939/pipegpt/app/function"
+	"github.com/HatsuneMiku3939/pipegpt/app/generic"
+	"github.com/HatsuneMiku3939/pipegpt/app/structured"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/batch"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/prompt"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// fields of batch output added to each record
+const (
+	answerField    = "answer"
+	argumentsField = "arguments"
+	errorField     = "error"
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [subcommand]",
+	Short: "Ask a question for each record of JSONL or CSV input",
+	Long: `Ask a question for each record of JSONL or CSV input.
+
+Each JSONL object or CSV row (the first row is the header) is asked as a separate question,
+with the role and prompt of given subcommand unless overridden by flags.
+Role and prompt given by flags are rendered as templates, and so are those of the subcommand if it is templated.
+Fields of the record are available as .Record in templates, and as variables declared by the subcommand.
+If the record is not placed by the templates, it is given as input in JSON.
+
+Results are written in the order of input, each of them is the record plus 'answer'
+('arguments' for function-call subcommand), or 'error' if the question of the record is failed.
+A failed record does not abort the batch, but the exit status is non-zero.
+
+Example:
+# classify each issue title
+cat issues.csv | pipegpt batch -p "classify this issue title into bug, feature or question: {{.Record.title}}"
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, text, err := chatRoleAndPrompt(cmd, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		records, outputFormat, err := readRecords(cmd)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		job, err := newBatchJob(name, role, text, batchTemplates(cmd))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w, err := batch.NewWriter(os.Stdout, outputFormat, batch.Fields(records, job.resultField(), errorField))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		n, err := concurrency(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		failed, err := job.run(records, n, w)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d records failed\n", failed, len(records))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addBatchFlags(batchCmd)
+
+	RootCmd.AddCommand(batchCmd)
+}
+
+// addBatchFlags is function to add flags of role, prompt and formats to the command which reads records
+func addBatchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("role", "r", "", "role of the AI assistant, default is the role of subcommand or default role")
+	cmd.Flags().StringP("prompt", "p", "", "prompt for each record, default is the prompt of subcommand")
+	cmd.Flags().String("format", "", fmt.Sprintf("format of input, one of %s (default is detected from input)", strings.Join(batch.Formats, ", ")))
+	cmd.Flags().String("output-format", "", fmt.Sprintf("format of output, one of %s (default is the format of input)", strings.Join(batch.Formats, ", ")))
+}
+
+// readRecords is function to read records from stdin in the format given by flag or detected from input.
+// it returns the records and the format of output.
+func readRecords(cmd *cobra.Command) ([]*batch.Record, string, error) {
+	raw, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, "", err
+	}
+
+	inputFormat, _ := cmd.Flags().GetString("format")
+	if inputFormat == "" {
+		inputFormat = batch.Detect(raw)
+	}
+	outputFormat, _ := cmd.Flags().GetString("output-format")
+	if outputFormat == "" {
+		outputFormat = inputFormat
+	}
+
+	records, err := batch.Read(bytes.NewReader(raw), inputFormat)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return records, outputFormat, nil
+}
+
+// batchTemplates is function to check if role or prompt is given by flags, which are always templates in batch,
+// as they are written for the records
+func batchTemplates(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("role") || cmd.Flags().Changed("prompt")
+}
+
+// batchJob asks the question of a subcommand for each record
+type batchJob struct {
+	name       string
+	definition *config.Subcommand
+	role       string
+	prompt     string
+	// templated is true if role and prompt are rendered as templates with the record
+	templated bool
+
+	// vars are variables given by --var, fields of the record are added for each record
+	vars map[string]string
+	// files are attached files, which are given as input of every record
+	files string
+	// funcs are function definitions of function-call subcommand, nil for generic subcommand
+	funcs []openai.FunctionDefinition
+	// call chooses the function to call, envelope adds the name of called function to arguments,
+	// and array outputs function calls as an array
+	call     string
+	envelope bool
+	array    bool
+	// format is the format of answer of output-schema subcommand, nil for other subcommands
+	format *chatgpt.OutputFormat
+
+	client *chatgpt.Client
+}
+
+// newBatchJob creates a batch job of given subcommand, empty name means root command.
+// role and prompt are rendered as templates if templates is true or the subcommand is templated.
+func newBatchJob(name string, role string, text string, templates bool) (*batchJob, error) {
+	definition := definitions[name]
+	if definition != nil && definition.Type == config.TypeAgent {
+		return nil, fmt.Errorf("%s subcommand can't be run in batch, tools are executed interactively", definition.Type)
+	}
+
+	files, err := attachFiles(definition, "")
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := templateVars(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var funcs []openai.FunctionDefinition
+	var call string
+	var envelope, array bool
+	if definition != nil && definition.Type == config.TypeFunctionCall {
+		if funcs, err = functionDefinitions(definition); err != nil {
+			return nil, err
+		}
+		call, envelope, array = definition.FunctionCallMode, definition.Envelope, arrayOutput(definition)
+	}
+
+	var format *chatgpt.OutputFormat
+	if definition != nil && definition.Type == config.TypeOutputSchema {
+		if format, err = responseFormat(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := createClient(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batchJob{
+		name:       name,
+		definition: definition,
+		role:       role,
+		prompt:     text,
+		templated:  templates || templated(definition),
+		vars:       vars,
+		files:      files,
+		funcs:      funcs,
+		call:       call,
+		envelope:   envelope,
+		array:      array,
+		format:     format,
+		client:     client,
+	}, nil
+}
+
+// resultField is the field of output which the result of a record is written to
+func (j *batchJob) resultField() string {
+	if j.funcs != nil && j.call != chatgpt.FunctionCallNone {
+		return argumentsField
+	}
+
+	return answerField
+}
+
+// run asks questions of records concurrently, and writes results in order of records as they arrive.
+// it returns the number of failed records.
+func (j *batchJob) run(records []*batch.Record, concurrency int, w batch.Writer) (int, error) {
+	type result struct {
+		index  int
+		record *batch.Record
+		failed bool
+	}
+
+	results := make(chan result)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	go func() {
+		for i, record := range records {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int, record *batch.Record) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				output, failed := j.ask(record)
+				results <- result{index: i, record: output, failed: failed}
+			}(i, record)
+		}
+		wg.Wait()
+		close(results)
+	}()
+
+	// write results in order, results arrived ahead are kept until their turn
+	pending := map[int]result{}
+	next, failed := 0, 0
+	var writeErr error
+	for r := range results {
+		pending[r.index] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if r.failed {
+				failed++
+			}
+			if writeErr == nil {
+				writeErr = w.Write(r.record)
+			}
+		}
+	}
+	if writeErr != nil {
+		return failed, writeErr
+	}
+
+	return failed, w.Flush()
+}
+
+// ask asks the question of the record, and returns the record plus the result or the error, and whether it is failed
+func (j *batchJob) ask(record *batch.Record) (*batch.Record, bool) {
+	output := batch.NewRecord()
+	for _, field := range record.Fields {
+		output.Set(field, record.Values[field])
+	}
+
+	result, err := j.askRecord(record)
+	if err != nil {
+		output.Set(errorField, err.Error())
+		return output, true
+	}
+
+	output.Set(j.resultField(), result)
+	return output, false
+}
+
+// askRecord renders the templates with the record, and asks the question
+func (j *batchJob) askRecord(record *batch.Record) (interface{}, error) {
+	role, text, input, err := j.render(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.funcs != nil {
+		result, _, err := function.New(j.client).Run(role, text, input, j.funcs, j.call)
+		return functionResult(result, err, j.call, j.envelope, j.array)
+	}
+	if j.format != nil {
+		result, _, err := structured.New(j.client).Run(role, text, input, j.format)
+		return result, err
+	}
+
+	answer, err := generic.New(j.client).Run(role, text, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return answer.Content, nil
+}
+
+// functionResult is function to make the result of function call of a record.
+// a text answer is the result if function call is disabled, otherwise it is an error with the answer.
+func functionResult(results []*chatgpt.FunctionCallResult, err error, call string, envelope bool, array bool) (interface{}, error) {
+	var text *chatgpt.TextAnswerError
+	if errors.As(err, &text) {
+		if call == chatgpt.FunctionCallNone {
+			return text.Content, nil
+		}
+		return nil, fmt.Errorf("%w: %s", err, text.Content)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return functionOutput(results, envelope, array), nil
+}
+
+// render renders the templates with the record, and returns role, prompt and input which fits in the token budget
+func (j *batchJob) render(record *batch.Record) (string, string, string, error) {
+	if record.Err != nil {
+		return "", "", "", record.Err
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// the record is given as input unless it is placed by the templates
+	role, text, input := j.role, j.prompt, string(raw)+j.files
+	if j.templated {
+		vars, err := j.recordVars(record)
+		if err != nil {
+			return "", "", "", err
+		}
+
+		data := prompt.NewData(string(raw), nil, vars).WithRecord(record.Values)
+		if role, err = prompt.Render("role", j.role, data); err != nil {
+			return "", "", "", err
+		}
+		if text, err = prompt.Render("prompt", j.prompt, data); err != nil {
+			return "", "", "", err
+		}
+
+		if data.RecordPlaced() || data.InputPlaced() {
+			input = j.files
+		}
+	}
+
+	inputs, err := fitInput(j.client, j.name, role, text, input)
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(inputs) > 1 {
+		return "", "", "", fmt.Errorf("input exceeds the token budget, chunking is not available in batch mode")
+	}
+
+	return role, text, inputs[0], nil
+}
+
+// recordVars is function to resolve variables of the record.
+// fields of the record take precedence over --var and defaults, and satisfy required variables of the subcommand.
+func (j *batchJob) recordVars(record *batch.Record) (map[string]string, error) {
+	vars := map[string]string{}
+	if j.definition != nil {
+		for _, v := range j.definition.Vars {
+			if v.Default != "" {
+				vars[v.Name] = v.Default
+			}
+		}
+	}
+
+	for k, v := range j.vars {
+		vars[k] = v
+	}
+
+	for _, field := range record.Fields {
+		switch v := record.Values[field].(type) {
+		case string:
+			vars[field] = v
+		case nil, map[string]interface{}, []interface{}:
+			// only scalar values are variables
+		default:
+			vars[field] = fmt.Sprint(v)
+		}
+	}
+
+	if j.definition != nil {
+		for _, v := range j.definition.Vars {
+			if _, ok := vars[v.Name]; !ok && v.Required {
+				return nil, fmt.Errorf("'%s' is required for %s, give it as a field of the record or --var", v.Name, j.definition.Name)
+			}
+		}
+	}
+
+	return vars, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/batch"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+)
+
+func TestBatchRender(t *testing.T) {
+	record := &batch.Record{Fields: []string{"title"}, Values: map[string]interface{}{"title": "crash on {{"}}
+	raw := `{"title":"crash on {{"}`
+
+	tests := []struct {
+		name       string
+		definition *config.Subcommand
+		prompt     string
+		templates  bool
+		want       string
+		input      string
+	}{
+		{
+			name:       "subcommand not templated",
+			definition: &config.Subcommand{Name: "literal", Type: config.TypeGeneric},
+			prompt:     "Explain {{ in Go templates.",
+			want:       "Explain {{ in Go templates.",
+			input:      raw,
+		},
+		{
+			name:       "templated subcommand",
+			definition: &config.Subcommand{Name: "classify", Type: config.TypeGeneric, Template: true},
+			prompt:     "Classify: {{.Record.title}}",
+			want:       "Classify: crash on {{",
+		},
+		{
+			name:      "prompt given by flag",
+			prompt:    "Classify: {{.Record.title}}",
+			templates: true,
+			want:      "Classify: crash on {{",
+		},
+		{
+			name:      "record not placed by flag",
+			prompt:    "Classify the issue.",
+			templates: true,
+			want:      "Classify the issue.",
+			input:     raw,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &batchJob{
+				definition: tt.definition,
+				role:       "role",
+				prompt:     tt.prompt,
+				templated:  tt.templates || templated(tt.definition),
+				client:     chatgpt.NewClientWithBaseURL("test", "http://127.0.0.1", "test", time.Minute),
+			}
+
+			_, text, input, err := job.render(record)
+			if err != nil {
+				t.Fatalf("render() returned error: %s", err)
+			}
+			if text != tt.want {
+				t.Errorf("prompt = %q, want %q", text, tt.want)
+			}
+			if input != tt.input {
+				t.Errorf("input = %q, want %q", input, tt.input)
+			}
+		})
+	}
+}
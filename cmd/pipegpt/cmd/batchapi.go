@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/batch"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+)
+
+// customIDField is the field of output which custom ID is written to, if the batch is not submitted from this machine
+const customIDField = "custom_id"
+
+// fetchableStatuses are statuses of batch whose results can be fetched
+var fetchableStatuses = []string{"completed", "expired", "cancelled"}
+
+var batchSubmitCmd = &cobra.Command{
+	Use:   "submit [subcommand]",
+	Short: "Submit a question for each record of JSONL or CSV input to OpenAI Batch API",
+	Long: `Submit a question for each record of JSONL or CSV input to OpenAI Batch API.
+
+Records are templated in the same way as 'pipegpt batch', and each of them becomes a request of the batch.
+The ID of the batch is printed, the batch is processed within 24 hours at lower cost.
+Records are stored in $XDG_STATE_HOME/pipegpt/batches (default is $HOME/.local/state/pipegpt/batches),
+so that results are mapped back to them by 'pipegpt batch fetch'.
+
+Example:
+# classify each issue title overnight
+cat issues.csv | pipegpt batch submit classify
+pipegpt batch status batch_abc123
+pipegpt batch fetch batch_abc123 > classified.csv
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, text, err := chatRoleAndPrompt(cmd, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		records, outputFormat, err := readRecords(cmd)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		job, err := newBatchJob(name, role, text, batchTemplates(cmd))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		stored := &batch.Job{
+			Subcommand:  name,
+			Format:      outputFormat,
+			ResultField: job.resultField(),
+			Records:     records,
+			Errors:      map[int]string{},
+		}
+
+		// records which fail to render are not submitted, their errors are reported by fetch
+		requests := []chatgpt.BatchRequest{}
+		for i, record := range records {
+			role, text, input, err := job.render(record)
+			if err != nil {
+				stored.Errors[i] = err.Error()
+				continue
+			}
+
+			req := job.client.QuestionRequest(role, text, input)
+			switch {
+			case job.funcs != nil:
+				req = job.client.FunctionCallRequest(role, text, input, job.funcs, job.call)
+			case job.format != nil:
+				req = job.client.StructuredOutputRequest(role, text, input, job.format)
+			}
+			requests = append(requests, chatgpt.BatchRequest{CustomID: batch.CustomID(i), Request: req})
+		}
+		if len(requests) == 0 {
+			fmt.Println("no records to submit")
+			os.Exit(1)
+		}
+
+		submitted, err := job.client.SubmitBatch(requests, map[string]interface{}{"subcommand": name})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		stored.ID = submitted.ID
+		stored.SubmittedAt = time.Now()
+		if err := stored.Save(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if len(stored.Errors) > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d records are not submitted, their errors are reported by fetch\n", len(stored.Errors), len(records))
+		}
+		fmt.Println(submitted.ID)
+	},
+}
+
+var batchStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show the status of the batch submitted to OpenAI Batch API",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, _, err := batchClient(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		b, err := client.RetrieveBatch(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("id:        %s\n", b.ID)
+		fmt.Printf("status:    %s\n", b.Status)
+		fmt.Printf("requests:  %d total, %d completed, %d failed\n", b.RequestCounts.Total, b.RequestCounts.Completed, b.RequestCounts.Failed)
+		fmt.Printf("created:   %s\n", time.Unix(int64(b.CreatedAt), 0).Format(time.RFC3339))
+		if b.Errors != nil {
+			for _, e := range b.Errors.Data {
+				fmt.Printf("error:     %s: %s\n", e.Code, e.Message)
+			}
+		}
+	},
+}
+
+var batchFetchCmd = &cobra.Command{
+	Use:   "fetch <id>",
+	Short: "Download results of the batch submitted to OpenAI Batch API in order of records",
+	Long: `Download results of the batch submitted to OpenAI Batch API in order of records.
+
+Results are written in the same way as 'pipegpt batch', each of them is the record plus 'answer'
+('arguments' for function-call subcommand), or 'error' if the request of the record is failed.
+If the batch is not submitted from this machine, results are written in order of custom ID with 'custom_id' field.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, job, err := batchClient(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		b, err := client.RetrieveBatch(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if !contains(fetchableStatuses, b.Status) {
+			fmt.Printf("batch %s is %s, fetch it when it is completed\n", b.ID, b.Status)
+			os.Exit(1)
+		}
+
+		results, err := client.BatchResults(b)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		records, err := mapBatchResults(job, results)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		format, _ := cmd.Flags().GetString("output-format")
+		fields := batch.Fields(records, errorField)
+		switch {
+		case format != "":
+		case job != nil:
+			format = job.Format
+			fields = batch.Fields(records, job.ResultField, errorField)
+		default:
+			format = batch.FormatJSONL
+		}
+
+		w, err := batch.NewWriter(os.Stdout, format, fields)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, record := range records {
+			if _, ok := record.Values[errorField]; ok {
+				failed++
+			}
+			if err := w.Write(record); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d records failed\n", failed, len(records))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	addBatchFlags(batchSubmitCmd)
+	batchFetchCmd.Flags().String("output-format", "", "format of output, one of jsonl, csv (default is the format of submitted input)")
+
+	batchCmd.AddCommand(batchSubmitCmd)
+	batchCmd.AddCommand(batchStatusCmd)
+	batchCmd.AddCommand(batchFetchCmd)
+}
+
+// batchClient is function to create client for the batch, with the subcommand which the batch is submitted with.
+// the stored job is also returned, it is nil if the batch is not submitted from this machine.
+func batchClient(id string) (*chatgpt.Client, *batch.Job, error) {
+	job, err := batch.LoadJob(id)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	name := ""
+	if job != nil {
+		name = job.Subcommand
+	}
+
+	client, err := createClient(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, job, nil
+}
+
+// mapBatchResults is function to map results of batch back to records of the job in order.
+// if job is nil, results are mapped to records of custom ID in order of it.
+func mapBatchResults(job *batch.Job, results map[string]*chatgpt.BatchResult) ([]*batch.Record, error) {
+	if job == nil {
+		return unmappedBatchResults(results), nil
+	}
+
+	// arguments are validated against function definitions of the subcommand
+	var funcs []openai.FunctionDefinition
+	var call string
+	var envelope, array bool
+	if definition := definitions[job.Subcommand]; definition != nil && definition.Type == config.TypeFunctionCall {
+		var err error
+		if funcs, err = functionDefinitions(definition); err != nil {
+			return nil, err
+		}
+		call, envelope, array = definition.FunctionCallMode, definition.Envelope, arrayOutput(definition)
+	}
+
+	// answers are parsed and validated against output schema of the subcommand
+	var format *chatgpt.OutputFormat
+	if definition := definitions[job.Subcommand]; definition != nil && definition.Type == config.TypeOutputSchema {
+		var err error
+		if format, err = responseFormat(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	return job.Map(errorField, func(id string) (interface{}, bool, error) {
+		result, ok := results[id]
+		if !ok {
+			return nil, false, nil
+		}
+
+		switch {
+		case funcs != nil:
+			called, err := result.FunctionCalls(funcs)
+			value, err := functionResult(called, err, call, envelope, array)
+			return value, true, err
+		case format != nil:
+			answer, err := result.Answer()
+			if err != nil {
+				return nil, true, err
+			}
+			value, err := chatgpt.ParseStructuredOutput(answer, format)
+			return value, true, err
+		default:
+			answer, err := result.Answer()
+			return answer, true, err
+		}
+	}), nil
+}
+
+// unmappedBatchResults is function to make results into records of custom ID, in order of index of custom ID
+func unmappedBatchResults(results map[string]*chatgpt.BatchResult) []*batch.Record {
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	batch.SortCustomIDs(ids)
+
+	records := make([]*batch.Record, 0, len(ids))
+	for _, id := range ids {
+		result := results[id]
+		output := batch.NewRecord()
+		output.Set(customIDField, id)
+
+		if isFunctionCall(result.Response) {
+			called, err := result.FunctionCalls(nil)
+			if err != nil {
+				setBatchResult(output, argumentsField, nil, err)
+			} else {
+				setBatchResult(output, argumentsField, functionOutput(called, false, false), nil)
+			}
+		} else {
+			answer, err := result.Answer()
+			setBatchResult(output, answerField, answer, err)
+		}
+		records = append(records, output)
+	}
+
+	return records
+}
+
+// setBatchResult is function to set the result or the error to the record
+func setBatchResult(record *batch.Record, field string, value interface{}, err error) {
+	if err != nil {
+		record.Set(errorField, err.Error())
+		return
+	}
+
+	record.Set(field, value)
+}
+
+// isFunctionCall is function to check whether the response is a function call
+func isFunctionCall(resp openai.ChatCompletionResponse) bool {
+	if len(resp.Choices) == 0 {
+		return false
+	}
+
+	message := resp.Choices[0].Message
+	return len(message.ToolCalls) > 0 || message.FunctionCall != nil
+}
+
+// contains is function to check whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/cache"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultCacheTTL is the time to live of cached responses if it is not given
+const defaultCacheTTL = 24 * time.Hour
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached responses",
+	Long: `Manage cached responses.
+
+Responses are cached in $XDG_CACHE_HOME/pipegpt (default is $HOME/.cache/pipegpt),
+keyed by the provider, the model, the parameters, the messages and the function definitions.
+Cached responses expire after 'cache.ttl' of config file (default is 24h).
+Use --no-cache to neither read nor write the cache, or --refresh to ignore cached responses.
+`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number and size of cached responses",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := newCache()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		stats, err := c.Stats()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("directory: %s\n", stats.Dir)
+		fmt.Printf("entries:   %d (%d expired)\n", stats.Entries, stats.Expired)
+		fmt.Printf("size:      %d bytes\n", stats.Size)
+		if stats.Entries > 0 {
+			fmt.Printf("oldest:    %s\n", stats.Oldest.Format(time.RFC3339))
+			fmt.Printf("newest:    %s\n", stats.Newest.Format(time.RFC3339))
+		}
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cached response",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := newCache()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		removed, err := c.Clear()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("removed %d entries\n", removed)
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove expired cached responses",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := newCache()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		removed, err := c.Prune()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("removed %d expired entries\n", removed)
+	},
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	RootCmd.AddCommand(cacheCmd)
+}
+
+// initCacheFlags is function to initialize flags of response cache of RootCmd
+func initCacheFlags() {
+	RootCmd.PersistentFlags().Bool("no-cache", false, "neither read nor write cached responses")
+	RootCmd.PersistentFlags().Bool("refresh", false, "ignore cached responses, and cache new responses")
+}
+
+// newCache is function to create the cache of responses with TTL of config file
+func newCache() (*cache.Cache, error) {
+	ttl := defaultCacheTTL
+	if viper.IsSet("cache.ttl") {
+		var err error
+		ttl, err = time.ParseDuration(viper.GetString("cache.ttl"))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("'cache.ttl' must be a non-negative duration: %s", viper.GetString("cache.ttl"))
+		}
+	}
+
+	dir, err := cache.Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.New(dir, ttl), nil
+}
+
+// openCache is function to open the cache of responses used by questions.
+// it returns nil if caching is disabled by --no-cache flag or 'cache.enabled' of config file, and whether cached responses are ignored by --refresh flag.
+func openCache() (*cache.Cache, bool, error) {
+	refresh, _ := rootFlags.GetBool("refresh")
+	noCache, _ := rootFlags.GetBool("no-cache")
+	if noCache || (viper.IsSet("cache.enabled") && !viper.GetBool("cache.enabled")) {
+		return nil, false, nil
+	}
+
+	c, err := newCache()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return c, refresh, nil
+}
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/app/chat"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ttyPath is the path of controlling terminal, used when stdin is consumed by piped input
+const ttyPath = "/dev/tty"
+
+var chatCmd = &cobra.Command{
+	Use:   "chat [subcommand]",
+	Short: "Chat interactively with chatgpt",
+	Long: `Chat interactively with chatgpt.
+
+If input is piped, the conversation is seeded with it and the prompt.
+If subcommand is given, its role and prompt are used unless overridden by flags.
+Follow-up questions are read from the terminal, and answered with the full context.
+
+Example:
+# ask follow-up questions about the code review of staged changes
+git diff --staged | pipegpt chat review
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, prompt, err := chatRoleAndPrompt(cmd, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// consume input only if it is piped, otherwise stdin is the terminal
+		input := ""
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			input = in.New(os.Stdin).Consume(byte('\n'))
+		}
+
+		// render templates with variables of the subcommand, its flags are not available in chat mode
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		input, err = attachFiles(definitions[name], input)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		vars, err := templateVars(nil, definitions[name])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		role, prompt, input, err = renderPrompt(definitions[name], role, prompt, input, nil, vars)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+		if err != nil {
+			fmt.Println("can't open terminal:", err)
+			os.Exit(1)
+		}
+		defer tty.Close()
+
+		client, err := createClient(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		app, save, err := resumeSession(client, role)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// seed the conversation with prompt and input
+		if seed := seedMessage(prompt, input); seed != "" {
+			if err := chatAnswer(app, out.NewFormat(os.Stdout, out.FormatMarkdown), seed); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := save(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		// follow-up questions are read from the terminal, and answers are printed to stdout
+		app.REPL(tty, tty, func(question string) error {
+			return chatAnswer(app, out.NewFormat(os.Stdout, out.FormatMarkdown), question)
+		}, save)
+	},
+}
+
+func init() {
+	chatCmd.Flags().StringP("role", "r", "", "role of the AI assistant, default is the role of subcommand or default role")
+	chatCmd.Flags().StringP("prompt", "p", "", "prompt to seed the conversation with, default is the prompt of subcommand")
+
+	RootCmd.AddCommand(chatCmd)
+}
+
+// chatRoleAndPrompt resolves role and prompt from flags, subcommand definition and default role
+func chatRoleAndPrompt(cmd *cobra.Command, args []string) (string, string, error) {
+	role := viper.GetString("default.role")
+	prompt := ""
+
+	// use role and prompt of subcommand if given
+	if len(args) == 1 {
+		name := args[0]
+		if !viper.IsSet(fmt.Sprintf("%s.prompt", name)) {
+			return "", "", fmt.Errorf("unknown subcommand: %s", name)
+		}
+
+		role = viper.GetString(fmt.Sprintf("%s.role", name))
+		prompt = viper.GetString(fmt.Sprintf("%s.prompt", name))
+	}
+
+	// flags take precedence
+	if cmd.Flags().Changed("role") {
+		role, _ = cmd.Flags().GetString("role")
+	}
+	if cmd.Flags().Changed("prompt") {
+		prompt, _ = cmd.Flags().GetString("prompt")
+	}
+
+	return role, prompt, nil
+}
+
+// seedMessage builds the first user message from prompt and input
+func seedMessage(prompt string, input string) string {
+	switch {
+	case strings.TrimSpace(input) == "":
+		return prompt
+	case prompt == "":
+		return input
+	}
+
+	return chatgpt.UserMessage(prompt, input)
+}
+
+// chatAnswer asks the question in the conversation and prints the answer to the output
+func chatAnswer(app *chat.App, output *out.Out, question string) error {
+	// if streaming is disabled, print the answer at once
+	if !viper.GetBool("default.stream") {
+		result, err := app.Ask(question)
+		if err != nil {
+			return err
+		}
+
+		output.Emit(terminateLine(result))
+		return nil
+	}
+
+	// otherwise, print the answer as it arrives
+	w := output.Stream()
+	result, err := app.AskStream(question, w)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	// terminate the answer so that the next prompt starts at a new line
+	if result != terminateLine(result) {
+		_, _ = w.Write([]byte("\n"))
+	}
+
+	return w.Close()
+}
+
+// terminateLine appends a newline to s if it is not terminated by newline
+func terminateLine(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+
+	return s + "\n"
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/app/generic"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chunk"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/prompt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/token"
+)
+
+// defaultConcurrency is the number of chunks asked at once if it is not given
+const defaultConcurrency = 4
+
+// initChunkFlags is function to initialize flags of map-reduce chunking of RootCmd
+func initChunkFlags() {
+	RootCmd.PersistentFlags().String("chunk", "",
+		fmt.Sprintf("split input into chunks by one of %s, and ask the prompt over each chunk, you can also set it in subcommand or default of config file", strings.Join(chunk.Modes, ", ")),
+	)
+	RootCmd.PersistentFlags().Int("chunk-size", 0, "maximum number of tokens of each chunk, default is the token budget of input, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Int("concurrency", defaultConcurrency, "maximum number of chunks asked at once, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().String("reduce-prompt", "", "prompt to combine the answers of chunks into the final answer, answers are printed in order if it is not given, you can also set it in subcommand or default of config file")
+}
+
+// chunkMode is function to resolve the chunk mode for given subcommand, empty means chunking is not requested
+func chunkMode(name string) (string, error) {
+	raw, key, ok := lookupParameter(name, "chunk")
+	if !ok || raw == "" {
+		return "", nil
+	}
+
+	for _, mode := range chunk.Modes {
+		if raw == mode {
+			return raw, nil
+		}
+	}
+
+	return "", fmt.Errorf("'%s' must be one of %s: %s", key, strings.Join(chunk.Modes, ", "), raw)
+}
+
+// concurrency is function to resolve the number of chunks asked at once for given subcommand
+func concurrency(name string) (int, error) {
+	n, err := intParameter(name, "concurrency", 1)
+	if err != nil {
+		return 0, err
+	}
+	if n == nil {
+		return defaultConcurrency, nil
+	}
+
+	return *n, nil
+}
+
+// renderReducePrompt is function to render the reduce prompt of given subcommand.
+// the answers of chunks are given as input, so .Input of the template is empty.
+func renderReducePrompt(name string, args []string, vars map[string]string) (string, error) {
+	raw, _, ok := lookupParameter(name, "reduce_prompt")
+	if !ok || raw == "" || !templated(definitions[name]) {
+		return raw, nil
+	}
+
+	return prompt.Render("reduce_prompt", raw, prompt.NewData("", args, vars))
+}
+
+// mapReduce is function to ask the prompt over each chunk concurrently, and combine the answers with the reduce prompt.
+// if the answers do not fit in the token budget, they are reduced in groups until they fit.
+// if reduce prompt is empty, the answers are printed in order.
+func mapReduce(client *chatgpt.Client, name string, output *answerOutput, role string, prompt string, reduce string, chunks []string) error {
+	n, err := concurrency(name)
+	if err != nil {
+		return err
+	}
+
+	app := generic.New(client)
+	answers, err := app.RunEach(role, prompt, chunks, n)
+	if err != nil {
+		return err
+	}
+
+	// answers of chunks are printed in order, an envelope of each answer is printed in a line or a YAML document
+	if reduce == "" {
+		if output.edit != nil {
+			return fmt.Errorf("'--write' and '--apply-patch' require reduce prompt for chunked input")
+		}
+
+		for i, answer := range answers {
+			if i > 0 && !out.IsEnvelope(output.format) {
+				fmt.Println()
+			}
+			if err := output.emit(answer); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	limit, err := inputLimit(client, name)
+	if err != nil {
+		return err
+	}
+
+	enc, err := token.ForModel(client.Model())
+	if err != nil {
+		return err
+	}
+
+	for {
+		parts := answerParts(answers)
+		input := strings.Join(parts, "")
+		total, err := token.CountMessages(client.Model(), role, chatgpt.UserMessage(reduce, input))
+		if err != nil {
+			return err
+		}
+		if limit == 0 || total <= limit || len(answers) == 1 {
+			return askGeneric(client, output, role, reduce, input)
+		}
+
+		// reduce answers in groups which fit in the budget
+		overhead, err := token.CountMessages(client.Model(), role, chatgpt.UserMessage(reduce, "-"))
+		if err != nil {
+			return err
+		}
+		if overhead >= limit {
+			return fmt.Errorf("role and reduce prompt use %d tokens, which exceed the limit of %d tokens", overhead, limit)
+		}
+		groups := chunk.Pack(enc, parts, limit-overhead)
+		if len(groups) >= len(answers) {
+			return fmt.Errorf("answers of %d chunks have %d tokens, which can't be reduced within the limit of %d tokens", len(answers), total, limit)
+		}
+
+		if answers, err = app.RunEach(role, reduce, groups, n); err != nil {
+			return err
+		}
+	}
+}
+
+// answerParts is function to make answers of chunks into parts of the input of reduce prompt, each answer is headed by its number
+func answerParts(answers []*chatgpt.Answer) []string {
+	parts := make([]string, 0, len(answers))
+	for i, answer := range answers {
+		parts = append(parts, fmt.Sprintf("### Part %d\n\n%s\n\n", i+1, strings.TrimRight(answer.Content, "\n")))
+	}
+
+	return parts
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect configuration",
+}
+
+// ConfigValidateCmd validates config file, it is exported to run it even if subcommand definitions are invalid
+var ConfigValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate config file without calling the API",
+	Long: `Validate config file without calling the API.
+
+Subcommand definitions, API profiles, model parameters and prices are checked,
+and every problem is reported with the subcommand name and the offending key.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems := validateConfig()
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s is valid\n", viper.ConfigFileUsed())
+	},
+}
+
+func init() {
+	configCmd.AddCommand(ConfigValidateCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// validateConfig is function to validate config file, and returns every problem found
+func validateConfig() []error {
+	problems := []error{}
+	settings := viper.AllSettings()
+
+	// validate definitions
+	if _, err := config.APIProfiles(settings); err != nil {
+		problems = append(problems, flatten(err)...)
+	}
+	subcmds, err := config.Subcommands(settings)
+	if err != nil {
+		problems = append(problems, flatten(err)...)
+	}
+	if _, err := config.Prices(viper.Get("prices")); err != nil {
+		problems = append(problems, flatten(err)...)
+	}
+
+	// clients below never send requests, so that their usage is not tracked and prices are not reported again for each of them
+	usageTracker = &tracker{}
+
+	// validate API configuration and model parameters resolved for root command and each subcommand
+	names := []string{""}
+	for _, subcmd := range subcmds {
+		names = append(names, subcmd.Name)
+	}
+
+	for _, name := range names {
+		section := name
+		if section == "" {
+			section = "default"
+		}
+
+		client, err := createClient(name)
+		if err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+			continue
+		}
+
+		if _, err := inputLimit(client, name); err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+		}
+		if _, err := overflowStrategy(name); err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+		}
+		if _, err := chunkMode(name); err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+		}
+		if _, err := intParameter(name, "chunk_size", 1); err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+		}
+		if _, err := concurrency(name); err != nil {
+			problems = append(problems, &config.ValidationError{Section: section, Message: err.Error()})
+		}
+	}
+
+	return problems
+}
+
+// flatten is function to split ValidationErrors into each problem
+func flatten(err error) []error {
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		return []error{err}
+	}
+
+	problems := make([]error, 0, len(errs))
+	for _, e := range errs {
+		problems = append(problems, e)
+	}
+
+	return problems
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+)
+
+// extractModes are available parts of the answer to extract
+var extractModes = []string{"code"}
+
+// initExtractFlags is function to initialize flags of extracting code blocks of RootCmd
+func initExtractFlags() {
+	RootCmd.PersistentFlags().String("extract", "",
+		fmt.Sprintf("print only a part of the answer, one of %s", strings.Join(extractModes, ", ")),
+	)
+	RootCmd.PersistentFlags().String("lang", "", "language of code blocks to extract with '--extract code', such as yaml")
+	RootCmd.PersistentFlags().Int("block", 0, "number of code block to extract with '--extract code' starting from 1, default is all of them")
+}
+
+// textOnlyFlags are flags which are available only for text answers
+var textOnlyFlags = []string{"extract", "lang", "block", "write", "apply-patch"}
+
+// checkTextOnlyFlags is function to check that no flag for text answers is given to the subcommand which answers in JSON
+func checkTextOnlyFlags(kind string) error {
+	for _, flag := range textOnlyFlags {
+		if rootFlags.Lookup(flag).Changed {
+			return fmt.Errorf("'--%s' is not available for %s subcommand", flag, kind)
+		}
+	}
+
+	return nil
+}
+
+// extraction is the code blocks to extract from the answer
+type extraction struct {
+	lang  string
+	block int
+}
+
+// resolveExtraction is function to resolve extraction from flags, nil means the answer is printed as it is
+func resolveExtraction() (*extraction, error) {
+	mode, _ := rootFlags.GetString("extract")
+	lang, _ := rootFlags.GetString("lang")
+	block, _ := rootFlags.GetInt("block")
+
+	if mode == "" {
+		if lang != "" || rootFlags.Lookup("block").Changed {
+			return nil, fmt.Errorf("'--lang' and '--block' require '--extract code'")
+		}
+		return nil, nil
+	}
+
+	if !contains(extractModes, mode) {
+		return nil, fmt.Errorf("'--extract' must be one of %s: %s", strings.Join(extractModes, ", "), mode)
+	}
+	if rootFlags.Lookup("block").Changed && block < 1 {
+		return nil, fmt.Errorf("'--block' must be greater than or equal to 1: %d", block)
+	}
+
+	return &extraction{lang: lang, block: block}, nil
+}
+
+// apply replaces the content of the answer with the extracted code
+func (e *extraction) apply(answer *chatgpt.Answer) error {
+	code, err := out.ExtractCode(answer.Content, e.lang, e.block)
+	if err != nil {
+		return err
+	}
+
+	answer.Content = code
+	return nil
+}
+
+// extractFormat is function to decide output format of extracted code, which is printed as it is unless it is in an envelope
+func extractFormat(format string, extract *extraction) string {
+	if extract == nil || out.IsEnvelope(format) {
+		return format
+	}
+
+	return out.FormatRaw
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
+)
+
+// initFileFlags is function to initialize file flags of RootCmd
+func initFileFlags() {
+	RootCmd.PersistentFlags().StringArrayP("file", "f", nil, "file or glob pattern to attach as context, '**' matches any directories and files ignored by .gitignore are skipped. can be repeated")
+}
+
+// attachFiles is function to append files given by the subcommand definition and flags to the input.
+// definition may be nil if it is not available.
+func attachFiles(definition *config.Subcommand, input string) (string, error) {
+	patterns := []string{}
+	if definition != nil {
+		patterns = append(patterns, definition.Files...)
+	}
+
+	files, err := rootFlags.GetStringArray("file")
+	if err != nil {
+		return "", err
+	}
+	patterns = append(patterns, files...)
+
+	if len(patterns) == 0 {
+		return input, nil
+	}
+
+	attachment, err := in.Attach(patterns)
+	if err != nil {
+		return "", err
+	}
+
+	return input + attachment, nil
+}
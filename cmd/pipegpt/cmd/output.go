@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+)
+
+// initOutputFlags is function to initialize output format flag of RootCmd
+func initOutputFlags() {
+	RootCmd.PersistentFlags().StringP("output", "o", "",
+		fmt.Sprintf("output format, one of %s (default is markdown for text answers and raw for JSON answers), you can also set it in subcommand or default of config file", strings.Join(out.Formats, ", ")),
+	)
+}
+
+// outputFormat is function to resolve output format of given subcommand, fallback is used if it is not set
+func outputFormat(name string, fallback string) (string, error) {
+	raw, key, ok := lookupParameter(name, "output")
+	if !ok || raw == "" {
+		return fallback, nil
+	}
+
+	if !contains(out.Formats, raw) {
+		return "", fmt.Errorf("'%s' must be one of %s: %s", key, strings.Join(out.Formats, ", "), raw)
+	}
+
+	return raw, nil
+}
+
+// answerOutput is the way to print text answers
+type answerOutput struct {
+	format string
+	// extract is the code blocks printed instead of the whole answer, nil means the whole answer is printed
+	extract *extraction
+	// edit writes the answer into a file or applies it as a patch instead of printing it, nil means it is printed
+	edit *edit
+
+	out *out.Out
+}
+
+// resolveAnswerOutput is function to resolve the way to print text answers of given subcommand,
+// fallback is the output format if it is not set
+func resolveAnswerOutput(name string, fallback string) (*answerOutput, error) {
+	format, err := outputFormat(name, fallback)
+	if err != nil {
+		return nil, err
+	}
+
+	extract, err := resolveExtraction()
+	if err != nil {
+		return nil, err
+	}
+
+	edit, err := resolveEdit(format)
+	if err != nil {
+		return nil, err
+	}
+
+	format = extractFormat(format, extract)
+	return &answerOutput{format: format, extract: extract, edit: edit, out: out.NewFormat(os.Stdout, format)}, nil
+}
+
+// buffered returns whether the answer must be printed at once instead of as it arrives
+func (o *answerOutput) buffered() bool {
+	return out.IsEnvelope(o.format) || o.extract != nil || o.edit != nil
+}
+
+// emit prints the answer
+func (o *answerOutput) emit(answer *chatgpt.Answer) error {
+	if o.extract != nil {
+		if err := o.extract.apply(answer); err != nil {
+			return err
+		}
+	}
+
+	if o.edit != nil {
+		return o.edit.apply(answer.Content, o.extract != nil)
+	}
+
+	return emitAnswer(o.out, o.format, answer)
+}
+
+// envelope is function to put the content into the envelope with metadata of the answer
+func envelope(content interface{}, answer *chatgpt.Answer) *out.Envelope {
+	e := &out.Envelope{Content: content}
+	if answer == nil {
+		return e
+	}
+
+	e.Model = answer.Model
+	e.FinishReason = string(answer.FinishReason)
+	e.Cached = answer.Cached
+	if answer.Usage.TotalTokens > 0 {
+		e.Usage = &out.Usage{
+			PromptTokens:     answer.Usage.PromptTokens,
+			CompletionTokens: answer.Usage.CompletionTokens,
+			TotalTokens:      answer.Usage.TotalTokens,
+		}
+		if usageTracker != nil {
+			e.Usage.Cost = usageTracker.prices.Cost(answer.Model, answer.Usage.PromptTokens, answer.Usage.CompletionTokens)
+		}
+	}
+
+	return e
+}
+
+// emitAnswer is function to write the text answer in the format
+func emitAnswer(output *out.Out, format string, answer *chatgpt.Answer) error {
+	if out.IsEnvelope(format) {
+		return output.EmitEnvelope(format, envelope(answer.Content, answer))
+	}
+
+	output.Emit(answer.Content)
+	return nil
+}
+
+// emitResult is function to write JSON result of function call or output schema in the format.
+// the result is written in a line of JSON unless the format has an envelope.
+func emitResult(output *out.Out, format string, result interface{}, answer *chatgpt.Answer) error {
+	if out.IsEnvelope(format) {
+		return output.EmitEnvelope(format, envelope(result, answer))
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(output.Out, string(raw))
+	return err
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+
+	"github.com/spf13/viper"
+)
+
+// parameterFlags maps config keys of model parameters and input limits to flag names
+var parameterFlags = map[string]string{
+	"temperature":       "temperature",
+	"top_p":             "top-p",
+	"max_tokens":        "max-tokens",
+	"presence_penalty":  "presence-penalty",
+	"frequency_penalty": "frequency-penalty",
+	"stop":              "stop",
+	"seed":              "seed",
+	"max_input_tokens":  "max-input-tokens",
+	"overflow":          "overflow",
+	"chunk":             "chunk",
+	"chunk_size":        "chunk-size",
+	"concurrency":       "concurrency",
+	"reduce_prompt":     "reduce-prompt",
+	"output":            "output",
+}
+
+// initParameterFlags is function to initialize model parameter flags of RootCmd
+func initParameterFlags() {
+	RootCmd.PersistentFlags().Float32("temperature", 0, "sampling temperature between 0 and 2 (0 and 1 for anthropic), 0 is sent as the smallest non-zero value, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Float32("top-p", 0, "nucleus sampling probability mass between 0 and 1, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Int("max-tokens", 0, "maximum number of tokens to generate, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Float32("presence-penalty", 0, "presence penalty between -2 and 2, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Float32("frequency-penalty", 0, "frequency penalty between -2 and 2, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().StringSlice("stop", nil, "sequences where the model stops generating, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().Int("seed", 0, "seed for deterministic sampling, you can also set it in subcommand or default of config file")
+}
+
+// resolveParameters is function to resolve model parameters of given subcommand in precedence order of flag, subcommand and default.
+// empty name means root command, and ranges of parameters are checked for the provider.
+func resolveParameters(name string, provider string) (chatgpt.Parameters, error) {
+	params := chatgpt.Parameters{}
+
+	// Anthropic allows temperature only between 0 and 1
+	maxTemperature := 2.0
+	if provider == "anthropic" {
+		maxTemperature = 1
+	}
+
+	var err error
+	if params.Temperature, err = floatParameter(name, "temperature", 0, maxTemperature); err != nil {
+		if provider == "anthropic" {
+			return params, fmt.Errorf("%w, as anthropic provider allows temperature only up to 1", err)
+		}
+		return params, err
+	}
+	if params.TopP, err = floatParameter(name, "top_p", 0, 1); err != nil {
+		return params, err
+	}
+	if params.PresencePenalty, err = floatParameter(name, "presence_penalty", -2, 2); err != nil {
+		return params, err
+	}
+	if params.FrequencyPenalty, err = floatParameter(name, "frequency_penalty", -2, 2); err != nil {
+		return params, err
+	}
+	if params.MaxTokens, err = intParameter(name, "max_tokens", 1); err != nil {
+		return params, err
+	}
+	if params.Seed, err = intParameter(name, "seed", math.MinInt); err != nil {
+		return params, err
+	}
+
+	// stop sequences are given as a list
+	if flag := rootFlags.Lookup(parameterFlags["stop"]); flag.Changed {
+		params.Stop, _ = rootFlags.GetStringSlice(flag.Name)
+	} else if key, ok := parameterKey(name, "stop"); ok {
+		params.Stop = viper.GetStringSlice(key)
+	}
+
+	return params, nil
+}
+
+// floatParameter is function to resolve a float parameter, and check if it is in range of min and max
+func floatParameter(name string, param string, min float64, max float64) (*float32, error) {
+	raw, key, ok := lookupParameter(name, param)
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 32)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' must be a number: %s", key, raw)
+	}
+	if v < min || v > max {
+		return nil, fmt.Errorf("'%s' must be between %v and %v: %s", key, min, max, raw)
+	}
+
+	f := float32(v)
+	return &f, nil
+}
+
+// intParameter is function to resolve an integer parameter, and check if it is not less than min
+func intParameter(name string, param string, min int) (*int, error) {
+	raw, key, ok := lookupParameter(name, param)
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' must be an integer: %s", key, raw)
+	}
+	if v < min {
+		return nil, fmt.Errorf("'%s' must be greater than or equal to %d: %s", key, min, raw)
+	}
+
+	return &v, nil
+}
+
+// lookupParameter is function to look up raw value of a parameter from flag and config file.
+// it returns the raw value, the key where the value is found, and whether it is found.
+func lookupParameter(name string, param string) (string, string, bool) {
+	if flag := rootFlags.Lookup(parameterFlags[param]); flag.Changed {
+		return flag.Value.String(), fmt.Sprintf("--%s", flag.Name), true
+	}
+
+	key, ok := parameterKey(name, param)
+	if !ok {
+		return "", "", false
+	}
+
+	return fmt.Sprint(viper.Get(key)), key, true
+}
+
+// parameterKey is function to find config key of a parameter which is set, subcommand takes precedence over default
+func parameterKey(name string, param string) (string, bool) {
+	if name != "" {
+		if key := fmt.Sprintf("%s.%s", name, param); viper.IsSet(key) {
+			return key, true
+		}
+	}
+
+	if key := fmt.Sprintf("default.%s", param); viper.IsSet(key) {
+		return key, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveParametersTemperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature string
+		provider    string
+		err         string
+	}{
+		{name: "zero", temperature: "0", provider: "openai"},
+		{name: "up to 2 for openai", temperature: "1.5", provider: "openai"},
+		{name: "above 2 for openai", temperature: "2.5", provider: "openai", err: "'--temperature' must be between 0 and 2: 2.5"},
+		{name: "up to 1 for anthropic", temperature: "1", provider: "anthropic"},
+		{
+			name:        "above 1 for anthropic",
+			temperature: "1.5",
+			provider:    "anthropic",
+			err:         "'--temperature' must be between 0 and 1: 1.5, as anthropic provider allows temperature only up to 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flag := rootFlags.Lookup("temperature")
+			if err := flag.Value.Set(tt.temperature); err != nil {
+				t.Fatal(err)
+			}
+			flag.Changed = true
+			t.Cleanup(func() {
+				_ = flag.Value.Set(flag.DefValue)
+				flag.Changed = false
+			})
+
+			params, err := resolveParameters("", tt.provider)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("resolveParameters() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveParameters() returned error: %s", err)
+			}
+			if params.Temperature == nil || fmt.Sprint(*params.Temperature) != tt.temperature {
+				t.Errorf("temperature = %v, want %s", params.Temperature, tt.temperature)
+			}
+		})
+	}
+}
@@ -3,16 +3,19 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/HatsuneMiku3939/pipegpt/app/generic"
 	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
 	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
 	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -25,6 +28,12 @@ const defaultRole = "Act like you are professional IT engineer to help solve use
 // configFile config file given by flag
 var configFile string
 
+// profileName API profile given by flag
+var profileName string
+
+// rootFlags persistent flags of RootCmd, used to check whether flag is given
+var rootFlags *pflag.FlagSet
+
 var RootCmd = &cobra.Command{
 	Use:   "pipegpt",
 	Short: "A simple CLI tools to question chatgpt",
@@ -54,20 +63,40 @@ cat sample.json | pipegpt -p "convert JSON to YAML"
 		role := viper.GetString("default.role")
 		input := in.New(os.Stdin).Consume(byte('\n'))
 
-		client, err := createClient()
+		input, err = attachFiles(nil, input)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
-		result, err := generic.New(client).Run(role, prompt, input)
+		vars, err := templateVars(nil, nil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		role, prompt, input, err = renderPrompt(nil, role, prompt, input, args, vars)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		reduce, err := renderReducePrompt("", args, vars)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		client, err := createClient("")
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
-		// print result with markdown formatter
-		out.New(os.Stdout, out.MarkdownFormatter).Emit(result)
+		if err := runGeneric(client, "", role, prompt, reduce, input); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	},
 }
 
@@ -80,8 +109,12 @@ func initFlag() {
 	RootCmd.PersistentFlags().StringP("key", "k", "", "OpenAI API key, you can also set it with PIPEGPT_API_KEY environment variable or config file")
 	RootCmd.PersistentFlags().StringP("model", "m", "gpt-4", "OpenAI API model, you can also set it with PIPEGPT_API_MODEL environment variable or config file")
 	RootCmd.PersistentFlags().StringP("timeout", "t", "240s", "Timeout of OpenAI API request, you can also set it with PIPEGPT_API_TIMEOUT environment variable or config file")
-	RootCmd.PersistentFlags().StringP("endpoint", "e", "", "Endpoint of Azure OpenAI API, you can also set it with PIPEGPT_API_ENDPOINT environment variable or config file")
+	RootCmd.PersistentFlags().StringP("endpoint", "e", "", "Endpoint of Azure OpenAI API, or base URL of other providers, you can also set it with PIPEGPT_API_ENDPOINT environment variable or config file")
+	RootCmd.PersistentFlags().String("provider", "", "API provider, one of openai, azure, anthropic or ollama (default is azure if endpoint is set, otherwise openai), you can also set it with PIPEGPT_API_PROVIDER environment variable or config file")
 	RootCmd.PersistentFlags().StringP("conversion", "c", "", "comma separated list of model conversion table of Azure OpenAI API. ex) 'gpt-4=foo-gpt-4, gpt-3=bar-gpt-3'")
+	RootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "name of the API profile defined in 'apis' of config file, default is the profile of subcommand or 'default.profile'")
+	RootCmd.PersistentFlags().StringP("session", "s", "", "name of the session to continue the conversation in, you can also set it with PIPEGPT_DEFAULT_SESSION environment variable")
+	RootCmd.PersistentFlags().Bool("stream", true, "stream the answer as it arrives, you can also set it with PIPEGPT_DEFAULT_STREAM environment variable or config file")
 	RootCmd.Flags().StringP("role", "r", defaultRole, "role of the AI assistant, you can also set it with PIPEGPT_DEFAULT_ROLE environment variable or config file")
 	RootCmd.Flags().StringP("prompt", "p", "", "prompt to use for the AI assistant")
 	if err := RootCmd.MarkFlagRequired("prompt"); err != nil {
@@ -89,6 +122,18 @@ func initFlag() {
 		os.Exit(1)
 	}
 
+	initParameterFlags()
+	initTokenFlags()
+	initChunkFlags()
+	initCacheFlags()
+	initTemplateFlags()
+	initFileFlags()
+	initOutputFlags()
+	initExtractFlags()
+	initWriteFlags()
+	initUsageFlags()
+	rootFlags = RootCmd.PersistentFlags()
+
 	// bind flag to viper
 	if err := viper.BindPFlag("api.key", RootCmd.PersistentFlags().Lookup("key")); err != nil {
 		fmt.Println(err)
@@ -110,6 +155,11 @@ func initFlag() {
 		os.Exit(1)
 	}
 
+	if err := viper.BindPFlag("api.provider", RootCmd.PersistentFlags().Lookup("provider")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if err := viper.BindPFlag("api.conversion", RootCmd.PersistentFlags().Lookup("conversion")); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -119,10 +169,21 @@ func initFlag() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+
+	if err := viper.BindPFlag("default.stream", RootCmd.PersistentFlags().Lookup("stream")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := viper.BindPFlag("default.session", RootCmd.PersistentFlags().Lookup("session")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 
-// initViper is function to initialize viper
-func initViper() {
+// InitConfig is function to read config file and environment variables into viper.
+// it must be called before subcommands are created, as they are defined in config file.
+func InitConfig() {
 	if configFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(configFile)
@@ -154,60 +215,295 @@ func initViper() {
 
 func init() {
 	initFlag()
-	initViper()
 }
 
-// createClient is function to create chatgpt client
-func createClient() (*chatgpt.Client, error) {
-	// if endpoint is set, create azure openai client
-	if viper.GetString("api.endpoint") != "" {
-		return createAzureOpenAIClient()
+// runGeneric is function to fit input into the token budget of given subcommand, and ask a generic question.
+// if input is chunked, the prompt is asked over each chunk and the answers are combined by the reduce prompt.
+func runGeneric(client *chatgpt.Client, name string, role string, prompt string, reduce string, input string) error {
+	output, err := resolveAnswerOutput(name, out.FormatMarkdown)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := fitInput(client, name, role, prompt, input)
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) > 1 {
+		return mapReduce(client, name, output, role, prompt, reduce, inputs)
+	}
+
+	return askGeneric(client, output, role, prompt, inputs[0])
+}
+
+// askGeneric is function to ask a generic question and print the answer to the output
+func askGeneric(client *chatgpt.Client, output *answerOutput, role string, prompt string, input string) error {
+	// if session is given, continue the conversation of the session
+	if viper.GetString("default.session") != "" {
+		if output.buffered() {
+			return fmt.Errorf("%s output, '--extract', '--write' and '--apply-patch' are not available in session", output.format)
+		}
+
+		app, save, err := resumeSession(client, role)
+		if err != nil {
+			return err
+		}
+
+		if err := chatAnswer(app, output.out, seedMessage(prompt, input)); err != nil {
+			return err
+		}
+
+		return save()
+	}
+
+	// if streaming is disabled or the whole answer is required to print it, print the answer at once
+	if !viper.GetBool("default.stream") || output.buffered() {
+		result, err := generic.New(client).Run(role, prompt, input)
+		if err != nil {
+			return err
+		}
+
+		return output.emit(result)
+	}
+
+	// otherwise, print the answer as it arrives
+	w := output.out.Stream()
+	if _, err := generic.New(client).RunStream(role, prompt, input, w); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// apiConfig is the API configuration resolved from flags, profile and api block of config file
+type apiConfig struct {
+	// prefix is the config key prefix which the configuration is resolved from, used in error messages
+	prefix string
+
+	provider   string
+	key        string
+	model      string
+	endpoint   string
+	conversion string
+	timeout    string
+	retries    string
+	maxBackoff string
+}
+
+// createClient is function to create chatgpt client for given subcommand, empty name means root command
+func createClient(name string) (*chatgpt.Client, error) {
+	profile, err := resolveProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	api := resolveAPIConfig(profile)
+	params, err := resolveParameters(name, providerName(api))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(api)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := retryPolicy(api)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, refresh, err := openCache()
+	if err != nil {
+		return nil, err
+	}
+
+	tracker, err := trackUsage(name, providerName(api))
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetParameters(params)
+	client.SetRetryPolicy(policy)
+	client.SetCache(responses, refresh)
+	client.SetUsageHook(tracker.record)
+	return client, nil
+}
+
+// providerName is function to get the name of API provider which the client of API configuration is created for
+func providerName(api *apiConfig) string {
+	switch {
+	case api.provider != "":
+		return api.provider
+	case api.endpoint != "":
+		return "azure"
+	default:
+		return "openai"
+	}
+}
+
+// retryPolicy is function to create retry policy from API configuration, the default is used for fields which are not set
+func retryPolicy(api *apiConfig) (chatgpt.RetryPolicy, error) {
+	policy := chatgpt.DefaultRetryPolicy
+
+	if api.retries != "" {
+		retries, err := strconv.Atoi(api.retries)
+		if err != nil || retries < 0 {
+			return policy, fmt.Errorf("'%s.retries' must be a non-negative integer: %s", api.prefix, api.retries)
+		}
+		policy.Retries = retries
+	}
+
+	if api.maxBackoff != "" {
+		maxBackoff, err := time.ParseDuration(api.maxBackoff)
+		if err != nil || maxBackoff <= 0 {
+			return policy, fmt.Errorf("'%s.max_backoff' must be a positive duration: %s", api.prefix, api.maxBackoff)
+		}
+		policy.MaxBackoff = maxBackoff
+	}
+
+	return policy, nil
+}
+
+// newClient is function to create chatgpt client of the provider given by API configuration
+func newClient(api *apiConfig) (*chatgpt.Client, error) {
+	switch api.provider {
+	case "":
+		// if endpoint is set, create azure openai client
+		if api.endpoint != "" {
+			return createAzureOpenAIClient(api)
+		}
+
+		// otherwise, create openai client
+		return createOpenAIClient(api)
+	case "openai":
+		return createOpenAIClient(api)
+	case "azure":
+		return createAzureOpenAIClient(api)
+	case "anthropic":
+		return createAnthropicClient(api)
+	case "ollama":
+		return createOllamaClient(api)
+	default:
+		return nil, fmt.Errorf("unknown provider: '%s' in '%s.provider', must be one of %s", api.provider, api.prefix, strings.Join(config.Providers, ", "))
+	}
+}
+
+// resolveProfile is function to resolve API profile in precedence order of flag, subcommand and default.
+// empty profile means api block of config file is used.
+func resolveProfile(name string) (string, error) {
+	profile := viper.GetString("default.profile")
+	if name != "" && viper.IsSet(fmt.Sprintf("%s.profile", name)) {
+		profile = viper.GetString(fmt.Sprintf("%s.profile", name))
+	}
+	if profileName != "" {
+		profile = profileName
+	}
+
+	if profile != "" && !viper.IsSet(fmt.Sprintf("apis.%s", profile)) {
+		return "", fmt.Errorf("unknown profile: '%s', it must be defined in 'apis'", profile)
+	}
+
+	return profile, nil
+}
+
+// resolveAPIConfig is function to resolve API configuration of given profile.
+// each field is taken from flag if it is given, otherwise from the profile, and falls back to api block of config file.
+func resolveAPIConfig(profile string) *apiConfig {
+	prefix := "api"
+	if profile != "" {
+		prefix = fmt.Sprintf("apis.%s", profile)
 	}
 
-	// otherwise, create openai client
-	return createOpenAIClient()
+	get := func(field string) string {
+		key := fmt.Sprintf("apis.%s.%s", profile, field)
+		if flag := rootFlags.Lookup(field); flag != nil && flag.Changed {
+			return flag.Value.String()
+		}
+		if profile != "" && viper.IsSet(key) {
+			return viper.GetString(key)
+		}
+		return viper.GetString(fmt.Sprintf("api.%s", field))
+	}
+
+	return &apiConfig{
+		prefix:     prefix,
+		provider:   get("provider"),
+		key:        get("key"),
+		model:      get("model"),
+		endpoint:   get("endpoint"),
+		conversion: get("conversion"),
+		timeout:    get("timeout"),
+		retries:    get("retries"),
+		maxBackoff: get("max_backoff"),
+	}
 }
 
 // createOpenAIClient is function to create openai client
-func createOpenAIClient() (*chatgpt.Client, error) {
-	// get arguments from viper
-	key := viper.GetString("api.key")
-	timeout, err := time.ParseDuration(viper.GetString("api.timeout"))
+func createOpenAIClient(api *apiConfig) (*chatgpt.Client, error) {
+	timeout, err := time.ParseDuration(api.timeout)
 	if err != nil {
 		return nil, err
 	}
-	model := viper.GetString("api.model")
 
 	// create client
-	client := chatgpt.NewClient(key, model, timeout)
+	client := chatgpt.NewClientWithBaseURL(api.key, api.endpoint, api.model, timeout)
+	return client, nil
+}
+
+// createAnthropicClient is function to create anthropic client
+func createAnthropicClient(api *apiConfig) (*chatgpt.Client, error) {
+	timeout, err := time.ParseDuration(api.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// create client
+	client := chatgpt.NewAnthropicClient(api.key, api.endpoint, api.model, timeout)
+	return client, nil
+}
+
+// createOllamaClient is function to create ollama client
+func createOllamaClient(api *apiConfig) (*chatgpt.Client, error) {
+	timeout, err := time.ParseDuration(api.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// create client
+	client := chatgpt.NewOllamaClient(api.endpoint, api.model, timeout)
 	return client, nil
 }
 
 // createAzureOpenAIClient is function to create azure openai client
-func createAzureOpenAIClient() (*chatgpt.Client, error) {
-	// get arguments from viper
-	key := viper.GetString("api.key")
-	endpoint := viper.GetString("api.endpoint")
-	timeout, err := time.ParseDuration(viper.GetString("api.timeout"))
+func createAzureOpenAIClient(api *apiConfig) (*chatgpt.Client, error) {
+	if api.endpoint == "" {
+		return nil, fmt.Errorf("'%s.endpoint' is required for azure provider", api.prefix)
+	}
+	timeout, err := time.ParseDuration(api.timeout)
 	if err != nil {
 		return nil, err
 	}
-	model := viper.GetString("api.model")
-	rawModelMap := viper.GetString("api.conversion")
 
 	// create model map
 	const requiredConversionTokenCount = 2
 	modelMap := map[string]string{}
-	for _, v := range strings.Split(rawModelMap, ",") {
+	for _, v := range strings.Split(api.conversion, ",") {
 		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
 		kv := strings.Split(v, "=")
 		if len(kv) != requiredConversionTokenCount {
-			return nil, fmt.Errorf("'api.conversion' must be a key-value pair separated by '='")
+			return nil, fmt.Errorf("'%s.conversion' must be a key-value pair separated by '='", api.prefix)
 		}
-		modelMap[kv[0]] = kv[1]
+		modelMap[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 	}
 
 	// create client
-	client := chatgpt.NewAzureOpenAIClient(key, endpoint, model, modelMap, timeout)
+	client := chatgpt.NewAzureOpenAIClient(api.key, api.endpoint, api.model, modelMap, timeout)
 	return client, nil
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/runner"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultRunField is the argument of function call which has the command to execute by default
+const defaultRunField = "command"
+
+// runMode is function to resolve run mode of the subcommand, flag takes precedence over config file
+func runMode(cmd *cobra.Command, definition *config.Subcommand) (string, error) {
+	mode := definition.Run
+	if cmd.Flags().Changed("run") {
+		mode, _ = cmd.Flags().GetString("run")
+		if !contains(config.RunModes, mode) {
+			return "", fmt.Errorf("'--run' must be one of %s: %s", strings.Join(config.RunModes, ", "), mode)
+		}
+	}
+	if mode == "" {
+		mode = config.RunNever
+	}
+
+	return mode, nil
+}
+
+// commandRunner executes commands of function call results, the terminal is used for confirmation and stdin of commands
+type commandRunner struct {
+	mode  string
+	field string
+	tty   *os.File
+	input *bufio.Reader
+}
+
+// newCommandRunner is function to create command runner of the mode, the terminal is required to confirm commands
+func newCommandRunner(mode string, definition *config.Subcommand) (*commandRunner, error) {
+	r := &commandRunner{mode: mode, field: definition.RunField}
+	if r.field == "" {
+		r.field = defaultRunField
+	}
+
+	// dangerous commands are confirmed even in auto mode, so the terminal is opened in both modes
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		if mode == config.RunConfirm {
+			return nil, fmt.Errorf("can't open terminal to confirm the command: %w", err)
+		}
+		return r, nil
+	}
+	r.tty = tty
+	r.input = bufio.NewReader(tty)
+
+	return r, nil
+}
+
+// Close closes the terminal
+func (r *commandRunner) Close() {
+	if r.tty != nil {
+		r.tty.Close()
+	}
+}
+
+// Run executes the command of function call result after confirmation, and returns its exit status.
+// the status is 1 if the command is declined.
+func (r *commandRunner) Run(result *chatgpt.FunctionCallResult) (int, error) {
+	raw, ok := result.Arguments[r.field]
+	if !ok {
+		return 0, fmt.Errorf("function %s returned no '%s' to run", result.Name, r.field)
+	}
+	command, ok := raw.(string)
+	if !ok || strings.TrimSpace(command) == "" {
+		return 0, fmt.Errorf("'%s' of function %s is not a command: %v", r.field, result.Name, raw)
+	}
+
+	danger, dangerous := runner.Dangerous(command)
+	if r.mode == config.RunAuto && !dangerous {
+		fmt.Fprintf(os.Stderr, "+ %s\n", command)
+	} else {
+		if r.tty == nil {
+			return 0, fmt.Errorf("can't open terminal to confirm the dangerous command (%s): %s", danger, command)
+		}
+
+		ok, err := r.confirm(command, danger, dangerous)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 1, nil
+		}
+	}
+
+	// stdin is consumed by input of the question, the terminal is given to the command instead
+	var stdin io.Reader = os.Stdin
+	if r.tty != nil {
+		stdin = r.tty
+	}
+
+	return runner.Run(command, stdin, os.Stdout, os.Stderr)
+}
+
+// confirm asks the user whether to run the command on the terminal, dangerous command is declined by default
+func (r *commandRunner) confirm(command string, danger string, dangerous bool) (bool, error) {
+	if dangerous {
+		fmt.Fprintf(r.tty, "warning: the command looks dangerous (%s)\nRun '%s' ? [y/N] ", danger, command)
+	} else {
+		fmt.Fprintf(r.tty, "Run '%s' ? [Y/n] ", command)
+	}
+
+	answer, err := r.input.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("can't read confirmation: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	case "":
+		return !dangerous, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/app/chat"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/session"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage conversation sessions",
+	Long: `Manage conversation sessions.
+
+Sessions are stored in $XDG_STATE_HOME/pipegpt/sessions (default is $HOME/.local/state/pipegpt/sessions).
+A session is created or continued with --session flag, so that piped invocations share one conversation.
+
+Example:
+# review the change, then ask about the test output in the same conversation
+git diff --staged | pipegpt --session fix-123 review
+go test ./... 2>&1 | pipegpt --session fix-123 -p "why does this test fail with the change?"
+`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored sessions",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		infos, err := session.List()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tMESSAGES\tUPDATED")
+		for _, info := range infos {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", info.Name, info.Messages, info.UpdatedAt.Format(time.RFC3339))
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+var sessionShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show the conversation of the session",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := loadStoredSession(args[0])
+
+		// print conversation with markdown formatter
+		out.New(os.Stdout, out.MarkdownFormatter).Emit(s.Markdown())
+	},
+}
+
+var sessionRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "Remove sessions",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range args {
+			if err := session.Remove(name); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+var sessionExportCmd = &cobra.Command{
+	Use:   "export <name>",
+	Short: "Export the session to stdout",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		s := loadStoredSession(args[0])
+		switch format {
+		case "json":
+			raw, err := json.MarshalIndent(s.Messages, "", "  ")
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Println(string(raw))
+		case "markdown":
+			fmt.Print(s.Markdown())
+		default:
+			fmt.Printf("unknown format: %s\n", format)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	sessionExportCmd.Flags().String("format", "json", "export format, one of json or markdown")
+
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionShowCmd)
+	sessionCmd.AddCommand(sessionRmCmd)
+	sessionCmd.AddCommand(sessionExportCmd)
+	RootCmd.AddCommand(sessionCmd)
+}
+
+// loadStoredSession loads the session of given name, exits if it is not stored
+func loadStoredSession(name string) *session.Session {
+	exists, err := session.Exists(name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !exists {
+		fmt.Printf("session not found: %s\n", name)
+		os.Exit(1)
+	}
+
+	s, err := session.Load(name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	return s
+}
+
+// resumeSession creates a chat app which continues the session given by flag.
+// the returned save function stores the conversation, it does nothing if session is not given.
+func resumeSession(client *chatgpt.Client, role string) (*chat.App, func() error, error) {
+	app := chat.New(client, role)
+
+	name := viper.GetString("default.session")
+	if name == "" {
+		return app, func() error { return nil }, nil
+	}
+
+	s, err := session.Load(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the role of the first invocation is kept
+	if len(s.Messages) > 0 {
+		app.Restore(s.Messages)
+	}
+
+	save := func() error {
+		s.Messages = app.Messages()
+		return s.Save()
+	}
+	return app, save, nil
+}
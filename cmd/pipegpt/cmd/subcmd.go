@@ -2,67 +2,130 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/HatsuneMiku3939/pipegpt/app/function"
-	"github.com/HatsuneMiku3939/pipegpt/app/generic"
+	"github.com/HatsuneMiku3939/pipegpt/app/structured"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
 	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
 	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/schema"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-// CreateSubcommand creates a subcommand
-func CreateSubcommand(name string, definition map[string]interface{}) error {
-	// detect subcommand definition type
-	definitionNames := []string{}
-	for k := range definition {
-		definitionNames = append(definitionNames, k)
-	}
+// exitTextAnswer is the exit status of function-call subcommand when the model answers in text instead of calling a function
+const exitTextAnswer = 2
 
-	// create subcommand
-	switch determineSubcommandType(definitionNames) {
-	case "generic":
-		return createGenericSubcommand(name, definition)
-	case "function-call":
-		return createFunctionCallCommand(name, definition)
+// definitions are definitions of created subcommands by name
+var definitions = map[string]*config.Subcommand{}
+
+// CreateSubcommand creates a subcommand from its definition
+func CreateSubcommand(definition *config.Subcommand) error {
+	definitions[definition.Name] = definition
+
+	switch definition.Type {
+	case config.TypeGeneric:
+		return createGenericSubcommand(definition.Name, definition)
+	case config.TypeFunctionCall:
+		return createFunctionCallCommand(definition.Name, definition)
+	case config.TypeOutputSchema:
+		return createOutputSchemaCommand(definition.Name, definition)
+	case config.TypeAgent:
+		return createAgentCommand(definition.Name, definition)
 	}
 
-	return fmt.Errorf("unknown subcommand definition: %v", definition)
+	return fmt.Errorf("unknown subcommand type: %s", definition.Type)
 }
 
-// determineSubcommandType determines subcommand type
-func determineSubcommandType(definitionNames []string) string {
-	// TODO: refactor this
-	switch {
-	case contains(definitionNames, "role") && contains(definitionNames, "prompt") && len(definitionNames) == 2:
-		return "generic"
-	case contains(definitionNames, "function-call") && contains(definitionNames, "role") && contains(definitionNames, "prompt") && len(definitionNames) == 3:
-		return "function-call"
+// createGenericSubcommand creates a generic subcommand
+func createGenericSubcommand(name string, definition *config.Subcommand) error {
+	// create subcommand
+	subcmd := &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Ask a question with predefined role and prompt for %s task", name),
+		Run: func(cmd *cobra.Command, args []string) {
+			prompt := viper.GetString(fmt.Sprintf("%s.prompt", name))
+			role := viper.GetString(fmt.Sprintf("%s.role", name))
+			input := in.New(os.Stdin).Consume(byte('\n'))
+
+			input, err := attachFiles(definition, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			vars, err := templateVars(cmd.Flags(), definition)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			role, prompt, input, err = renderPrompt(definition, role, prompt, input, args, vars)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			reduce, err := renderReducePrompt(name, args, vars)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			client, err := createClient(name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if err := runGeneric(client, name, role, prompt, reduce, input); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
 	}
 
-	return ""
-}
+	// add flags
+	subcmd.Flags().StringP("role", "r", "",
+		fmt.Sprintf("role for the AI assistant, you can also set it with PIPEGPT_%s_ROLE environment variable or config file", strings.ToUpper(name)),
+	)
+	subcmd.Flags().StringP("prompt", "p", "",
+		fmt.Sprintf("prompt for the AI assistant, you can also set it with PIPEGPT_%s_PROMPT environment variable or config file", strings.ToUpper(name)),
+	)
 
-// contains checks if a string slice contains a string
-func contains(s []string, e string) bool {
-	for _, v := range s {
-		if v == e {
-			return true
-		}
+	if err := addVarFlags(subcmd, definition); err != nil {
+		return err
 	}
 
-	return false
+	// bind flags to viper
+	if err := viper.BindPFlag(fmt.Sprintf("%s.role", name), subcmd.Flags().Lookup("role")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag(fmt.Sprintf("%s.prompt", name), subcmd.Flags().Lookup("prompt")); err != nil {
+		return err
+	}
+
+	// add to root command
+	RootCmd.AddCommand(subcmd)
+	return nil
 }
 
-// createGenericSubcommand creates a generic subcommand
-func createGenericSubcommand(name string, definition map[string]interface{}) error {
-	// this is not necessary for generic subcommand
-	_ = definition
+// createFunctionCallCommand creates a function call subcommand
+func createFunctionCallCommand(name string, definition *config.Subcommand) error {
+	// prepare function definitions from configuration
+	funcs, err := functionDefinitions(definition)
+	if err != nil {
+		return err
+	}
 
 	// create subcommand
 	subcmd := &cobra.Command{
@@ -73,20 +136,118 @@ func createGenericSubcommand(name string, definition map[string]interface{}) err
 			role := viper.GetString(fmt.Sprintf("%s.role", name))
 			input := in.New(os.Stdin).Consume(byte('\n'))
 
-			client, err := createClient()
+			input, err := attachFiles(definition, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			vars, err := templateVars(cmd.Flags(), definition)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			role, prompt, input, err = renderPrompt(definition, role, prompt, input, args, vars)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
-			result, err := generic.New(client).Run(role, prompt, input)
+			client, err := createClient(name)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
-			// print result with markdown formatter
-			out.New(os.Stdout, out.MarkdownFormatter).Emit(result)
+			inputs, err := fitInput(client, name, role, prompt, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			envelope, _ := cmd.Flags().GetBool("envelope")
+			envelope = envelope || definition.Envelope
+			array, _ := cmd.Flags().GetBool("array")
+			array = array || arrayOutput(definition)
+
+			format, err := outputFormat(name, out.FormatRaw)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			output := out.NewFormat(os.Stdout, format)
+
+			if err := checkTextOnlyFlags(definition.Type); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			mode, err := runMode(cmd, definition)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			var run *commandRunner
+			if mode != config.RunNever {
+				if run, err = newCommandRunner(mode, definition); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+				defer run.Close()
+			}
+
+			// if input is chunked, arguments of each chunk are printed in a line
+			for _, input := range inputs {
+				result, answer, err := function.New(client).Run(role, prompt, input, funcs, definition.FunctionCallMode)
+
+				// a text answer is printed if function call is disabled, otherwise it is told apart from errors by exit status
+				var text *chatgpt.TextAnswerError
+				if errors.As(err, &text) {
+					if definition.FunctionCallMode == chatgpt.FunctionCallNone {
+						if err := emitAnswer(output, format, answer); err != nil {
+							fmt.Println(err)
+							os.Exit(1)
+						}
+						if !out.IsEnvelope(format) {
+							fmt.Println()
+						}
+						continue
+					}
+					fmt.Fprintln(os.Stderr, text.Content)
+					fmt.Println(err)
+					printUsage()
+					os.Exit(exitTextAnswer)
+				}
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				// commands are executed in order instead of printed, and the first failure stops the rest
+				if run != nil {
+					for _, called := range result {
+						status, err := run.Run(called)
+						if err != nil {
+							fmt.Println(err)
+							run.Close()
+							os.Exit(1)
+						}
+						if status != 0 {
+							run.Close()
+							printUsage()
+							os.Exit(status)
+						}
+					}
+					continue
+				}
+
+				if err := emitResult(output, format, functionOutput(result, envelope, array), answer); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
 		},
 	}
 
@@ -98,6 +259,14 @@ func createGenericSubcommand(name string, definition map[string]interface{}) err
 		fmt.Sprintf("prompt for the AI assistant, you can also set it with PIPEGPT_%s_PROMPT environment variable or config file", strings.ToUpper(name)),
 	)
 
+	subcmd.Flags().Bool("envelope", false, `print {"name": ..., "arguments": ...} with the name of called function, you can also set it with envelope of config file`)
+	subcmd.Flags().Bool("array", false, "print function calls as a JSON array even if a function is called, it is always on with tools of config file, you can also set it with array of config file")
+	subcmd.Flags().String("run", config.RunNever, "execute the command of the result, one of never, confirm or auto, you can also set it with run of config file")
+
+	if err := addVarFlags(subcmd, definition); err != nil {
+		return err
+	}
+
 	// bind flags to viper
 	if err := viper.BindPFlag(fmt.Sprintf("%s.role", name), subcmd.Flags().Lookup("role")); err != nil {
 		return err
@@ -111,48 +280,78 @@ func createGenericSubcommand(name string, definition map[string]interface{}) err
 	return nil
 }
 
-// createFunctionCallCommand creates a function call subcommand
-func createFunctionCallCommand(name string, definition map[string]interface{}) error {
-	// prepare function definitions from configuration
-	var funcs []openai.FunctionDefinition = make([]openai.FunctionDefinition, 0)
-
-	for _, definition := range definition["function-call"].([]interface{}) {
-		schema, err := function.ToFunctionSchema(definition)
-		if err != nil {
-			return err
-		}
-
-		funcs = append(funcs, schema)
+// createOutputSchemaCommand creates a subcommand which answers in JSON of the output schema
+func createOutputSchemaCommand(name string, definition *config.Subcommand) error {
+	// prepare response format from configuration
+	response, err := responseFormat(definition)
+	if err != nil {
+		return err
 	}
 
 	// create subcommand
 	subcmd := &cobra.Command{
 		Use:   name,
-		Short: fmt.Sprintf("Ask a question with predefined role and prompt for %s task", name),
+		Short: fmt.Sprintf("Ask a question with predefined role and prompt for %s task, and answer in JSON", name),
 		Run: func(cmd *cobra.Command, args []string) {
 			prompt := viper.GetString(fmt.Sprintf("%s.prompt", name))
 			role := viper.GetString(fmt.Sprintf("%s.role", name))
 			input := in.New(os.Stdin).Consume(byte('\n'))
 
-			client, err := createClient()
+			input, err := attachFiles(definition, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			vars, err := templateVars(cmd.Flags(), definition)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
-			result, err := function.New(client).Run(role, prompt, input, funcs)
+			role, prompt, input, err = renderPrompt(definition, role, prompt, input, args, vars)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
-			raw, err := json.Marshal(result)
+			client, err := createClient(name)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
-			fmt.Println(string(raw))
+			inputs, err := fitInput(client, name, role, prompt, input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			format, err := outputFormat(name, out.FormatRaw)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			output := out.NewFormat(os.Stdout, format)
+
+			if err := checkTextOnlyFlags(definition.Type); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// if input is chunked, the answer of each chunk is printed in a line
+			for _, input := range inputs {
+				result, answer, err := structured.New(client).Run(role, prompt, input, response)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				if err := emitResult(output, format, result, answer); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
 		},
 	}
 
@@ -164,6 +363,10 @@ func createFunctionCallCommand(name string, definition map[string]interface{}) e
 		fmt.Sprintf("prompt for the AI assistant, you can also set it with PIPEGPT_%s_PROMPT environment variable or config file", strings.ToUpper(name)),
 	)
 
+	if err := addVarFlags(subcmd, definition); err != nil {
+		return err
+	}
+
 	// bind flags to viper
 	if err := viper.BindPFlag(fmt.Sprintf("%s.role", name), subcmd.Flags().Lookup("role")); err != nil {
 		return err
@@ -176,3 +379,132 @@ func createFunctionCallCommand(name string, definition map[string]interface{}) e
 	RootCmd.AddCommand(subcmd)
 	return nil
 }
+
+// responseFormat converts output schema of the subcommand into the format of structured output,
+// the answer is any JSON object if the subcommand has no schema
+func responseFormat(definition *config.Subcommand) (*chatgpt.OutputFormat, error) {
+	format := &chatgpt.OutputFormat{Name: definition.Name}
+	if definition.OutputSchema == nil {
+		return format, nil
+	}
+
+	format.Strict = definition.OutputSchema.Strict
+	if definition.OutputSchema.Name != "" {
+		format.Name = definition.OutputSchema.Name
+	}
+
+	// config loader lowercases keys, so the schema is read as it is written in config file,
+	// to keep camelCase of property names and keywords such as additionalProperties
+	if definition.OutputSchema.Schema != nil {
+		var params interface{} = definition.OutputSchema.Schema
+		if raw, ok := rawSetting(definition.Name, "output-schema", "schema"); ok {
+			params = raw
+		}
+
+		def, err := schema.FromParameters(params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output schema of %s: %w", definition.Name, err)
+		}
+
+		raw, err := json.Marshal(&def)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output schema of %s: %w", definition.Name, err)
+		}
+		format.Schema = raw
+	}
+
+	return format, nil
+}
+
+// rawSetting is function to read the setting of keys from config file as it is written, without lowercasing keys.
+// keys are matched case-insensitively as viper does, and false is returned if the setting is not found in the file,
+// or the file is neither YAML nor JSON, which is a subset of YAML.
+func rawSetting(keys ...string) (interface{}, bool) {
+	path := viper.ConfigFileUsed()
+	switch filepath.Ext(path) {
+	case "", ".yaml", ".yml", ".json":
+	default:
+		return nil, false
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal(raw, &value); err != nil {
+		return nil, false
+	}
+
+	for _, key := range keys {
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		found := false
+		for k, v := range settings {
+			if strings.EqualFold(k, key) {
+				value, found = v, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// arrayOutput is function to check whether function calls of the subcommand are always output as an array.
+// it is on for tools, so that the shape of output does not depend on how many functions the model calls at once.
+func arrayOutput(definition *config.Subcommand) bool {
+	return definition.Array || len(definition.Tools) > 0
+}
+
+// functionOutput is function to make output of function calls, the arguments or the envelope of the name and the arguments.
+// calls are output as an array if array is true or the model calls several functions in one answer, otherwise a single call is output as is.
+func functionOutput(results []*chatgpt.FunctionCallResult, envelope bool, array bool) interface{} {
+	outputs := make([]interface{}, 0, len(results))
+	for _, result := range results {
+		if envelope {
+			outputs = append(outputs, result)
+		} else {
+			outputs = append(outputs, result.Arguments)
+		}
+	}
+
+	if len(outputs) == 1 && !array {
+		return outputs[0]
+	}
+
+	return outputs
+}
+
+// functionDefinitions converts function definitions of the subcommand into JSONSchema for function call
+func functionDefinitions(definition *config.Subcommand) ([]openai.FunctionDefinition, error) {
+	var funcs []openai.FunctionDefinition = make([]openai.FunctionDefinition, 0)
+
+	for _, definition := range definition.FunctionCall {
+		schema, err := function.ToFunctionSchema(definition)
+		if err != nil {
+			return nil, err
+		}
+
+		funcs = append(funcs, schema)
+	}
+
+	// tools have the function definition under function key
+	for _, tool := range definition.Tools {
+		schema, err := function.ToFunctionSchema(tool["function"])
+		if err != nil {
+			return nil, err
+		}
+
+		funcs = append(funcs, schema)
+	}
+
+	return funcs, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+
+	"github.com/spf13/viper"
+)
+
+// readConfig reads the config file of given content into viper, and returns the definition of the subcommand
+func readConfig(t *testing.T, file string, content string, name string) *config.Subcommand {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), file)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	t.Cleanup(viper.Reset)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig() returned error: %s", err)
+	}
+
+	definitions, err := config.Subcommands(viper.AllSettings())
+	if err != nil {
+		t.Fatalf("Subcommands() returned error: %s", err)
+	}
+	for _, definition := range definitions {
+		if definition.Name == name {
+			return definition
+		}
+	}
+	t.Fatalf("subcommand %s is not defined", name)
+	return nil
+}
+
+func TestResponseFormat(t *testing.T) {
+	want := map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			"firstName": map[string]interface{}{"type": "string"},
+		},
+		"required": []interface{}{"firstName"},
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "YAML",
+			file: "pipegpt.yaml",
+			content: `
+Person:
+  role: data engineer
+  prompt: extract the person
+  output-schema:
+    strict: true
+    schema:
+      type: object
+      additionalProperties: false
+      properties:
+        firstName:
+          type: string
+      required:
+        - firstName
+`,
+		},
+		{
+			name:    "JSON",
+			file:    "pipegpt.json",
+			content: `{"person": {"role": "data engineer", "prompt": "extract the person", "output-schema": {"strict": true, "schema": {"type": "object", "additionalProperties": false, "properties": {"firstName": {"type": "string"}}, "required": ["firstName"]}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := responseFormat(readConfig(t, tt.file, tt.content, "person"))
+			if err != nil {
+				t.Fatalf("responseFormat() returned error: %s", err)
+			}
+
+			var got interface{}
+			if err := json.Unmarshal(format.Schema, &got); err != nil {
+				t.Fatalf("schema is not JSON: %s", err)
+			}
+			if format.Name != "person" || !format.Strict || !reflect.DeepEqual(got, want) {
+				t.Errorf("responseFormat() = %s %v %s, want strict person of camelCase schema", format.Name, format.Strict, format.Schema)
+			}
+		})
+	}
+}
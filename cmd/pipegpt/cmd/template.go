@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/prompt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// initTemplateFlags is function to initialize template flags of RootCmd
+func initTemplateFlags() {
+	RootCmd.PersistentFlags().StringArray("var", nil, "template variable given as key=value, available as {{.Vars.key}} in role and prompt")
+	RootCmd.PersistentFlags().Bool("template", false, "render role and prompt as templates, it is implied by --var")
+}
+
+// addVarFlags is function to add flags of template variables declared by subcommand
+func addVarFlags(subcmd *cobra.Command, definition *config.Subcommand) error {
+	for _, v := range definition.Vars {
+		if subcmd.Flags().Lookup(v.Name) != nil || RootCmd.PersistentFlags().Lookup(v.Name) != nil {
+			return fmt.Errorf("var '%s' of subcommand '%s' conflicts with existing flag", v.Name, definition.Name)
+		}
+
+		usage := v.Description
+		if usage == "" {
+			usage = fmt.Sprintf("template variable, available as {{.Vars.%s}} in role and prompt", v.Name)
+		}
+		if v.Required {
+			usage += " (required)"
+		}
+
+		subcmd.Flags().String(v.Name, v.Default, usage)
+	}
+
+	return nil
+}
+
+// templateVars is function to collect template variables in precedence order of flags of subcommand, --var flag and defaults.
+// flags and definition may be nil if they are not available.
+func templateVars(flags *pflag.FlagSet, definition *config.Subcommand) (map[string]string, error) {
+	vars := map[string]string{}
+
+	// defaults of declared variables
+	if definition != nil {
+		for _, v := range definition.Vars {
+			if v.Default != "" {
+				vars[v.Name] = v.Default
+			}
+		}
+	}
+
+	// variables given as key=value
+	raw, err := rootFlags.GetStringArray("var")
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range raw {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("--var must be a key-value pair separated by '=': %s", kv)
+		}
+		vars[k] = v
+	}
+
+	if definition == nil {
+		return vars, nil
+	}
+
+	// flags of declared variables
+	for _, v := range definition.Vars {
+		if flags != nil {
+			if flag := flags.Lookup(v.Name); flag != nil && flag.Changed {
+				vars[v.Name] = flag.Value.String()
+			}
+		}
+
+		if _, ok := vars[v.Name]; !ok && v.Required {
+			return nil, fmt.Errorf("--%s is required for %s", v.Name, definition.Name)
+		}
+	}
+
+	return vars, nil
+}
+
+// templated is function to check whether role and prompt are rendered as templates.
+// they are rendered only if the subcommand enables template or declares vars, or --template or --var flag is given,
+// so that a prompt which happens to contain '{{' is sent as it is. definition is nil for root command.
+func templated(definition *config.Subcommand) bool {
+	if definition != nil && (definition.Template || len(definition.Vars) > 0) {
+		return true
+	}
+
+	if enabled, _ := rootFlags.GetBool("template"); enabled {
+		return true
+	}
+	raw, _ := rootFlags.GetStringArray("var")
+	return len(raw) > 0
+}
+
+// renderPrompt is function to render role and prompt templates with input, arguments and variables.
+// it returns rendered role and prompt, and input which is not placed by the templates.
+// role and prompt are returned as they are unless they are templated by the definition or flags.
+func renderPrompt(definition *config.Subcommand, role string, text string, input string, args []string, vars map[string]string) (string, string, string, error) {
+	if !templated(definition) {
+		return role, text, input, nil
+	}
+
+	data := prompt.NewData(input, args, vars)
+
+	role, err := prompt.Render("role", role, data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	text, err = prompt.Render("prompt", text, data)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// input placed by the templates is not given again
+	if data.InputPlaced() {
+		input = ""
+	}
+
+	return role, text, input, nil
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+
+	"github.com/spf13/pflag"
+)
+
+// subcommandVars creates the subcommand of the definition, parses args as its command line,
+// and returns template variables and positional arguments as the subcommand takes them
+func subcommandVars(t *testing.T, definition *config.Subcommand, args ...string) (map[string]string, []string, error) {
+	t.Helper()
+
+	if err := CreateSubcommand(definition); err != nil {
+		t.Fatalf("CreateSubcommand() returned error: %s", err)
+	}
+	subcmd, rest, err := RootCmd.Find(append([]string{definition.Name}, args...))
+	if err != nil {
+		t.Fatalf("Find() returned error: %s", err)
+	}
+	t.Cleanup(func() {
+		RootCmd.RemoveCommand(subcmd)
+		resetVarFlag()
+	})
+
+	if err := subcmd.ParseFlags(rest); err != nil {
+		t.Fatalf("ParseFlags() returned error: %s", err)
+	}
+
+	vars, err := templateVars(subcmd.Flags(), definition)
+	return vars, subcmd.Flags().Args(), err
+}
+
+// resetVarFlag clears --var flag of RootCmd, which is shared by tests
+func resetVarFlag() {
+	flag := rootFlags.Lookup("var")
+	_ = flag.Value.(pflag.SliceValue).Replace([]string{})
+	flag.Changed = false
+}
+
+// translate is the definition of subcommand which declares a variable of target language
+func translate(required bool) *config.Subcommand {
+	return &config.Subcommand{
+		Name:   "translate",
+		Type:   config.TypeGeneric,
+		Role:   "You are a translator into {{.Vars.to}}.",
+		Prompt: "Translate the text into {{.Vars.to}}.",
+		Vars:   []config.Var{{Name: "to", Default: "en", Required: required}},
+	}
+}
+
+func TestSubcommandVars(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		args     []string
+		role     string
+		prompt   string
+		err      string
+	}{
+		{
+			name:   "flag of var",
+			args:   []string{"--to", "ja"},
+			role:   "You are a translator into ja.",
+			prompt: "Translate the text into ja.",
+		},
+		{
+			name:   "default of var",
+			role:   "You are a translator into en.",
+			prompt: "Translate the text into en.",
+		},
+		{
+			name:   "--var flag",
+			args:   []string{"--var", "to=fr"},
+			prompt: "Translate the text into fr.",
+		},
+		{
+			name:   "flag of var over --var flag",
+			args:   []string{"--var", "to=fr", "--to=ja"},
+			prompt: "Translate the text into ja.",
+		},
+		{
+			name:     "missing required var",
+			required: true,
+			err:      "--to is required for translate",
+		},
+		{
+			name: "invalid --var flag",
+			args: []string{"--var", "to"},
+			err:  "--var must be a key-value pair separated by '=': to",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := translate(tt.required)
+			if tt.required {
+				definition.Vars[0].Default = ""
+			}
+
+			vars, args, err := subcommandVars(t, definition, tt.args...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("templateVars() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("templateVars() returned error: %s", err)
+			}
+
+			role, prompt, input, err := renderPrompt(definition, definition.Role, definition.Prompt, "hello", args, vars)
+			if err != nil {
+				t.Fatalf("renderPrompt() returned error: %s", err)
+			}
+			if tt.role != "" && role != tt.role {
+				t.Errorf("role = %q, want %q", role, tt.role)
+			}
+			if prompt != tt.prompt {
+				t.Errorf("prompt = %q, want %q", prompt, tt.prompt)
+			}
+			if input != "hello" {
+				t.Errorf("input = %q, want it appended as it is not placed", input)
+			}
+		})
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	t.Run("input placed by prompt", func(t *testing.T) {
+		definition := &config.Subcommand{Name: "placed", Type: config.TypeGeneric, Role: "role", Prompt: "Translate: {{.Input}} ({{index .Args 0}})", Template: true}
+		vars, args, err := subcommandVars(t, definition, "formal")
+		if err != nil {
+			t.Fatalf("templateVars() returned error: %s", err)
+		}
+
+		_, prompt, input, err := renderPrompt(definition, definition.Role, definition.Prompt, "hello", args, vars)
+		if err != nil || prompt != "Translate: hello (formal)" || input != "" {
+			t.Errorf("renderPrompt() = %q, %q, %v, want input placed in prompt", prompt, input, err)
+		}
+	})
+
+	t.Run("not templated", func(t *testing.T) {
+		definition := &config.Subcommand{Name: "literal", Type: config.TypeGeneric, Role: "role", Prompt: "Explain {{ in Go templates."}
+		vars, args, err := subcommandVars(t, definition)
+		if err != nil {
+			t.Fatalf("templateVars() returned error: %s", err)
+		}
+
+		_, prompt, input, err := renderPrompt(definition, definition.Role, definition.Prompt, "hello", args, vars)
+		if err != nil || prompt != "Explain {{ in Go templates." || input != "hello" {
+			t.Errorf("renderPrompt() = %q, %q, %v, want prompt as it is", prompt, input, err)
+		}
+	})
+
+	t.Run("undeclared var", func(t *testing.T) {
+		definition := &config.Subcommand{Name: "undeclared", Type: config.TypeGeneric, Role: "role", Prompt: "Translate into {{.Vars.lang}}.", Template: true}
+		vars, args, err := subcommandVars(t, definition)
+		if err != nil {
+			t.Fatalf("templateVars() returned error: %s", err)
+		}
+
+		if _, _, _, err := renderPrompt(definition, definition.Role, definition.Prompt, "hello", args, vars); err == nil {
+			t.Errorf("renderPrompt() of undeclared var returned no error")
+		}
+	})
+}
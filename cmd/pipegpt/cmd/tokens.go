@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chatgpt"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/chunk"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/in"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/token"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens [subcommand]",
+	Short: "Count prompt tokens of stdin and prompt without calling the API",
+	Long: `Count prompt tokens of stdin and prompt without calling the API.
+
+If subcommand is given, its role, prompt, files and model are used unless overridden by flags.
+The count includes the role, the prompt and the input, as they are sent to the API.
+
+Example:
+# check whether the staged changes fit in the context window of review subcommand
+git diff --staged | pipegpt tokens review -v
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		role, prompt, err := chatRoleAndPrompt(cmd, args)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// consume input only if it is piped, otherwise there is no input
+		input := ""
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			input = in.New(os.Stdin).Consume(byte('\n'))
+		}
+
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+
+		input, err = attachFiles(definitions[name], input)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		vars, err := templateVars(nil, definitions[name])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		role, prompt, input, err = renderPrompt(definitions[name], role, prompt, input, nil, vars)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		client, err := createClient(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		count, err := token.CountMessages(client.Model(), role, chatgpt.UserMessage(prompt, input))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		if !verbose {
+			fmt.Println(count)
+			return
+		}
+
+		limit, err := inputLimit(client, name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		enc, err := token.ForModel(client.Model())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("model:    %s (%s)\n", client.Model(), enc.Name)
+		fmt.Printf("role:     %d\n", enc.Count(role))
+		fmt.Printf("prompt:   %d\n", enc.Count(prompt))
+		fmt.Printf("input:    %d\n", enc.Count(input))
+		fmt.Printf("total:    %d\n", count)
+		if limit > 0 {
+			fmt.Printf("limit:    %d\n", limit)
+		} else {
+			fmt.Println("limit:    unknown")
+		}
+	},
+}
+
+func init() {
+	tokensCmd.Flags().StringP("role", "r", "", "role of the AI assistant, default is the role of subcommand or default role")
+	tokensCmd.Flags().StringP("prompt", "p", "", "prompt to count, default is the prompt of subcommand")
+	tokensCmd.Flags().BoolP("verbose", "v", false, "print the count of each part and the token budget")
+
+	RootCmd.AddCommand(tokensCmd)
+}
+
+// initTokenFlags is function to initialize flags of token budget of RootCmd
+func initTokenFlags() {
+	RootCmd.PersistentFlags().Int("max-input-tokens", 0, "maximum number of prompt tokens, default is the context window of the model minus max-tokens, you can also set it in subcommand or default of config file")
+	RootCmd.PersistentFlags().String("overflow", token.OverflowError,
+		fmt.Sprintf("strategy when input exceeds max-input-tokens, one of %s, you can also set it in subcommand or default of config file", strings.Join(token.Overflows, ", ")),
+	)
+}
+
+// inputLimit is function to resolve the token budget of prompt for given subcommand, 0 means unlimited.
+// max_input_tokens takes precedence, otherwise the context window of the model minus max_tokens is used.
+func inputLimit(client *chatgpt.Client, name string) (int, error) {
+	limit, err := intParameter(name, "max_input_tokens", 1)
+	if err != nil {
+		return 0, err
+	}
+	if limit != nil {
+		return *limit, nil
+	}
+
+	window := token.ContextWindow(client.Model())
+	if window == 0 {
+		return 0, nil
+	}
+
+	if maxTokens := client.Parameters().MaxTokens; maxTokens != nil {
+		window -= *maxTokens
+	}
+
+	return window, nil
+}
+
+// overflowStrategy is function to resolve the overflow strategy for given subcommand
+func overflowStrategy(name string) (string, error) {
+	raw, key, ok := lookupParameter(name, "overflow")
+	if !ok {
+		return token.OverflowError, nil
+	}
+
+	for _, strategy := range token.Overflows {
+		if raw == strategy {
+			return raw, nil
+		}
+	}
+
+	return "", fmt.Errorf("'%s' must be one of %s: %s", key, strings.Join(token.Overflows, ", "), raw)
+}
+
+// fitInput is function to fit input into the token budget of given subcommand by its overflow strategy.
+// it returns the inputs to ask with, which are more than one only if input is chunked.
+// if chunk mode is given, input is chunked by the mode, and always split by chunk size if it is given.
+func fitInput(client *chatgpt.Client, name string, role string, prompt string, input string) ([]string, error) {
+	strategy, err := overflowStrategy(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := chunkMode(name)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		strategy = token.OverflowChunk
+	} else {
+		mode = chunk.ByLines
+	}
+
+	size, err := intParameter(name, "chunk_size", 1)
+	if err != nil {
+		return nil, err
+	}
+	if strategy != token.OverflowChunk {
+		size = nil
+	}
+
+	limit, err := inputLimit(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// input is not tokenized if it is neither limited nor chunked by size
+	if limit == 0 && size == nil {
+		return []string{input}, nil
+	}
+
+	model := client.Model()
+	total := 0
+	if size == nil {
+		if total, err = token.CountMessages(model, role, chatgpt.UserMessage(prompt, input)); err != nil {
+			return nil, err
+		}
+		if total <= limit {
+			return []string{input}, nil
+		}
+	}
+
+	// the budget of input is what remains after role, prompt and the separator between prompt and input
+	budget := 0
+	if limit > 0 {
+		overhead, err := token.CountMessages(model, role, chatgpt.UserMessage(prompt, "-"))
+		if err != nil {
+			return nil, err
+		}
+		budget = limit - overhead
+		if budget <= 0 {
+			return nil, fmt.Errorf("role and prompt use %d tokens, which exceed the limit of %d tokens", overhead, limit)
+		}
+	}
+	if size != nil && (budget == 0 || *size < budget) {
+		budget = *size
+	}
+
+	switch strategy {
+	case token.OverflowChunk:
+		enc, err := token.ForModel(model)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := chunk.Split(enc, input, mode, budget)
+		if err != nil || len(chunks) > 0 {
+			return chunks, err
+		}
+		return []string{input}, nil
+	case token.OverflowTruncateHead, token.OverflowTruncateTail, token.OverflowTruncateMiddle:
+		truncated, err := token.Truncate(model, input, budget, strategy)
+		if err != nil {
+			return nil, err
+		}
+		return []string{truncated}, nil
+	default:
+		return nil, fmt.Errorf("prompt has %d tokens, which exceeds the limit of %d tokens for %s, "+
+			"reduce the input or use --overflow to truncate or chunk it", total, limit, model)
+	}
+}
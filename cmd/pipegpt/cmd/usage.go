@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/usage"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report token usage and estimated cost of requests",
+	Long: `Report token usage and estimated cost of requests.
+
+Usage of each request sent to the model is appended to $XDG_STATE_HOME/pipegpt/usage.jsonl
+(default is $HOME/.local/state/pipegpt/usage.jsonl). Answers from cache are not recorded.
+Cost is estimated by the price table of well-known models, which can be overridden by 'prices' of config file.
+`,
+}
+
+var usageReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Show token usage and estimated cost of requests grouped by subcommand, model, provider or day",
+	Long: `Show token usage and estimated cost of requests grouped by subcommand, model, provider or day.
+
+Example:
+# spend of each subcommand in the last week
+pipegpt usage report --since 7d --by subcommand
+
+# spend of each model since the first day of the month
+pipegpt usage report --since 2024-06-01 --by model
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		since, _ := cmd.Flags().GetString("since")
+		by, _ := cmd.Flags().GetString("by")
+
+		start, err := usage.ParseSince(since, time.Now())
+		if err != nil {
+			fmt.Printf("'--since' %s\n", err)
+			os.Exit(1)
+		}
+
+		path, err := usage.LedgerPath()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		entries, err := usage.Read(path, start)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		summaries, err := usage.Summarize(entries, by)
+		if err != nil {
+			fmt.Printf("'--by' %s\n", err)
+			os.Exit(1)
+		}
+
+		if err := printUsageReport(strings.ToUpper(by), summaries); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	usageReportCmd.Flags().String("since", "30d", "start of the report, days such as 7d, a duration such as 12h or a date such as 2006-01-02")
+	usageReportCmd.Flags().String("by", usage.BySubcommand, fmt.Sprintf("group of the report, one of %s", strings.Join(usage.Groups, ", ")))
+	usageCmd.AddCommand(usageReportCmd)
+	RootCmd.AddCommand(usageCmd)
+}
+
+// initUsageFlags is function to initialize flags of usage reporting of RootCmd
+func initUsageFlags() {
+	RootCmd.PersistentFlags().Bool("usage", false, "print token usage and estimated cost of requests to stderr")
+	RootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		printUsage()
+	}
+}
+
+// printUsageReport is function to print summaries in a table with the total of them
+func printUsageReport(key string, summaries []*usage.Summary) error {
+	total := &usage.Summary{Key: "TOTAL"}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCALLS\tPROMPT\tCOMPLETION\tTOTAL\tCOST (USD)\n", key)
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", s.Key, s.Calls, s.PromptTokens, s.CompletionTokens, s.TotalTokens, formatCost(s))
+
+		total.Calls += s.Calls
+		total.PromptTokens += s.PromptTokens
+		total.CompletionTokens += s.CompletionTokens
+		total.TotalTokens += s.TotalTokens
+		total.Cost += s.Cost
+		total.Unpriced += s.Unpriced
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", total.Key, total.Calls, total.PromptTokens, total.CompletionTokens, total.TotalTokens, formatCost(total))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if total.Unpriced > 0 {
+		fmt.Printf("* %d calls of models without price are not included in cost, set their prices in 'prices' of config file\n", total.Unpriced)
+	}
+
+	return nil
+}
+
+// formatCost is function to format cost of the summary, it is marked if some calls are not included
+func formatCost(s *usage.Summary) string {
+	switch {
+	case s.Unpriced == s.Calls && s.Calls > 0:
+		return "-"
+	case s.Unpriced > 0:
+		return fmt.Sprintf("%.4f*", s.Cost)
+	default:
+		return fmt.Sprintf("%.4f", s.Cost)
+	}
+}
+
+// resolvePrices is function to resolve the price table, prices in config file take precedence over the default
+func resolvePrices() (usage.Prices, error) {
+	prices, err := config.Prices(viper.Get("prices"))
+	if err != nil {
+		return nil, err
+	}
+
+	configured := usage.Prices{}
+	for model, price := range prices {
+		configured[model] = usage.Price{Prompt: price.Prompt, Completion: price.Completion}
+	}
+
+	return usage.DefaultPrices.Merge(configured), nil
+}
+
+// tracker sums up usage of requests sent by the command, and appends each of them to the ledger
+type tracker struct {
+	mu sync.Mutex
+
+	subcommand string
+	provider   string
+	prices     usage.Prices
+	// ledger is the path of ledger file, empty means usage is not recorded
+	ledger string
+
+	summary usage.Summary
+	models  []string
+}
+
+// usageTracker tracks usage of clients created by the command, nil until a client is created
+var usageTracker *tracker
+
+// trackUsage is function to get the tracker of usage for clients of given subcommand and provider
+func trackUsage(name string, provider string) (*tracker, error) {
+	if usageTracker != nil {
+		return usageTracker, nil
+	}
+
+	prices, err := resolvePrices()
+	if err != nil {
+		return nil, err
+	}
+
+	// the ledger is best effort, the question is asked even if its path is unknown
+	ledger, _ := usage.LedgerPath()
+
+	usageTracker = &tracker{subcommand: name, provider: provider, prices: prices, ledger: ledger}
+	return usageTracker, nil
+}
+
+// record adds usage of a request to the summary and the ledger, failure of the ledger is reported but doesn't fail the command
+func (t *tracker) record(model string, u openai.Usage) {
+	entry := &usage.Entry{
+		Time:             time.Now(),
+		Subcommand:       t.subcommand,
+		Provider:         t.provider,
+		Model:            model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		Cost:             t.prices.Cost(model, u.PromptTokens, u.CompletionTokens),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.summary.Add(entry)
+	if !contains(t.models, model) {
+		t.models = append(t.models, model)
+	}
+
+	if t.ledger == "" {
+		return
+	}
+	if err := usage.Append(t.ledger, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record usage: %s\n", err)
+	}
+}
+
+// printUsage is function to print usage of requests sent by the command to stderr if it is requested by --usage flag
+func printUsage() {
+	if enabled, _ := rootFlags.GetBool("usage"); !enabled || usageTracker == nil {
+		return
+	}
+
+	t := usageTracker
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.summary
+	if s.Calls == 0 {
+		fmt.Fprintln(os.Stderr, "usage: no request is sent, the answer is taken from cache")
+		return
+	}
+
+	cost := "unknown cost"
+	switch {
+	case s.Unpriced == 0:
+		cost = fmt.Sprintf("$%.6f", s.Cost)
+	case s.Unpriced < s.Calls:
+		cost = fmt.Sprintf("$%.6f and unknown cost of %d requests", s.Cost, s.Unpriced)
+	}
+
+	requests := "requests"
+	if s.Calls == 1 {
+		requests = "request"
+	}
+	fmt.Fprintf(os.Stderr, "usage: %d %s to %s, %d prompt + %d completion = %d tokens, %s\n",
+		s.Calls, requests, strings.Join(t.models, ", "), s.PromptTokens, s.CompletionTokens, s.TotalTokens, cost,
+	)
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/out"
+)
+
+// patchLangs are languages of code blocks which are taken as the patch of the answer
+var patchLangs = []string{"diff", "patch"}
+
+// initWriteFlags is function to initialize flags of writing the answer into files of RootCmd
+func initWriteFlags() {
+	RootCmd.PersistentFlags().String("write", "", "write the answer into the file after its diff is confirmed, instead of printing it")
+	RootCmd.PersistentFlags().Bool("apply-patch", false, "apply the unified diff of the answer to the working tree after it is checked and confirmed, instead of printing it")
+	RootCmd.PersistentFlags().BoolP("yes", "y", false, "skip confirmation of executing tools, writing the file and applying the patch")
+}
+
+// edit is the change of files made by the answer instead of printing it
+type edit struct {
+	// path is the file to write the answer into, empty means the answer is applied as a patch
+	path string
+	// yes skips confirmation
+	yes bool
+}
+
+// resolveEdit is function to resolve the change of files from flags, nil means the answer is printed
+func resolveEdit(format string) (*edit, error) {
+	path, _ := rootFlags.GetString("write")
+	patch, _ := rootFlags.GetBool("apply-patch")
+	yes, _ := rootFlags.GetBool("yes")
+
+	switch {
+	case path == "" && !patch:
+		return nil, nil
+	case path != "" && patch:
+		return nil, fmt.Errorf("'--write' and '--apply-patch' can't be used together")
+	case out.IsEnvelope(format):
+		return nil, fmt.Errorf("%s output is not available with '--write' and '--apply-patch'", format)
+	}
+
+	return &edit{path: path, yes: yes}, nil
+}
+
+// apply writes the answer into the file or applies it as a patch
+func (e *edit) apply(answer string, extracted bool) error {
+	if e.path != "" {
+		return writeFile(e.path, answer, e.yes)
+	}
+
+	// a patch in diff code block is taken unless code blocks are extracted explicitly
+	patch := answer
+	if !extracted {
+		for _, lang := range patchLangs {
+			if code, err := out.ExtractCode(answer, lang, 0); err == nil {
+				patch = code
+				break
+			}
+		}
+	}
+
+	return applyPatch(patch, e.yes)
+}
+
+// writeFile is function to write the content into the file after the diff is confirmed.
+// the mode of existing file is kept, and the file is not touched if the content is the same.
+func writeFile(path string, content string, yes bool) error {
+	mode := fs.FileMode(0o644)
+	current, oldName := "", "/dev/null"
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if info.IsDir() {
+			return fmt.Errorf("can't write the answer into %s: it is a directory", path)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		current, mode, oldName = string(raw), info.Mode().Perm(), path
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	diff := out.Diff(oldName, path, current, content)
+	if diff == "" {
+		fmt.Fprintf(os.Stderr, "%s is unchanged\n", path)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, diff)
+
+	if !yes {
+		ok, err := confirmEdit(fmt.Sprintf("write the answer into %s?", path))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("writing %s is declined", path)
+		}
+	}
+
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+// applyPatch is function to apply the patch to the working tree by git apply, after a dry run and confirmation.
+// line counts of hunks are recounted, as models often miscount them.
+func applyPatch(patch string, yes bool) error {
+	if strings.TrimSpace(patch) == "" {
+		return fmt.Errorf("the answer has no patch to apply")
+	}
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	if output, err := gitApply(patch, "--check"); err != nil {
+		return fmt.Errorf("the patch can't be applied: %w\n%s", err, strings.TrimSpace(output))
+	}
+
+	stat, err := gitApply(patch, "--stat")
+	if err != nil {
+		return fmt.Errorf("the patch can't be applied: %w\n%s", err, strings.TrimSpace(stat))
+	}
+	fmt.Fprint(os.Stderr, patch)
+	fmt.Fprint(os.Stderr, stat)
+
+	if !yes {
+		ok, err := confirmEdit("apply the patch?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("applying the patch is declined")
+		}
+	}
+
+	if output, err := gitApply(patch); err != nil {
+		return fmt.Errorf("failed to apply the patch: %w\n%s", err, strings.TrimSpace(output))
+	}
+
+	return nil
+}
+
+// gitApply is function to run git apply with the patch in stdin, and returns its combined output
+func gitApply(patch string, args ...string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.Command("git", append([]string{"apply", "--recount"}, args...)...)
+	cmd.Stdin = strings.NewReader(patch)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	return output.String(), err
+}
+
+// confirmEdit is function to ask the user on the terminal whether to make the change, it is declined by default
+func confirmEdit(question string) (bool, error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("can't open terminal to confirm the change, use --yes to make it without confirmation: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("can't read confirmation: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
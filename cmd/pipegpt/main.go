@@ -5,13 +5,19 @@ import (
 	"os"
 
 	"github.com/HatsuneMiku3939/pipegpt/cmd/pipegpt/cmd"
+	"github.com/HatsuneMiku3939/pipegpt/pkg/config"
 	"github.com/spf13/viper"
 )
 
 func main() {
+	cmd.InitConfig()
+
 	if err := createSubcommand(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		// config validate reports invalid definitions by itself
+		if target, _, findErr := cmd.RootCmd.Find(os.Args[1:]); findErr != nil || target != cmd.ConfigValidateCmd {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	}
 
 	if err := cmd.RootCmd.Execute(); err != nil {
@@ -22,25 +28,15 @@ func main() {
 
 // createSubcommand creates subcommands from configuration
 func createSubcommand() error {
-	var config map[string]interface{} = viper.AllSettings()
+	// decode subcommand definitions, valid ones are created even if there are invalid ones
+	definitions, validationErr := config.Subcommands(viper.AllSettings())
 
 	// create subcommands
-	for name, subcmd := range config {
-		// skip api configuration or default configuration
-		if name == "api" || name == "default" {
-			continue
-		}
-
-		// otherwise, create subcommand
-		definition, ok := subcmd.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("invalid subcommand definition: %s", name)
-		}
-
-		if err := cmd.CreateSubcommand(name, definition); err != nil {
+	for _, definition := range definitions {
+		if err := cmd.CreateSubcommand(definition); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return validationErr
 }
@@ -0,0 +1,176 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// customIDPrefix is the prefix of custom ID of requests, followed by the index of record
+const customIDPrefix = "record-"
+
+// Job is a batch submitted to batch API, it is stored to map results back to records
+type Job struct {
+	ID string
+	// Subcommand is the name of subcommand which the batch is submitted with, empty means root command
+	Subcommand string
+	// Format is the format of output
+	Format string
+	// ResultField is the field of output which the result of a record is written to
+	ResultField string
+	// Records are records of input in order
+	Records []*Record
+	// Errors are errors of records which are not submitted, by index of record
+	Errors      map[int]string
+	SubmittedAt time.Time
+}
+
+// JobDir returns the directory where submitted jobs are stored.
+// it is $XDG_STATE_HOME/pipegpt/batches, or $HOME/.local/state/pipegpt/batches if XDG_STATE_HOME is not set.
+func JobDir() (string, error) {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(state, "pipegpt", "batches"), nil
+}
+
+// CustomID returns custom ID of the request of the record at index
+func CustomID(index int) string {
+	return customIDPrefix + strconv.Itoa(index)
+}
+
+// ParseCustomID returns index of the record of custom ID
+func ParseCustomID(id string) (int, bool) {
+	if !strings.HasPrefix(id, customIDPrefix) {
+		return 0, false
+	}
+
+	index, err := strconv.Atoi(strings.TrimPrefix(id, customIDPrefix))
+	return index, err == nil
+}
+
+// SortCustomIDs sorts custom IDs in order of index of record, IDs which are not made by CustomID follow them in order of string
+func SortCustomIDs(ids []string) {
+	sort.Slice(ids, func(a, b int) bool {
+		ia, oka := ParseCustomID(ids[a])
+		ib, okb := ParseCustomID(ids[b])
+		if oka && okb {
+			return ia < ib
+		}
+		if oka != okb {
+			return oka
+		}
+		return ids[a] < ids[b]
+	})
+}
+
+// Map maps results back to records of the job in order, each of them is a copy of the record with the result in ResultField,
+// or the error in errorField if the record is not submitted, no result is returned for it or the result is failed.
+// result is called with custom ID of each submitted record, it returns false if no result is returned for the ID.
+func (j *Job) Map(errorField string, result func(id string) (interface{}, bool, error)) []*Record {
+	records := make([]*Record, 0, len(j.Records))
+	for i, record := range j.Records {
+		output := NewRecord()
+		for _, field := range record.Fields {
+			output.Set(field, record.Values[field])
+		}
+
+		var value interface{}
+		var err error
+		if j.Errors[i] != "" {
+			err = errors.New(j.Errors[i])
+		} else {
+			var ok bool
+			if value, ok, err = result(CustomID(i)); !ok {
+				err = errors.New("no result returned")
+			}
+		}
+
+		if err != nil {
+			output.Set(errorField, err.Error())
+		} else {
+			output.Set(j.ResultField, value)
+		}
+		records = append(records, output)
+	}
+
+	return records
+}
+
+// LoadJob loads the job of given batch ID, os.ErrNotExist is returned if it is not stored
+func LoadJob(id string) (*Job, error) {
+	path, err := jobPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, fmt.Errorf("invalid batch job %s: %w", id, err)
+	}
+
+	return &job, nil
+}
+
+// Save stores the job
+func (j *Job) Save() error {
+	path, err := jobPath(j.ID)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// jobPath returns the path of the job file of given batch ID
+func jobPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", errors.New("invalid batch ID: " + id)
+	}
+
+	dir, err := JobDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// UnmarshalJSON unmarshals JSON object into the record, keeping the order of its fields
+func (r *Record) UnmarshalJSON(raw []byte) error {
+	record, err := decodeObject(raw)
+	if err != nil {
+		return err
+	}
+
+	*r = *record
+	return nil
+}
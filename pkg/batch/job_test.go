@@ -0,0 +1,143 @@
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// record creates a record of fields and values in order
+func record(fieldsAndValues ...interface{}) *Record {
+	r := NewRecord()
+	for i := 0; i < len(fieldsAndValues); i += 2 {
+		r.Set(fieldsAndValues[i].(string), fieldsAndValues[i+1])
+	}
+	return r
+}
+
+func TestJobMap(t *testing.T) {
+	job := &Job{
+		ResultField: "answer",
+		Records: []*Record{
+			record("title", "first"),
+			record("title", "second"),
+			record("title", "third"),
+			record("title", "fourth"),
+			record("title", "fifth", "answer", "old"),
+		},
+		Errors: map[int]string{1: "template: missing field"},
+	}
+
+	results := map[string]struct {
+		value interface{}
+		err   error
+	}{
+		CustomID(0): {value: "positive"},
+		CustomID(1): {value: "must not be used"},
+		CustomID(3): {err: errors.New("bad request")},
+		CustomID(4): {value: map[string]interface{}{"label": "neutral"}},
+		"unknown":   {value: "ignored"},
+	}
+
+	called := []string{}
+	got := job.Map("error", func(id string) (interface{}, bool, error) {
+		called = append(called, id)
+		result, ok := results[id]
+		return result.value, ok, result.err
+	})
+
+	want := []*Record{
+		record("title", "first", "answer", "positive"),
+		record("title", "second", "error", "template: missing field"),
+		record("title", "third", "error", "no result returned"),
+		record("title", "fourth", "error", "bad request"),
+		record("title", "fifth", "answer", map[string]interface{}{"label": "neutral"}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("Map() = %s, want %s", gotJSON, wantJSON)
+	}
+
+	// records which are not submitted have no result
+	if wantCalled := []string{"record-0", "record-2", "record-3", "record-4"}; !reflect.DeepEqual(called, wantCalled) {
+		t.Errorf("result is called with %v, want %v", called, wantCalled)
+	}
+
+	// records of the job are not modified
+	if !reflect.DeepEqual(job.Records[0], record("title", "first")) {
+		t.Errorf("Map() modified record of the job: %+v", job.Records[0])
+	}
+}
+
+func TestSortCustomIDs(t *testing.T) {
+	ids := []string{"record-10", "other", "record-2", "abc", "record-x", "record-0"}
+	SortCustomIDs(ids)
+
+	want := []string{"record-0", "record-2", "record-10", "abc", "other", "record-x"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("SortCustomIDs() = %v, want %v", ids, want)
+	}
+}
+
+func TestParseCustomID(t *testing.T) {
+	tests := []struct {
+		id    string
+		index int
+		ok    bool
+	}{
+		{CustomID(0), 0, true},
+		{CustomID(42), 42, true},
+		{"record-x", 0, false},
+		{"request-1", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			index, ok := ParseCustomID(tt.id)
+			if index != tt.index || ok != tt.ok {
+				t.Errorf("ParseCustomID(%q) = %d, %v, want %d, %v", tt.id, index, ok, tt.index, tt.ok)
+			}
+		})
+	}
+}
+
+func TestJobSaveAndLoad(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	if _, err := LoadJob("batch_1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadJob() of missing job error = %v, want %v", err, os.ErrNotExist)
+	}
+
+	job := &Job{
+		ID:          "batch_1",
+		Subcommand:  "classify",
+		Format:      FormatCSV,
+		ResultField: "answer",
+		Records:     []*Record{record("title", "first", "id", "1")},
+		Errors:      map[int]string{},
+	}
+	if err := job.Save(); err != nil {
+		t.Fatalf("Save() returned error: %s", err)
+	}
+
+	loaded, err := LoadJob("batch_1")
+	if err != nil {
+		t.Fatalf("LoadJob() returned error: %s", err)
+	}
+	if loaded.Subcommand != "classify" || loaded.Format != FormatCSV || loaded.ResultField != "answer" {
+		t.Errorf("LoadJob() = %+v, want %+v", loaded, job)
+	}
+	if len(loaded.Records) != 1 || !reflect.DeepEqual(loaded.Records[0].Fields, []string{"title", "id"}) {
+		t.Errorf("records = %+v, want fields in order", loaded.Records)
+	}
+
+	for _, id := range []string{"", ".", "..", "../batch_1", `a\b`} {
+		if _, err := LoadJob(id); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("LoadJob(%q) error = %v, want invalid batch ID", id, err)
+		}
+	}
+}
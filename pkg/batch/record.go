@@ -0,0 +1,307 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of batch input and output
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// Formats is list of supported formats
+var Formats = []string{FormatJSONL, FormatCSV}
+
+// maxLineSize is the maximum size of a line of JSONL input
+const maxLineSize = 16 * 1024 * 1024
+
+// Record is a record of batch input, its fields keep the order of input
+type Record struct {
+	// Fields are names of fields in order
+	Fields []string
+	// Values are values of fields, strings for CSV and decoded JSON values for JSONL
+	Values map[string]interface{}
+	// Err is the error of parsing the record, the record has no fields if it is set
+	Err error
+}
+
+// NewRecord creates an empty record
+func NewRecord() *Record {
+	return &Record{Values: map[string]interface{}{}}
+}
+
+// Set sets the value of field, a new field is appended to the end
+func (r *Record) Set(field string, value interface{}) {
+	if _, ok := r.Values[field]; !ok {
+		r.Fields = append(r.Fields, field)
+	}
+	r.Values[field] = value
+}
+
+// MarshalJSON marshals the record into JSON object, keeping the order of its fields
+func (r *Record) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range r.Fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(r.Values[field])
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// Detect detects format of input, JSONL if it starts with '{', otherwise CSV
+func Detect(input []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(input), []byte("{")) {
+		return FormatJSONL
+	}
+
+	return FormatCSV
+}
+
+// Read reads records of given format
+func Read(r io.Reader, format string) ([]*Record, error) {
+	switch format {
+	case FormatJSONL:
+		return ReadJSONL(r)
+	case FormatCSV:
+		return ReadCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown format: %s, must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// ReadJSONL reads a record from each line of JSONL, empty lines are skipped.
+// a line which is not a JSON object becomes a record with the error, so that it is reported in its place.
+func ReadJSONL(r io.Reader) ([]*Record, error) {
+	records := []*Record{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		record, err := decodeObject(text)
+		if err != nil {
+			record = &Record{Values: map[string]interface{}{}, Err: fmt.Errorf("line %d: %w", line, err)}
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// decodeObject decodes JSON object into a record keeping the order of its keys
+func decodeObject(text []byte) (*Record, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+
+	record := NewRecord()
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		record.Set(key, value)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+
+	return record, nil
+}
+
+// ReadCSV reads a record from each row of CSV, the first row is the header
+func ReadCSV(r io.Reader) ([]*Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := NewRecord()
+		if len(row) != len(header) {
+			line, _ := reader.FieldPos(0)
+			record.Err = fmt.Errorf("line %d: %d fields, but header has %d fields", line, len(row), len(header))
+		} else {
+			for i, field := range header {
+				record.Set(field, row[i])
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// Writer writes records in a format
+type Writer interface {
+	// Write writes the record
+	Write(record *Record) error
+	// Flush flushes buffered records
+	Flush() error
+}
+
+// NewWriter creates a writer of given format, fields are the header of CSV
+func NewWriter(w io.Writer, format string, fields []string) (Writer, error) {
+	switch format {
+	case FormatJSONL:
+		return &jsonlWriter{w: w}, nil
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), fields: fields}, nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s, must be one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// jsonlWriter writes each record as a JSON object in a line
+type jsonlWriter struct {
+	w io.Writer
+}
+
+// Write writes the record as a JSON object in a line
+func (j *jsonlWriter) Write(record *Record) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.w.Write(append(raw, '\n'))
+	return err
+}
+
+// Flush does nothing, records are written at once
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
+
+// csvWriter writes each record as a row of CSV, the header is written before the first record
+type csvWriter struct {
+	w             *csv.Writer
+	fields        []string
+	headerWritten bool
+}
+
+// Write writes the record as a row, values which are not string are written as JSON
+func (c *csvWriter) Write(record *Record) error {
+	if !c.headerWritten {
+		if err := c.w.Write(c.fields); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	row := make([]string, len(c.fields))
+	for i, field := range c.fields {
+		switch v := record.Values[field].(type) {
+		case nil:
+		case string:
+			row[i] = v
+		case json.Number:
+			row[i] = v.String()
+		default:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			row[i] = string(raw)
+		}
+	}
+
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+
+	// flush each row, so that results are visible as they arrive
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Flush flushes buffered rows
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Fields returns the union of fields of records in order of appearance, and extra fields at the end
+func Fields(records []*Record, extra ...string) []string {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, record := range records {
+		for _, field := range record.Fields {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	for _, field := range extra {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
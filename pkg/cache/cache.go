@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// fileExt is the extension of cache entry files
+const fileExt = ".json"
+
+// Cache is an on-disk store of responses, entries older than TTL are ignored
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// Stats is a summary of stored entries
+type Stats struct {
+	Dir     string
+	Entries int
+	Expired int
+	Size    int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// Dir returns the directory where cache entries are stored.
+// it is $XDG_CACHE_HOME/pipegpt, or $HOME/.cache/pipegpt if XDG_CACHE_HOME is not set.
+func Dir() (string, error) {
+	cache := os.Getenv("XDG_CACHE_HOME")
+	if cache == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		cache = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(cache, "pipegpt"), nil
+}
+
+// New creates a cache stored in dir, 0 TTL means entries never expire
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// Key returns the key of v, which is the hash of its JSON representation
+func Key(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get decodes the entry of key into v, and returns false if it is not stored or expired
+func (c *Cache) Get(key string, v interface{}) (bool, error) {
+	path := c.filePath(key)
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if c.expired(info) {
+		return false, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	// broken entry is treated as missing, it is overwritten by the next Put
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Put stores v as the entry of key
+func (c *Cache) Put(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	path := c.filePath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// write to temporary file and rename it, so that concurrent readers never see partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+key+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Stats returns the summary of stored entries
+func (c *Cache) Stats() (Stats, error) {
+	stats := Stats{Dir: c.dir}
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Size += info.Size()
+		if c.expired(info) {
+			stats.Expired++
+		}
+		if stats.Oldest.IsZero() || info.ModTime().Before(stats.Oldest) {
+			stats.Oldest = info.ModTime()
+		}
+		if info.ModTime().After(stats.Newest) {
+			stats.Newest = info.ModTime()
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// Clear removes every entry, and returns the number of removed entries
+func (c *Cache) Clear() (int, error) {
+	return c.remove(func(fs.FileInfo) bool { return true })
+}
+
+// Prune removes expired entries, and returns the number of removed entries
+func (c *Cache) Prune() (int, error) {
+	return c.remove(c.expired)
+}
+
+// remove removes entries which match, and returns the number of removed entries
+func (c *Cache) remove(match func(fs.FileInfo) bool) (int, error) {
+	removed := 0
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		if !match(info) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+
+	return removed, err
+}
+
+// walk calls fn for each entry file, missing directory means no entries
+func (c *Cache) walk(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), fileExt) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(path, info)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read cache: %w", err)
+	}
+
+	return nil
+}
+
+// expired returns true if the entry is older than TTL
+func (c *Cache) expired(info fs.FileInfo) bool {
+	return c.ttl > 0 && time.Since(info.ModTime()) > c.ttl
+}
+
+// filePath returns the path of the entry of key, entries are sharded by the first two characters of key
+func (c *Cache) filePath(key string) string {
+	return filepath.Join(c.dir, key[:2], key+fileExt)
+}
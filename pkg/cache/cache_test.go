@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// entry is the value of tests
+type entry struct {
+	Answer string `json:"answer"`
+}
+
+// putAged stores the entry of key, and makes it older by age
+func putAged(t *testing.T, c *Cache, key string, answer string, age time.Duration) {
+	t.Helper()
+
+	if err := c.Put(key, entry{Answer: answer}); err != nil {
+		t.Fatalf("Put() returned error: %s", err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(c.filePath(key), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	first, err := Key(map[string]string{"model": "gpt-4o", "prompt": "hello"})
+	if err != nil {
+		t.Fatalf("Key() returned error: %s", err)
+	}
+	second, _ := Key(map[string]string{"prompt": "hello", "model": "gpt-4o"})
+	other, _ := Key(map[string]string{"model": "gpt-4o", "prompt": "hi"})
+
+	if len(first) != 64 || first != second {
+		t.Errorf("Key() = %q and %q, want the same hash of the same value", first, second)
+	}
+	if first == other {
+		t.Errorf("Key() = %q of different values", first)
+	}
+	if _, err := Key(func() {}); err == nil {
+		t.Errorf("Key() of a value which is not JSON returned no error")
+	}
+}
+
+func TestGetAndPut(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	key, _ := Key("question")
+
+	var got entry
+	if found, err := c.Get(key, &got); found || err != nil {
+		t.Errorf("Get() of missing entry = %v, %v, want a miss", found, err)
+	}
+
+	if err := c.Put(key, entry{Answer: "first"}); err != nil {
+		t.Fatalf("Put() returned error: %s", err)
+	}
+	if err := c.Put(key, entry{Answer: "second"}); err != nil {
+		t.Fatalf("Put() returned error: %s", err)
+	}
+	if found, err := c.Get(key, &got); !found || err != nil || got.Answer != "second" {
+		t.Errorf("Get() = %v, %+v, %v, want the last entry", found, got, err)
+	}
+
+	// the entry is sharded by the first two characters of key
+	if _, err := os.Stat(c.filePath(key)); err != nil || c.filePath(key) != filepath.Join(c.dir, key[:2], key+".json") {
+		t.Errorf("entry is not stored at %s: %v", c.filePath(key), err)
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := Key("question")
+	putAged(t, New(dir, time.Hour), key, "old", 2*time.Hour)
+
+	var got entry
+	if found, err := New(dir, time.Hour).Get(key, &got); found || err != nil {
+		t.Errorf("Get() of expired entry = %v, %v, want a miss", found, err)
+	}
+	if found, err := New(dir, 0).Get(key, &got); !found || err != nil || got.Answer != "old" {
+		t.Errorf("Get() without TTL = %v, %+v, %v, want the entry which never expires", found, got, err)
+	}
+}
+
+func TestGetBroken(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	key, _ := Key("question")
+	if err := c.Put(key, entry{Answer: "answer"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.filePath(key), []byte(`{"answer":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got entry
+	if found, err := c.Get(key, &got); found || err != nil {
+		t.Errorf("Get() of broken entry = %v, %v, want a miss", found, err)
+	}
+}
+
+func TestPruneAndClear(t *testing.T) {
+	c := New(t.TempDir(), time.Hour)
+	keys := []string{}
+	for i, age := range []time.Duration{0, 30 * time.Minute, 2 * time.Hour, 48 * time.Hour} {
+		key, _ := Key(i)
+		putAged(t, c, key, "answer", age)
+		keys = append(keys, key)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats() returned error: %s", err)
+	}
+	if stats.Dir != c.dir || stats.Entries != 4 || stats.Expired != 2 || stats.Size != 4*int64(len(`{"answer":"answer"}`)) {
+		t.Errorf("Stats() = %+v, want 4 entries of which 2 are expired", stats)
+	}
+	if age := time.Since(stats.Oldest); age < 47*time.Hour || time.Since(stats.Newest) > time.Minute {
+		t.Errorf("Stats() oldest = %s, newest = %s", stats.Oldest, stats.Newest)
+	}
+
+	removed, err := c.Prune()
+	if err != nil || removed != 2 {
+		t.Errorf("Prune() = %d, %v, want 2 expired entries", removed, err)
+	}
+	var got entry
+	for i, key := range keys {
+		found, _ := c.Get(key, &got)
+		if _, err := os.Stat(c.filePath(key)); (err == nil) != (i < 2) || found != (i < 2) {
+			t.Errorf("entry %d is kept = %v after Prune(), want %v", i, err == nil, i < 2)
+		}
+	}
+
+	removed, err = c.Clear()
+	if err != nil || removed != 2 {
+		t.Errorf("Clear() = %d, %v, want 2 entries", removed, err)
+	}
+	if stats, err := c.Stats(); err != nil || stats.Entries != 0 || stats.Size != 0 {
+		t.Errorf("Stats() after Clear() = %+v, %v, want no entries", stats, err)
+	}
+}
+
+func TestMissingDir(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "missing"), time.Hour)
+
+	if stats, err := c.Stats(); err != nil || stats.Entries != 0 {
+		t.Errorf("Stats() = %+v, %v, want no entries", stats, err)
+	}
+	if removed, err := c.Clear(); err != nil || removed != 0 {
+		t.Errorf("Clear() = %d, %v, want nothing removed", removed, err)
+	}
+	if removed, err := c.Prune(); err != nil || removed != 0 {
+		t.Errorf("Prune() = %d, %v, want nothing removed", removed, err)
+	}
+}
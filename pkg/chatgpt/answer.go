@@ -0,0 +1,59 @@
+package chatgpt
+
+import (
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Answer is the answer of the model with metadata of the response
+type Answer struct {
+	Content      string
+	Model        string
+	Usage        openai.Usage
+	FinishReason openai.FinishReason
+	// ToolCalls are tools called by the model, the answer has no content if it calls any
+	ToolCalls []openai.ToolCall
+	// Cached is true if the answer is taken from cache instead of the model
+	Cached bool
+}
+
+// Add adds the answer of following request of the same question.
+// tokens are summed up, and the other fields are taken from the later answer.
+func (a *Answer) Add(other *Answer) {
+	usage := a.Usage
+	*a = *other
+	a.Usage.PromptTokens += usage.PromptTokens
+	a.Usage.CompletionTokens += usage.CompletionTokens
+	a.Usage.TotalTokens += usage.TotalTokens
+}
+
+// newAnswer returns the answer of first choice of the response
+func newAnswer(resp openai.ChatCompletionResponse) (*Answer, error) {
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned")
+	}
+
+	choice := resp.Choices[0]
+	return &Answer{
+		Content:      choice.Message.Content,
+		Model:        resp.Model,
+		Usage:        resp.Usage,
+		FinishReason: choice.FinishReason,
+		ToolCalls:    choice.Message.ToolCalls,
+	}, nil
+}
+
+// response returns the response which has the answer as its first choice, used to cache streamed answer
+func (a *Answer) response() openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Model: a.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: a.Content},
+				FinishReason: a.FinishReason,
+			},
+		},
+		Usage: a.Usage,
+	}
+}
@@ -0,0 +1,439 @@
+package chatgpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// defaultAnthropicBaseURL is the base URL of Anthropic API
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	// anthropicVersion is the version of Anthropic API
+	anthropicVersion = "2023-06-01"
+	// defaultAnthropicMaxTokens is used when max tokens is not specified, Anthropic API requires it
+	defaultAnthropicMaxTokens = 4096
+)
+
+// anthropicProvider is a provider of Anthropic Messages API
+type anthropicProvider struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+// anthropicRequest is a request of Anthropic Messages API
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature,omitempty"`
+	TopP        float32            `json:"top_p,omitempty"`
+	Stop        []string           `json:"stop_sequences,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  map[string]string  `json:"tool_choice,omitempty"`
+}
+
+// anthropicMessage is a message of Anthropic Messages API
+type anthropicMessage struct {
+	Role    string
+	Content []anthropicContentBlock
+}
+
+// MarshalJSON encodes the message, content of a single text block is encoded as a string
+func (m anthropicMessage) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	if len(m.Content) == 1 && m.Content[0].Type == "text" {
+		content = m.Content[0].Text
+	}
+
+	return json.Marshal(map[string]interface{}{"role": m.Role, "content": content})
+}
+
+// anthropicTool is a tool definition of Anthropic Messages API
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicResponse is a response of Anthropic Messages API
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+// anthropicContentBlock is a content block of Anthropic Messages API
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// ToolUseID and Content are the result of tool use
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// anthropicUsage is a token usage of Anthropic Messages API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicEvent is a server-sent event of Anthropic Messages API
+type anthropicEvent struct {
+	Type    string            `json:"type"`
+	Message anthropicResponse `json:"message"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	// Usage is output tokens of message_delta event, input tokens are given in message of message_start event
+	Usage anthropicUsage `json:"usage"`
+	Error anthropicError `json:"error"`
+}
+
+// anthropicError is an error of Anthropic Messages API
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// CreateChatCompletion creates a chat completion
+func (p *anthropicProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := toAnthropicRequest(req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	resp, err := p.post(ctx, body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var res anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	// concatenate text blocks, and take each tool use as tool call.
+	// the tool use of JSON schema is the answer in JSON.
+	format := jsonSchema(req)
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	for _, block := range res.Content {
+		switch {
+		case block.Type == "text":
+			message.Content += block.Text
+		case block.Type == "tool_use" && format != nil && block.Name == format.Name:
+			message.Content = string(block.Input)
+		case block.Type == "tool_use":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(block.Input),
+				},
+			})
+		}
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:    res.ID,
+		Model: res.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message:      message,
+				FinishReason: anthropicFinishReason(res.StopReason),
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     res.Usage.InputTokens,
+			CompletionTokens: res.Usage.OutputTokens,
+			TotalTokens:      res.Usage.InputTokens + res.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// CreateChatCompletionStream creates a chat completion stream
+func (p *anthropicProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	body, err := toAnthropicRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	body.Stream = true
+
+	resp, err := p.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &anthropicStream{
+		body:   resp.Body,
+		reader: bufio.NewReader(resp.Body),
+	}, nil
+}
+
+// post sends the request to Messages API
+func (p *anthropicProvider) post(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("x-api-key", p.apiKey)
+	header.Set("anthropic-version", anthropicVersion)
+
+	return postJSON(ctx, p.client, strings.TrimSuffix(p.baseURL, "/")+"/messages", header, body, func(body []byte) string {
+		var res struct {
+			Error anthropicError `json:"error"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return ""
+		}
+		return res.Error.Message
+	})
+}
+
+// anthropicStream is a stream of Anthropic Messages API
+type anthropicStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+
+	id    string
+	model string
+	// inputTokens are given at the start of the stream, and reported with output tokens at the end
+	inputTokens int
+}
+
+// Recv receives next text delta, other events are skipped
+func (s *anthropicStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		// only data lines carry events, event type is also included in data
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimPrefix(line, []byte("data:"))
+
+		var event anthropicEvent
+		if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		switch event.Type {
+		case "message_start":
+			s.id = event.Message.ID
+			s.model = event.Message.Model
+			s.inputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" {
+				continue
+			}
+			return s.response(openai.ChatCompletionStreamChoice{
+				Delta: openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text},
+			}), nil
+		case "message_delta":
+			resp := s.response(openai.ChatCompletionStreamChoice{
+				FinishReason: anthropicFinishReason(event.Delta.StopReason),
+			})
+			resp.Usage = &openai.Usage{
+				PromptTokens:     s.inputTokens,
+				CompletionTokens: event.Usage.OutputTokens,
+				TotalTokens:      s.inputTokens + event.Usage.OutputTokens,
+			}
+			return resp, nil
+		case "message_stop":
+			return openai.ChatCompletionStreamResponse{}, io.EOF
+		case "error":
+			return openai.ChatCompletionStreamResponse{}, &openai.APIError{
+				Type:    event.Error.Type,
+				Message: event.Error.Message,
+			}
+		}
+	}
+}
+
+// Close closes the stream
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
+
+// response wraps the choice in a stream response
+func (s *anthropicStream) response(choice openai.ChatCompletionStreamChoice) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		ID:      s.id,
+		Model:   s.model,
+		Choices: []openai.ChatCompletionStreamChoice{choice},
+	}
+}
+
+// toAnthropicRequest translates OpenAI request into Anthropic request
+func toAnthropicRequest(req openai.ChatCompletionRequest) (anthropicRequest, error) {
+	res := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.Stop,
+	}
+	if res.MaxTokens == 0 {
+		res.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	// Anthropic allows temperature only up to 1, while OpenAI allows up to 2
+	if req.Temperature > 1 {
+		return anthropicRequest{}, fmt.Errorf("temperature must be between 0 and 1 for Anthropic: %v", req.Temperature)
+	}
+
+	// system messages are given separately, and consecutive messages of same role are merged
+	system := []string{}
+	for _, msg := range req.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+
+		role := msg.Role
+		if role != openai.ChatMessageRoleAssistant {
+			role = openai.ChatMessageRoleUser
+		}
+
+		blocks, err := anthropicContent(msg)
+		if err != nil {
+			return anthropicRequest{}, err
+		}
+
+		n := len(res.Messages)
+		if n == 0 || res.Messages[n-1].Role != role {
+			res.Messages = append(res.Messages, anthropicMessage{Role: role, Content: blocks})
+			continue
+		}
+
+		// texts are joined, and other blocks are appended to the previous message
+		last := &res.Messages[n-1]
+		for _, block := range blocks {
+			if i := len(last.Content) - 1; block.Type == "text" && last.Content[i].Type == "text" {
+				last.Content[i].Text += "\n\n" + block.Text
+				continue
+			}
+			last.Content = append(last.Content, block)
+		}
+	}
+
+	// Anthropic has no JSON mode, JSON schema is given as a forced tool if it is an object, otherwise as instruction
+	if format := jsonSchema(req); format != nil {
+		schema, err := toJSON(format.Schema)
+		if err != nil {
+			return anthropicRequest{}, err
+		}
+
+		var probe struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(schema, &probe) == nil && probe.Type == "object" {
+			res.Tools = append(res.Tools, anthropicTool{Name: format.Name, InputSchema: schema})
+			res.ToolChoice = map[string]string{"type": "tool", "name": format.Name}
+		} else {
+			system = append(system, schemaInstruction(schema))
+		}
+	}
+	res.System = strings.Join(system, "\n\n")
+
+	if len(res.Messages) == 0 {
+		return anthropicRequest{}, errors.New("no user message given")
+	}
+
+	for _, f := range functions(req) {
+		schema, err := toJSON(f.Parameters)
+		if err != nil {
+			return anthropicRequest{}, err
+		}
+
+		res.Tools = append(res.Tools, anthropicTool{
+			Name:        f.Name,
+			Description: f.Description,
+			InputSchema: schema,
+		})
+	}
+
+	// tool choice is given only if it is not the default
+	if len(req.Tools) > 0 {
+		switch call := functionChoice(req); call {
+		case FunctionCallAuto:
+		case FunctionCallNone:
+			res.ToolChoice = map[string]string{"type": "none"}
+		default:
+			res.ToolChoice = map[string]string{"type": "tool", "name": call}
+		}
+	}
+
+	return res, nil
+}
+
+// anthropicContent translates content of the message into content blocks.
+// tool calls become tool use blocks, and the result of tool call becomes a tool result block.
+func anthropicContent(msg openai.ChatCompletionMessage) ([]anthropicContentBlock, error) {
+	if msg.Role == openai.ChatMessageRoleTool {
+		return []anthropicContentBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content}}, nil
+	}
+	if len(msg.ToolCalls) == 0 {
+		return []anthropicContentBlock{{Type: "text", Text: msg.Content}}, nil
+	}
+
+	// empty text block is not allowed with tool use
+	blocks := []anthropicContentBlock{}
+	if msg.Content != "" {
+		blocks = append(blocks, anthropicContentBlock{Type: "text", Text: msg.Content})
+	}
+	for _, call := range msg.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		if !json.Valid(input) {
+			return nil, fmt.Errorf("invalid arguments of tool call %s: %s", call.Function.Name, call.Function.Arguments)
+		}
+
+		blocks = append(blocks, anthropicContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: input,
+		})
+	}
+
+	return blocks, nil
+}
+
+// anthropicFinishReason translates stop reason of Anthropic into finish reason of OpenAI
+func anthropicFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "":
+		return ""
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	}
+
+	return openai.FinishReasonStop
+}
@@ -0,0 +1,427 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestToAnthropicRequest(t *testing.T) {
+	client := NewClientWithProvider(nil, "claude", time.Minute)
+	funcs := []openai.FunctionDefinition{
+		{Name: "f", Description: "call f", Parameters: json.RawMessage(`{"type":"object"}`)},
+		{Name: "g", Parameters: json.RawMessage(`{"type":"object"}`)},
+	}
+
+	tests := []struct {
+		name string
+		req  openai.ChatCompletionRequest
+		want string
+	}{
+		{
+			name: "system and consecutive messages are merged",
+			req: openai.ChatCompletionRequest{
+				Model:       "claude",
+				Temperature: 0.5,
+				Stop:        []string{"END"},
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+					{Role: openai.ChatMessageRoleSystem, Content: "be kind"},
+					{Role: openai.ChatMessageRoleUser, Content: "q1"},
+					{Role: openai.ChatMessageRoleUser, Content: "q2"},
+					{Role: openai.ChatMessageRoleAssistant, Content: "a1"},
+					{Role: openai.ChatMessageRoleUser, Content: "q3"},
+				},
+			},
+			want: `{
+				"model": "claude",
+				"system": "be brief\n\nbe kind",
+				"messages": [
+					{"role": "user", "content": "q1\n\nq2"},
+					{"role": "assistant", "content": "a1"},
+					{"role": "user", "content": "q3"}
+				],
+				"max_tokens": 4096,
+				"temperature": 0.5,
+				"stop_sequences": ["END"]
+			}`,
+		},
+		{
+			name: "tool calls and their results",
+			req: openai.ChatCompletionRequest{
+				Model:     "claude",
+				MaxTokens: 100,
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleUser, Content: "q"},
+					{Role: openai.ChatMessageRoleAssistant, Content: "calling", ToolCalls: []openai.ToolCall{
+						{ID: "t1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "f", Arguments: `{"a":1}`}},
+						{ID: "t2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "g"}},
+					}},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "t1", Content: "r1"},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "t2", Content: "r2"},
+				},
+				Tools: []openai.Tool{
+					{Type: openai.ToolTypeFunction, Function: &funcs[0]},
+					{Type: openai.ToolTypeFunction, Function: &funcs[1]},
+				},
+			},
+			want: `{
+				"model": "claude",
+				"messages": [
+					{"role": "user", "content": "q"},
+					{"role": "assistant", "content": [
+						{"type": "text", "text": "calling"},
+						{"type": "tool_use", "id": "t1", "name": "f", "input": {"a": 1}},
+						{"type": "tool_use", "id": "t2", "name": "g", "input": {}}
+					]},
+					{"role": "user", "content": [
+						{"type": "tool_result", "tool_use_id": "t1", "content": "r1"},
+						{"type": "tool_result", "tool_use_id": "t2", "content": "r2"}
+					]}
+				],
+				"max_tokens": 100,
+				"tools": [
+					{"name": "f", "description": "call f", "input_schema": {"type": "object"}},
+					{"name": "g", "input_schema": {"type": "object"}}
+				]
+			}`,
+		},
+		{
+			name: "forced function",
+			req:  client.FunctionCallRequest("role", "prompt", "", funcs[:1], "f"),
+			want: `{
+				"model": "claude",
+				"system": "role",
+				"messages": [{"role": "user", "content": "prompt"}],
+				"max_tokens": 4096,
+				"tools": [{"name": "f", "description": "call f", "input_schema": {"type": "object"}}],
+				"tool_choice": {"type": "tool", "name": "f"}
+			}`,
+		},
+		{
+			name: "no function call",
+			req:  client.FunctionCallRequest("role", "prompt", "", funcs[:1], FunctionCallNone),
+			want: `{
+				"model": "claude",
+				"system": "role",
+				"messages": [{"role": "user", "content": "prompt"}],
+				"max_tokens": 4096,
+				"tools": [{"name": "f", "description": "call f", "input_schema": {"type": "object"}}],
+				"tool_choice": {"type": "none"}
+			}`,
+		},
+		{
+			name: "object schema is a forced tool",
+			req: client.StructuredOutputRequest("role", "prompt", "", &OutputFormat{
+				Name:   "person",
+				Schema: json.RawMessage(`{"type":"object"}`),
+			}),
+			want: `{
+				"model": "claude",
+				"system": "role",
+				"messages": [{"role": "user", "content": "prompt"}],
+				"max_tokens": 4096,
+				"tools": [{"name": "person", "input_schema": {"type": "object"}}],
+				"tool_choice": {"type": "tool", "name": "person"}
+			}`,
+		},
+		{
+			name: "other schema is an instruction",
+			req: client.StructuredOutputRequest("role", "prompt", "", &OutputFormat{
+				Name:   "names",
+				Schema: json.RawMessage(`{"type":"array"}`),
+			}),
+			want: fmt.Sprintf(`{
+				"model": "claude",
+				"system": %q,
+				"messages": [{"role": "user", "content": "prompt"}],
+				"max_tokens": 4096
+			}`, "role\n\n"+schemaInstruction(json.RawMessage(`{"type":"array"}`))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toAnthropicRequest(tt.req)
+			if err != nil {
+				t.Fatalf("toAnthropicRequest() returned error: %s", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestToAnthropicRequestError(t *testing.T) {
+	tests := []struct {
+		name        string
+		msgs        []openai.ChatCompletionMessage
+		temperature float32
+		err         string
+	}{
+		{
+			name:        "temperature above 1",
+			msgs:        []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "q"}},
+			temperature: 1.5,
+			err:         "temperature must be between 0 and 1 for Anthropic: 1.5",
+		},
+		{
+			name: "no user message",
+			msgs: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "role"}},
+			err:  "no user message given",
+		},
+		{
+			name: "invalid arguments",
+			msgs: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "q"},
+				{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+					{ID: "t1", Function: openai.FunctionCall{Name: "f", Arguments: `{"a":`}},
+				}},
+			},
+			err: `invalid arguments of tool call f: {"a":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := toAnthropicRequest(openai.ChatCompletionRequest{Model: "claude", Messages: tt.msgs, Temperature: tt.temperature})
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("toAnthropicRequest() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// anthropicServer returns a server of Messages API which answers the body of the model in the request
+func anthropicServer(t *testing.T, bodies map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("headers = %v, want API key and version", r.Header)
+		}
+
+		var req struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %s", err)
+		}
+
+		body := bodies[req.Model]
+		if strings.HasPrefix(body, `{"type":"error"`) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestAnthropicCreateChatCompletion(t *testing.T) {
+	server := anthropicServer(t, map[string]string{
+		"text": `{"id":"msg_1","model":"claude-3","content":[{"type":"text","text":"Hello"},{"type":"text","text":" world"}],
+			"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":4}}`,
+		"tools": `{"id":"msg_2","model":"claude-3","content":[{"type":"text","text":"let me see"},
+			{"type":"tool_use","id":"tu_1","name":"f","input":{"a":1}}],
+			"stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":6}}`,
+		"schema": `{"id":"msg_3","model":"claude-3","content":[{"type":"tool_use","id":"tu_2","name":"person","input":{"name":"Miku"}}],
+			"stop_reason":"tool_use","usage":{"input_tokens":1,"output_tokens":2}}`,
+		"error": `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens is too large"}}`,
+	})
+	provider := &anthropicProvider{client: server.Client(), baseURL: server.URL + "/v1/", apiKey: "key"}
+
+	request := func(model string) openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{Model: model, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "q"}}}
+	}
+	schema := request("schema")
+	schema.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: "person", Schema: json.RawMessage(`{"type":"object"}`)},
+	}
+
+	tests := []struct {
+		name    string
+		req     openai.ChatCompletionRequest
+		message openai.ChatCompletionMessage
+		reason  openai.FinishReason
+		usage   openai.Usage
+	}{
+		{
+			name:    "text",
+			req:     request("text"),
+			message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello world"},
+			reason:  openai.FinishReasonStop,
+			usage:   openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+		},
+		{
+			name: "tool calls",
+			req:  request("tools"),
+			message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: "let me see",
+				ToolCalls: []openai.ToolCall{
+					{ID: "tu_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "f", Arguments: `{"a":1}`}},
+				},
+			},
+			reason: openai.FinishReasonToolCalls,
+			usage:  openai.Usage{PromptTokens: 5, CompletionTokens: 6, TotalTokens: 11},
+		},
+		{
+			name:    "tool use of schema is the answer",
+			req:     schema,
+			message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: `{"name":"Miku"}`},
+			reason:  openai.FinishReasonToolCalls,
+			usage:   openai.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := provider.CreateChatCompletion(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() returned error: %s", err)
+			}
+			if resp.Model != "claude-3" || len(resp.Choices) != 1 {
+				t.Fatalf("CreateChatCompletion() = %+v, want a choice of claude-3", resp)
+			}
+			if !reflect.DeepEqual(resp.Choices[0].Message, tt.message) {
+				t.Errorf("message = %+v, want %+v", resp.Choices[0].Message, tt.message)
+			}
+			if resp.Choices[0].FinishReason != tt.reason {
+				t.Errorf("finish reason = %s, want %s", resp.Choices[0].FinishReason, tt.reason)
+			}
+			if resp.Usage != tt.usage {
+				t.Errorf("usage = %+v, want %+v", resp.Usage, tt.usage)
+			}
+		})
+	}
+
+	t.Run("error body", func(t *testing.T) {
+		_, err := provider.CreateChatCompletion(context.Background(), request("error"))
+		assertAPIError(t, err, http.StatusBadRequest, "max_tokens is too large")
+	})
+}
+
+// receiveAll receives responses of the stream until it is finished
+func receiveAll(stream Stream) ([]openai.ChatCompletionStreamResponse, error) {
+	responses := []openai.ChatCompletionStreamResponse{}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return responses, nil
+		}
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+}
+
+func TestAnthropicStreamRecv(t *testing.T) {
+	server := anthropicServer(t, map[string]string{
+		"stream": strings.Join([]string{
+			`event: message_start`,
+			`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3","usage":{"input_tokens":5,"output_tokens":1}}}`,
+			``,
+			`event: ping`,
+			`data: {"type":"ping"}`,
+			``,
+			`event: content_block_start`,
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			``,
+			`event: content_block_delta`,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			``,
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+			``,
+			`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+			``,
+			`event: message_delta`,
+			`data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":7}}`,
+			``,
+			`event: message_stop`,
+			`data: {"type":"message_stop"}`,
+			``,
+		}, "\n"),
+		"overloaded": strings.Join([]string{
+			`event: message_start`,
+			`data: {"type":"message_start","message":{"id":"msg_2","model":"claude-3"}}`,
+			``,
+			`event: error`,
+			`data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			``,
+		}, "\n"),
+		"error": `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long"}}`,
+	})
+	provider := &anthropicProvider{client: server.Client(), baseURL: server.URL + "/v1", apiKey: "key"}
+
+	request := func(model string) openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{Model: model, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "q"}}}
+	}
+
+	t.Run("deltas", func(t *testing.T) {
+		stream, err := provider.CreateChatCompletionStream(context.Background(), request("stream"))
+		if err != nil {
+			t.Fatalf("CreateChatCompletionStream() returned error: %s", err)
+		}
+		defer stream.Close()
+
+		responses, err := receiveAll(stream)
+		if err != nil {
+			t.Fatalf("Recv() returned error: %s", err)
+		}
+		if len(responses) != 3 {
+			t.Fatalf("Recv() returned %d responses, want 3: %+v", len(responses), responses)
+		}
+
+		content := ""
+		for _, resp := range responses {
+			if resp.ID != "msg_1" || resp.Model != "claude-3" {
+				t.Errorf("response = %+v, want ID and model of message_start", resp)
+			}
+			content += resp.Choices[0].Delta.Content
+		}
+		if content != "Hello" {
+			t.Errorf("content = %q, want %q", content, "Hello")
+		}
+
+		last := responses[2]
+		if last.Choices[0].FinishReason != openai.FinishReasonLength {
+			t.Errorf("finish reason = %s, want %s", last.Choices[0].FinishReason, openai.FinishReasonLength)
+		}
+		if want := (openai.Usage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12}); last.Usage == nil || *last.Usage != want {
+			t.Errorf("usage = %+v, want %+v", last.Usage, want)
+		}
+	})
+
+	t.Run("error event", func(t *testing.T) {
+		stream, err := provider.CreateChatCompletionStream(context.Background(), request("overloaded"))
+		if err != nil {
+			t.Fatalf("CreateChatCompletionStream() returned error: %s", err)
+		}
+		defer stream.Close()
+
+		_, err = receiveAll(stream)
+		var apiErr *openai.APIError
+		if !errors.As(err, &apiErr) || apiErr.Type != "overloaded_error" || apiErr.Message != "Overloaded" {
+			t.Errorf("Recv() error = %v, want overloaded_error", err)
+		}
+	})
+
+	t.Run("error body", func(t *testing.T) {
+		_, err := provider.CreateChatCompletionStream(context.Background(), request("error"))
+		assertAPIError(t, err, http.StatusBadRequest, "prompt is too long")
+	})
+}
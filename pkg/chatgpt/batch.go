@@ -0,0 +1,208 @@
+package chatgpt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// batchCompletionWindow is the time frame within which the batch is processed
+const batchCompletionWindow = "24h"
+
+// maxBatchLineSize is the maximum size of a line of batch output
+const maxBatchLineSize = 64 * 1024 * 1024
+
+// ErrBatchNotSupported is returned if the provider does not support batch API
+var ErrBatchNotSupported = errors.New("batch API is not supported by the provider, use OpenAI API")
+
+// BatchProvider is a provider which supports batch API
+type BatchProvider interface {
+	// CreateBatch uploads requests and creates a batch of them
+	CreateBatch(ctx context.Context, req openai.CreateBatchWithUploadFileRequest) (openai.Batch, error)
+	// RetrieveBatch retrieves the batch
+	RetrieveBatch(ctx context.Context, id string) (openai.Batch, error)
+	// FileContent downloads content of the file
+	FileContent(ctx context.Context, id string) (io.ReadCloser, error)
+}
+
+// BatchRequest is a chat completion request in a batch, CustomID identifies its result
+type BatchRequest struct {
+	CustomID string
+	Request  openai.ChatCompletionRequest
+}
+
+// BatchResult is the result of a request in a batch
+type BatchResult struct {
+	CustomID string
+	Response openai.ChatCompletionResponse
+	Err      error
+}
+
+// Answer returns the answer of the result
+func (r *BatchResult) Answer() (string, error) {
+	if r.Err != nil {
+		return "", r.Err
+	}
+
+	answer, err := newAnswer(r.Response)
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Content, nil
+}
+
+// FunctionCalls returns function calls of the result, their arguments are validated if function definitions are given
+func (r *BatchResult) FunctionCalls(funcs []openai.FunctionDefinition) ([]*FunctionCallResult, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if funcs == nil {
+		return functionCalls(r.Response)
+	}
+
+	return ValidateFunctionCalls(r.Response, funcs)
+}
+
+// batchOutput is a line of output or error file of batch
+type batchOutput struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// batchProvider returns the provider if it supports batch API
+func (gpt *Client) batchProvider() (BatchProvider, error) {
+	provider, ok := gpt.client.(BatchProvider)
+	if !ok {
+		return nil, ErrBatchNotSupported
+	}
+
+	return provider, nil
+}
+
+// SubmitBatch uploads requests and creates a batch of them, metadata is attached to the batch
+func (gpt *Client) SubmitBatch(requests []BatchRequest, metadata map[string]interface{}) (openai.Batch, error) {
+	provider, err := gpt.batchProvider()
+	if err != nil {
+		return openai.Batch{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(countRetries(context.Background()), gpt.timeout)
+	defer cancel()
+
+	req := openai.CreateBatchWithUploadFileRequest{
+		Endpoint:         openai.BatchEndpointChatCompletions,
+		CompletionWindow: batchCompletionWindow,
+		Metadata:         metadata,
+	}
+	for _, r := range requests {
+		req.AddChatCompletion(r.CustomID, r.Request)
+	}
+
+	batch, err := provider.CreateBatch(ctx, req)
+	if err != nil {
+		return batch, gpt.classify(ctx, err)
+	}
+
+	return batch, nil
+}
+
+// RetrieveBatch retrieves the batch of given ID
+func (gpt *Client) RetrieveBatch(id string) (openai.Batch, error) {
+	provider, err := gpt.batchProvider()
+	if err != nil {
+		return openai.Batch{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(countRetries(context.Background()), gpt.timeout)
+	defer cancel()
+
+	batch, err := provider.RetrieveBatch(ctx, id)
+	if err != nil {
+		return batch, gpt.classify(ctx, err)
+	}
+
+	return batch, nil
+}
+
+// BatchResults downloads output and error files of the batch, and returns results by custom ID
+func (gpt *Client) BatchResults(batch openai.Batch) (map[string]*BatchResult, error) {
+	provider, err := gpt.batchProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[string]*BatchResult{}
+	for _, id := range []*string{batch.OutputFileID, batch.ErrorFileID} {
+		if id == nil || *id == "" {
+			continue
+		}
+
+		if err := gpt.readBatchFile(provider, *id, results); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// readBatchFile downloads the output or error file of batch, and adds its results
+func (gpt *Client) readBatchFile(provider BatchProvider, id string, results map[string]*BatchResult) error {
+	ctx, cancel := context.WithTimeout(countRetries(context.Background()), gpt.timeout)
+	defer cancel()
+
+	r, err := provider.FileContent(ctx, id)
+	if err != nil {
+		return gpt.classify(ctx, err)
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxBatchLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var line batchOutput
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("invalid batch output in file %s: %w", id, err)
+		}
+
+		result := &BatchResult{CustomID: line.CustomID}
+		switch {
+		case line.Error != nil:
+			result.Err = fmt.Errorf("%s: %s", line.Error.Code, line.Error.Message)
+		case line.Response == nil:
+			result.Err = fmt.Errorf("no response returned")
+		case line.Response.StatusCode >= 400:
+			var body openai.ErrorResponse
+			if err := json.Unmarshal(line.Response.Body, &body); err != nil || body.Error == nil {
+				result.Err = fmt.Errorf("status code: %d", line.Response.StatusCode)
+			} else {
+				body.Error.HTTPStatusCode = line.Response.StatusCode
+				// the request in the batch is not retried, so that the error is classified without retries
+				result.Err = gpt.classify(context.Background(), body.Error)
+			}
+		default:
+			if err := json.Unmarshal(line.Response.Body, &result.Response); err != nil {
+				result.Err = err
+			}
+		}
+		results[line.CustomID] = result
+	}
+
+	return scanner.Err()
+}
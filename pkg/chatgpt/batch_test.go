@@ -0,0 +1,197 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// batchServer is a fake of files and batches API of OpenAI, files are content of files by ID
+type batchServer struct {
+	t     *testing.T
+	files map[string]string
+
+	// uploaded is the content of uploaded input file
+	uploaded string
+	// created is the request to create the batch
+	created openai.CreateBatchRequest
+}
+
+// newBatchServer starts a fake server of batch API, it returns the server and the client of it
+func newBatchServer(t *testing.T, files map[string]string) (*batchServer, *Client) {
+	fake := &batchServer{t: t, files: files}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, NewClientWithBaseURL("test", server.URL+"/v1", "gpt-4o", time.Minute)
+}
+
+// ServeHTTP serves upload of input file, creation of batch and download of files
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/files":
+		if purpose := r.FormValue("purpose"); purpose != "batch" {
+			s.t.Errorf("purpose = %q, want batch", purpose)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			s.t.Fatalf("no file is uploaded: %s", err)
+		}
+		raw, _ := io.ReadAll(file)
+		s.uploaded = string(raw)
+		_, _ = io.WriteString(w, `{"id":"file-input","object":"file","purpose":"batch"}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/batches":
+		if err := json.NewDecoder(r.Body).Decode(&s.created); err != nil {
+			s.t.Fatalf("invalid request to create batch: %s", err)
+		}
+		_, _ = io.WriteString(w, `{"id":"batch_1","object":"batch","input_file_id":"file-input","status":"validating"}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/files/") && strings.HasSuffix(r.URL.Path, "/content"):
+		content, ok := s.files[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/content")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"error":{"message":"No such File object","type":"invalid_request_error"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	default:
+		s.t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSubmitBatch(t *testing.T) {
+	fake, client := newBatchServer(t, nil)
+
+	requests := []BatchRequest{
+		{CustomID: "record-0", Request: client.QuestionRequest("role", "first", "")},
+		{CustomID: "record-2", Request: client.QuestionRequest("role", "third", "")},
+	}
+	batch, err := client.SubmitBatch(requests, map[string]interface{}{"subcommand": "classify"})
+	if err != nil {
+		t.Fatalf("SubmitBatch() returned error: %s", err)
+	}
+	if batch.ID != "batch_1" {
+		t.Errorf("ID = %q, want batch_1", batch.ID)
+	}
+
+	if fake.created.InputFileID != "file-input" || fake.created.Endpoint != openai.BatchEndpointChatCompletions || fake.created.CompletionWindow != "24h" {
+		t.Errorf("created batch = %+v, want chat completions of file-input in 24h", fake.created)
+	}
+	if fake.created.Metadata["subcommand"] != "classify" {
+		t.Errorf("metadata = %v, want subcommand classify", fake.created.Metadata)
+	}
+
+	lines := strings.Split(strings.TrimSpace(fake.uploaded), "\n")
+	if len(lines) != len(requests) {
+		t.Fatalf("uploaded %d lines, want %d:\n%s", len(lines), len(requests), fake.uploaded)
+	}
+	for i, line := range lines {
+		var got struct {
+			CustomID string                       `json:"custom_id"`
+			Method   string                       `json:"method"`
+			URL      string                       `json:"url"`
+			Body     openai.ChatCompletionRequest `json:"body"`
+		}
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("invalid line %d: %s", i, err)
+		}
+		if got.CustomID != requests[i].CustomID || got.Method != http.MethodPost || got.URL != "/v1/chat/completions" {
+			t.Errorf("line %d = %s, want POST of %s to chat completions", i, line, requests[i].CustomID)
+		}
+		if got.Body.Model != "gpt-4o" || got.Body.Messages[len(got.Body.Messages)-1].Content != requests[i].Request.Messages[len(requests[i].Request.Messages)-1].Content {
+			t.Errorf("body of line %d = %+v, want %+v", i, got.Body, requests[i].Request)
+		}
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	output := strings.Join([]string{
+		`{"id":"req_0","custom_id":"record-0","response":{"status_code":200,"body":{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"positive"},"finish_reason":"stop"}]}},"error":null}`,
+		``,
+		`{"id":"req_1","custom_id":"record-1","response":{"status_code":200,"body":{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_0","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":"tool_calls"}]}},"error":null}`,
+	}, "\n")
+	errs := strings.Join([]string{
+		`{"id":"req_2","custom_id":"record-2","response":{"status_code":400,"body":{"error":{"message":"This model's maximum context length is 128000 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}},"error":null}`,
+		`{"id":"req_3","custom_id":"record-3","response":{"status_code":500,"body":"upstream failed"},"error":null}`,
+		`{"id":"req_4","custom_id":"record-4","response":null,"error":{"code":"batch_expired","message":"This request could not be executed before the completion window expired."}}`,
+		`{"id":"req_5","custom_id":"record-5","response":null,"error":null}`,
+	}, "\n")
+	_, client := newBatchServer(t, map[string]string{"file-output": output, "file-error": errs, "file-broken": "not json\n"})
+
+	outputID, errorID := "file-output", "file-error"
+	results, err := client.BatchResults(openai.Batch{OutputFileID: &outputID, ErrorFileID: &errorID})
+	if err != nil {
+		t.Fatalf("BatchResults() returned error: %s", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("BatchResults() returned %d results, want 6: %v", len(results), results)
+	}
+	for id, result := range results {
+		if result.CustomID != id {
+			t.Errorf("result of %s has custom ID %s", id, result.CustomID)
+		}
+	}
+
+	if answer, err := results["record-0"].Answer(); err != nil || answer != "positive" {
+		t.Errorf("Answer() of record-0 = %q, %v, want positive", answer, err)
+	}
+
+	called, err := results["record-1"].FunctionCalls(nil)
+	if err != nil || len(called) != 1 || called[0].Name != "f" {
+		t.Errorf("FunctionCalls() of record-1 = %v, %v, want a call of f", called, err)
+	}
+
+	failures := map[string]string{
+		"record-2": "context length exceeded, reduce the input",
+		"record-3": "status code: 500",
+		"record-4": "batch_expired: This request could not be executed before the completion window expired.",
+		"record-5": "no response returned",
+	}
+	for id, want := range failures {
+		if _, err := results[id].Answer(); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("Answer() error of %s = %v, want %q", id, err, want)
+		}
+	}
+
+	t.Run("no files", func(t *testing.T) {
+		empty := ""
+		results, err := client.BatchResults(openai.Batch{OutputFileID: &empty})
+		if err != nil || len(results) != 0 {
+			t.Errorf("BatchResults() = %v, %v, want no results", results, err)
+		}
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		broken := "file-broken"
+		_, err := client.BatchResults(openai.Batch{OutputFileID: &broken})
+		if err == nil || !strings.HasPrefix(err.Error(), "invalid batch output in file file-broken") {
+			t.Errorf("BatchResults() error = %v, want invalid batch output", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		missing := "file-missing"
+		_, err := client.BatchResults(openai.Batch{OutputFileID: &missing})
+		if err == nil || !strings.HasPrefix(err.Error(), "not found") {
+			t.Errorf("BatchResults() error = %v, want not found", err)
+		}
+	})
+}
+
+func TestBatchNotSupported(t *testing.T) {
+	client := NewClientWithProvider(&ollamaProvider{}, "llama3", time.Minute)
+
+	if _, err := client.SubmitBatch(nil, nil); !errors.Is(err, ErrBatchNotSupported) {
+		t.Errorf("SubmitBatch() error = %v, want %v", err, ErrBatchNotSupported)
+	}
+	if _, err := client.BatchResults(openai.Batch{}); !errors.Is(err, ErrBatchNotSupported) {
+		t.Errorf("BatchResults() error = %v, want %v", err, ErrBatchNotSupported)
+	}
+}
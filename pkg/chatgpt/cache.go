@@ -0,0 +1,50 @@
+package chatgpt
+
+import (
+	"github.com/HatsuneMiku3939/pipegpt/pkg/cache"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// cacheKey is the content which identifies a response in cache
+type cacheKey struct {
+	Endpoint string                       `json:"endpoint"`
+	Request  openai.ChatCompletionRequest `json:"request"`
+}
+
+// SetCache sets the cache of responses, nil disables caching.
+// if refresh is true, cached responses are ignored but new responses are still cached.
+func (gpt *Client) SetCache(c *cache.Cache, refresh bool) {
+	gpt.cache = c
+	gpt.refresh = refresh
+}
+
+// lookup decodes cached response of given request into resp, and returns false if it is not cached.
+// failure of cache is treated as a miss, so that it never fails the question.
+func (gpt *Client) lookup(req openai.ChatCompletionRequest, resp *openai.ChatCompletionResponse) bool {
+	if gpt.cache == nil || gpt.refresh {
+		return false
+	}
+
+	key, err := cache.Key(cacheKey{Endpoint: gpt.endpoint, Request: req})
+	if err != nil {
+		return false
+	}
+
+	found, err := gpt.cache.Get(key, resp)
+	return err == nil && found
+}
+
+// store caches response of given request, failure of cache is ignored
+func (gpt *Client) store(req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) {
+	if gpt.cache == nil {
+		return
+	}
+
+	key, err := cache.Key(cacheKey{Endpoint: gpt.endpoint, Request: req})
+	if err != nil {
+		return
+	}
+
+	_ = gpt.cache.Put(key, resp)
+}
@@ -3,86 +3,471 @@ package chatgpt
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/schema"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// maxFunctionCallAttempts is the maximum number of attempts to get function call arguments which satisfy the schema
+const maxFunctionCallAttempts = 3
+
+// choices of function to call, other than a name of function
+const (
+	// FunctionCallAuto lets the model choose whether to call a function and which one
+	FunctionCallAuto = "auto"
+	// FunctionCallNone prevents the model from calling a function
+	FunctionCallNone = "none"
+)
+
+// FunctionCallResult is the function called by the model and its arguments
+type FunctionCallResult struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// TextAnswerError is returned if the model answers in text instead of calling a function
+type TextAnswerError struct {
+	Content string
+}
+
+// Error returns the error message
+func (e *TextAnswerError) Error() string {
+	return "the model answered in text instead of calling a function"
+}
+
 // Chat question to chatgpt with given prompt and user input
 func (gpt *Client) Question(role string, prompt string, input string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), gpt.timeout)
-	defer cancel()
+	answer, err := gpt.Ask(role, prompt, input)
+	if err != nil {
+		return "", err
+	}
 
-	// create chat completion
-	resp, err := gpt.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: gpt.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: role,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("%s\n---\n%s", prompt, input),
-				},
-			},
-		},
-	)
+	return answer.Content, nil
+}
+
+// Ask question to chatgpt with given prompt and user input, and returns the answer with metadata of the response
+func (gpt *Client) Ask(role string, prompt string, input string) (*Answer, error) {
+	resp, cached, err := gpt.cachedCompletion(gpt.QuestionRequest(role, prompt, input))
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := newAnswer(resp)
 	if err != nil {
+		return nil, err
+	}
+
+	answer.Cached = cached
+	return answer, nil
+}
+
+// QuestionStream question to chatgpt with given prompt and user input, and writes the answer to w as it arrives.
+// cached answer is written at once.
+func (gpt *Client) QuestionStream(role string, prompt string, input string, w io.Writer) (string, error) {
+	answer, err := gpt.AskStream(role, prompt, input, w)
+	if answer == nil {
 		return "", err
 	}
 
-	// return first choice
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned")
+	return answer.Content, err
+}
+
+// AskStream is the same as QuestionStream, but returns the answer with metadata of the response.
+// the answer written so far is returned with the error if the stream is failed.
+func (gpt *Client) AskStream(role string, prompt string, input string, w io.Writer) (*Answer, error) {
+	req := gpt.QuestionRequest(role, prompt, input)
+
+	var cached openai.ChatCompletionResponse
+	if gpt.lookup(req, &cached) {
+		answer, err := newAnswer(cached)
+		if err != nil {
+			return nil, err
+		}
+		answer.Cached = true
+
+		_, err = io.WriteString(w, answer.Content)
+		return answer, err
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	answer, err := gpt.stream(req, w)
+	if err != nil {
+		return answer, err
+	}
+
+	gpt.store(req, answer.response())
+	return answer, nil
 }
 
-// FunctionCall question to OpenAI in function calling format with given prompt and user input, and function definitions
-func (gpt *Client) FunctionCall(role string, prompt string, input string, funcs []openai.FunctionDefinition) (map[string]interface{}, error) {
-	// create chat completion
-	ctx, cancel := context.WithTimeout(context.Background(), gpt.timeout)
-	defer cancel()
+// Chat continues the conversation with given messages, and returns the answer
+func (gpt *Client) Chat(msgs []openai.ChatCompletionMessage) (string, error) {
+	resp, err := gpt.completion(gpt.request(msgs))
+	if err != nil {
+		return "", err
+	}
 
-	// create chat completion
-	resp, err := gpt.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: gpt.model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: role,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("%s\n---\n%s", prompt, input),
-				},
-			},
-			Functions: funcs,
-		},
-	)
+	answer, err := newAnswer(resp)
+	if err != nil {
+		return "", err
+	}
+
+	return answer.Content, nil
+}
+
+// ChatWithTools continues the conversation with given messages and functions as tools, and returns the answer of the model.
+// the answer has tool calls if the model calls functions, otherwise it has the answer in content.
+func (gpt *Client) ChatWithTools(msgs []openai.ChatCompletionMessage, funcs []openai.FunctionDefinition) (*Answer, error) {
+	req := gpt.request(msgs)
+	for i := range funcs {
+		req.Tools = append(req.Tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &funcs[i]})
+	}
+
+	resp, err := gpt.completion(req)
 	if err != nil {
 		return nil, err
 	}
 
-	// return first choice if function call arguments are valid
+	answer, err := newAnswer(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// a function call of legacy format is taken as a tool call, so that it can be answered by a tool message
+	if message := resp.Choices[0].Message; len(answer.ToolCalls) == 0 && message.FunctionCall != nil {
+		answer.ToolCalls = []openai.ToolCall{{ID: "call_0", Type: openai.ToolTypeFunction, Function: *message.FunctionCall}}
+	}
+
+	return answer, nil
+}
+
+// ChatStream continues the conversation with given messages, and writes the answer to w as it arrives
+func (gpt *Client) ChatStream(msgs []openai.ChatCompletionMessage, w io.Writer) (string, error) {
+	answer, err := gpt.stream(gpt.request(msgs), w)
+	return answer.Content, err
+}
+
+// FunctionCall question to OpenAI in function calling format with given prompt and user input, and function definitions.
+// functions are given as tools, and the model may call several of them at once.
+// call chooses the function to call, one of FunctionCallAuto, FunctionCallNone or a name of the functions, empty means auto.
+// arguments are validated against parameters of the function, and the model is asked again with validation errors
+// until it returns valid arguments or maxFunctionCallAttempts is reached.
+// *TextAnswerError is returned if the model answers in text instead of calling a function.
+// the answer has metadata of the responses, and tokens of all attempts are summed up in its usage.
+func (gpt *Client) FunctionCall(role string, prompt string, input string, funcs []openai.FunctionDefinition, call string) ([]*FunctionCallResult, *Answer, error) {
+	original := gpt.FunctionCallRequest(role, prompt, input, funcs, call)
+	req, msgs := original, original.Messages
+
+	// only the valid response is cached by the original request, so that invalid attempts are never replayed
+	var resp openai.ChatCompletionResponse
+	cached := gpt.lookup(original, &resp)
+
+	answer := &Answer{}
+	var invalid error
+	for attempt := 0; attempt < maxFunctionCallAttempts; attempt++ {
+		if !cached {
+			var err error
+			if resp, err = gpt.completion(req); err != nil {
+				return nil, answer, err
+			}
+		}
+		if attempted, err := newAnswer(resp); err == nil {
+			attempted.Cached = cached
+			answer.Add(attempted)
+		}
+
+		results, err := ValidateFunctionCalls(resp, funcs)
+		if err == nil {
+			if !cached {
+				gpt.store(original, resp)
+			}
+			return results, answer, nil
+		}
+		cached = false
+
+		// a text answer is not an invalid call, it is returned as is
+		var text *TextAnswerError
+		if errors.As(err, &text) {
+			return nil, answer, err
+		}
+		invalid = err
+
+		// ask again with the invalid calls and their errors, previous attempts are not kept to save tokens
+		req.Messages = append(msgs[:len(msgs):len(msgs)], openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: retryMessage(resp, err),
+		})
+	}
+
+	return nil, answer, fmt.Errorf("invalid function call after %d attempts: %w", maxFunctionCallAttempts, invalid)
+}
+
+// QuestionRequest builds chat completion request of the question with given prompt and user input
+func (gpt *Client) QuestionRequest(role string, prompt string, input string) openai.ChatCompletionRequest {
+	return gpt.request(messages(role, prompt, input))
+}
+
+// FunctionCallRequest builds chat completion request of the question with functions as tools,
+// call chooses the function to call in the same way as FunctionCall
+func (gpt *Client) FunctionCallRequest(role string, prompt string, input string, funcs []openai.FunctionDefinition, call string) openai.ChatCompletionRequest {
+	req := gpt.request(messages(role, prompt, input))
+	for i := range funcs {
+		req.Tools = append(req.Tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &funcs[i]})
+	}
+
+	switch call {
+	case "":
+	case FunctionCallAuto, FunctionCallNone:
+		req.ToolChoice = call
+	default:
+		req.ToolChoice = openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: call}}
+	}
+
+	return req
+}
+
+// functionCalls returns function calls of first choice of the response in order,
+// a function call of legacy format is also accepted for providers which return it
+func functionCalls(resp openai.ChatCompletionResponse) ([]*FunctionCallResult, error) {
 	if len(resp.Choices) == 0 {
 		return nil, fmt.Errorf("no choices returned")
 	}
 
-	if resp.Choices[0].Message.FunctionCall == nil {
+	message := resp.Choices[0].Message
+	calls := []openai.FunctionCall{}
+	for _, tool := range message.ToolCalls {
+		calls = append(calls, tool.Function)
+	}
+	if len(calls) == 0 && message.FunctionCall != nil {
+		calls = append(calls, *message.FunctionCall)
+	}
+
+	if len(calls) == 0 {
+		if strings.TrimSpace(message.Content) != "" {
+			return nil, &TextAnswerError{Content: message.Content}
+		}
 		return nil, fmt.Errorf("no function call returned")
 	}
 
-	var args map[string]interface{}
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.FunctionCall.Arguments), &args); err != nil {
+	results := make([]*FunctionCallResult, 0, len(calls))
+	for _, call := range calls {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+			return nil, fmt.Errorf("arguments of function %s are not a JSON object: %w", call.Name, err)
+		}
+
+		results = append(results, &FunctionCallResult{Name: call.Name, Arguments: args})
+	}
+
+	return results, nil
+}
+
+// ValidateFunctionCalls returns function calls of first choice of the response,
+// if their arguments satisfy parameters of the called functions in given function definitions
+func ValidateFunctionCalls(resp openai.ChatCompletionResponse, funcs []openai.FunctionDefinition) ([]*FunctionCallResult, error) {
+	results, err := functionCalls(resp)
+	if err != nil {
 		return nil, err
 	}
 
-	return args, nil
+	for _, result := range results {
+		if err := validateArguments(result, funcs); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// validateArguments checks if arguments of the function call satisfy parameters of the called function
+func validateArguments(result *FunctionCallResult, funcs []openai.FunctionDefinition) error {
+	for _, f := range funcs {
+		if f.Name != result.Name {
+			continue
+		}
+		if f.Parameters == nil {
+			return nil
+		}
+
+		def, err := schema.FromParameters(f.Parameters)
+		if err != nil {
+			return fmt.Errorf("parameters of function %s: %w", result.Name, err)
+		}
+		if err := schema.Validate(def, result.Arguments); err != nil {
+			return fmt.Errorf("arguments of function %s do not match its parameters: %w", result.Name, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown function %s is called", result.Name)
+}
+
+// retryMessage returns the message to ask function call again, with the invalid calls of the response and the error
+func retryMessage(resp openai.ChatCompletionResponse, err error) string {
+	calls := []string{}
+	if len(resp.Choices) > 0 {
+		message := resp.Choices[0].Message
+		for _, tool := range message.ToolCalls {
+			calls = append(calls, fmt.Sprintf("%s(%s)", tool.Function.Name, tool.Function.Arguments))
+		}
+		if message.FunctionCall != nil {
+			calls = append(calls, fmt.Sprintf("%s(%s)", message.FunctionCall.Name, message.FunctionCall.Arguments))
+		}
+	}
+
+	if len(calls) == 0 {
+		return fmt.Sprintf("the function call is invalid: %s\nCall the function again with arguments which satisfy its parameters.", err)
+	}
+
+	return fmt.Sprintf("the function call %s is invalid: %s\nCall the function again with arguments which satisfy its parameters.", strings.Join(calls, ", "), err)
+}
+
+// completion creates chat completion of given request
+func (gpt *Client) completion(req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(countRetries(context.Background()), gpt.timeout)
+	defer cancel()
+
+	resp, err := gpt.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return resp, gpt.classify(ctx, err)
+	}
+
+	gpt.reportUsage(resp.Model, resp.Usage)
+	return resp, nil
+}
+
+// cachedCompletion returns cached response of given request if exists, otherwise creates chat completion and caches it.
+// it also returns whether the response is taken from cache.
+func (gpt *Client) cachedCompletion(req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, bool, error) {
+	var resp openai.ChatCompletionResponse
+	if gpt.lookup(req, &resp) {
+		return resp, true, nil
+	}
+
+	resp, err := gpt.completion(req)
+	if err != nil {
+		return resp, false, err
+	}
+
+	gpt.store(req, resp)
+	return resp, false, nil
+}
+
+// stream creates chat completion stream of given request, and writes the answer to w as it arrives.
+// the answer is never nil, it has the content written so far if the stream is failed.
+func (gpt *Client) stream(req openai.ChatCompletionRequest, w io.Writer) (*Answer, error) {
+	answer := &Answer{Model: gpt.model}
+
+	ctx, cancel := context.WithTimeout(countRetries(context.Background()), gpt.timeout)
+	defer cancel()
+
+	// create chat completion stream
+	stream, err := gpt.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return answer, gpt.classify(ctx, err)
+	}
+	defer stream.Close()
+
+	// write deltas of first choice until the stream is finished
+	var content strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			answer.Content = content.String()
+			return answer, gpt.classify(ctx, err)
+		}
+
+		// metadata may come in any chunk, usage is sent in the last chunk which has no choices
+		if resp.Model != "" {
+			answer.Model = resp.Model
+		}
+		if resp.Usage != nil {
+			answer.Usage = *resp.Usage
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+		if resp.Choices[0].FinishReason != "" {
+			answer.FinishReason = resp.Choices[0].FinishReason
+		}
+
+		delta := resp.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if _, err := io.WriteString(w, delta); err != nil {
+			answer.Content = content.String()
+			return answer, err
+		}
+	}
+
+	answer.Content = content.String()
+	if answer.FinishReason == "" {
+		answer.FinishReason = openai.FinishReasonStop
+	}
+
+	gpt.reportUsage(answer.Model, answer.Usage)
+	return answer, nil
+}
+
+// request builds chat completion request of given messages with model parameters of the client
+func (gpt *Client) request(msgs []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:    gpt.model,
+		Messages: msgs,
+		Stop:     gpt.params.Stop,
+		Seed:     gpt.params.Seed,
+	}
+
+	if gpt.params.Temperature != nil {
+		req.Temperature = *gpt.params.Temperature
+		// zero is omitted from the request by omitempty, and the default of the API (1 for OpenAI) is used,
+		// so that the smallest non-zero value is sent instead, which is as deterministic as zero
+		if req.Temperature == 0 {
+			req.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+	if gpt.params.TopP != nil {
+		req.TopP = *gpt.params.TopP
+	}
+	if gpt.params.MaxTokens != nil {
+		req.MaxTokens = *gpt.params.MaxTokens
+	}
+	if gpt.params.PresencePenalty != nil {
+		req.PresencePenalty = *gpt.params.PresencePenalty
+	}
+	if gpt.params.FrequencyPenalty != nil {
+		req.FrequencyPenalty = *gpt.params.FrequencyPenalty
+	}
+
+	return req
+}
+
+// messages builds system and user messages from given role, prompt and user input
+func messages(role string, prompt string, input string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: role,
+		},
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: UserMessage(prompt, input),
+		},
+	}
+}
+
+// UserMessage builds user message content from given prompt and user input, the prompt is used as it is if input is empty
+func UserMessage(prompt string, input string) string {
+	if input == "" {
+		return prompt
+	}
+
+	return fmt.Sprintf("%s\n---\n%s", prompt, input)
 }
@@ -0,0 +1,330 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/cache"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// scriptedProvider answers each request with the next message of the script, and records the requests
+type scriptedProvider struct {
+	script   []openai.ChatCompletionMessage
+	requests []openai.ChatCompletionRequest
+}
+
+// CreateChatCompletion answers the next message of the script
+func (p *scriptedProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.requests = append(p.requests, req)
+	if len(p.script) == 0 {
+		return openai.ChatCompletionResponse{}, errors.New("script is over")
+	}
+
+	message := p.script[0]
+	p.script = p.script[1:]
+
+	return openai.ChatCompletionResponse{
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{{Message: message, FinishReason: openai.FinishReasonToolCalls}},
+		Usage:   openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+// CreateChatCompletionStream is not used by function calls
+func (p *scriptedProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	return nil, errors.New("stream is not supported")
+}
+
+// call makes a message of the model which calls the function with given arguments
+func call(name string, args string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleAssistant,
+		ToolCalls: []openai.ToolCall{{
+			ID:       "call_0",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: name, Arguments: args},
+		}},
+	}
+}
+
+// text makes a message of the model which answers in text
+func text(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+}
+
+// translateFunc is the function of tests, which requires text and lang in en or ja
+var translateFunc = openai.FunctionDefinition{
+	Name: "translate",
+	Parameters: json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"text": {"type": "string"},
+			"lang": {"type": "string", "enum": ["en", "ja"]}
+		},
+		"required": ["text", "lang"]
+	}`),
+}
+
+func TestFunctionCall(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []openai.ChatCompletionMessage
+		// asks are the retry messages given to the model in order
+		asks []string
+		args map[string]interface{}
+		err  string
+	}{
+		{
+			name:   "valid at first",
+			script: []openai.ChatCompletionMessage{call("translate", `{"text":"hello","lang":"ja"}`)},
+			args:   map[string]interface{}{"text": "hello", "lang": "ja"},
+		},
+		{
+			name: "valid after re-asked",
+			script: []openai.ChatCompletionMessage{
+				call("translate", `{"text":"hello"}`),
+				call("translate", `{"text":"hello","lang":"fr"}`),
+				call("translate", `{"text":"hello","lang":"en"}`),
+			},
+			asks: []string{
+				`the function call translate({"text":"hello"}) is invalid: arguments of function translate do not match its parameters: $.lang: is required`,
+				`the function call translate({"text":"hello","lang":"fr"}) is invalid: arguments of function translate do not match its parameters: $.lang: must be one of en, ja, got fr`,
+			},
+			args: map[string]interface{}{"text": "hello", "lang": "en"},
+		},
+		{
+			name: "unknown function and broken arguments",
+			script: []openai.ChatCompletionMessage{
+				call("summarize", `{"text":"hello"}`),
+				call("translate", `{"text":`),
+				call("translate", `{"text":"hello","lang":"ja"}`),
+			},
+			asks: []string{
+				`the function call summarize({"text":"hello"}) is invalid: unknown function summarize is called`,
+				`the function call translate({"text":) is invalid: arguments of function translate are not a JSON object: `,
+			},
+			args: map[string]interface{}{"text": "hello", "lang": "ja"},
+		},
+		{
+			name: "invalid after max attempts",
+			script: []openai.ChatCompletionMessage{
+				call("translate", `{}`),
+				call("translate", `{"text":1,"lang":"ja"}`),
+				call("translate", `{"lang":"ja"}`),
+				call("translate", `{"text":"never reached","lang":"ja"}`),
+			},
+			asks: []string{
+				`the function call translate({}) is invalid: `,
+				`the function call translate({"text":1,"lang":"ja"}) is invalid: `,
+			},
+			err: "invalid function call after 3 attempts: arguments of function translate do not match its parameters: $.text: is required",
+		},
+		{
+			name:   "text answer is not re-asked",
+			script: []openai.ChatCompletionMessage{text("I can not translate it.")},
+			err:    "the model answered in text instead of calling a function",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &scriptedProvider{script: tt.script}
+			client := NewClientWithProvider(provider, "gpt-4o", time.Minute)
+
+			results, answer, err := client.FunctionCall("role", "prompt", "input", []openai.FunctionDefinition{translateFunc}, "translate")
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("FunctionCall() error = %v, want %q", err, tt.err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("FunctionCall() returned error: %s", err)
+				}
+				if len(results) != 1 || results[0].Name != "translate" || !reflect.DeepEqual(results[0].Arguments, tt.args) {
+					t.Errorf("results = %+v, want translate of %v", results, tt.args)
+				}
+			}
+
+			// tokens of all attempts are summed up
+			attempts := len(provider.requests)
+			if attempts != len(tt.asks)+1 {
+				t.Errorf("model is called %d times, want %d", attempts, len(tt.asks)+1)
+			}
+			if answer.Usage.TotalTokens != 15*attempts {
+				t.Errorf("total tokens = %d, want %d of %d attempts", answer.Usage.TotalTokens, 15*attempts, attempts)
+			}
+
+			// each attempt is given the original messages and only the last retry message
+			for i, req := range provider.requests {
+				if req.ToolChoice == nil || len(req.Tools) != 1 {
+					t.Errorf("request %d has tools %+v and choice %+v", i, req.Tools, req.ToolChoice)
+				}
+
+				original := provider.requests[0].Messages
+				if i == 0 {
+					continue
+				}
+				if len(req.Messages) != len(original)+1 || !reflect.DeepEqual(req.Messages[:len(original)], original) {
+					t.Fatalf("messages of attempt %d = %+v, want original messages and a retry message", i+1, req.Messages)
+				}
+				ask := req.Messages[len(original)]
+				if ask.Role != openai.ChatMessageRoleUser || !strings.HasPrefix(ask.Content, tt.asks[i-1]) {
+					t.Errorf("retry message %d = %q, want %q", i, ask.Content, tt.asks[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestQuestionCached(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		_, _ = io.WriteString(w, `{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	ask := func(refresh bool) *Answer {
+		client := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+		client.SetCache(cache.New(dir, time.Hour), refresh)
+
+		answer, err := client.Ask("role", "prompt", "input")
+		if err != nil || answer.Content != "hello" {
+			t.Fatalf("Ask() = %+v, %v, want hello", answer, err)
+		}
+		return answer
+	}
+
+	if answer := ask(false); answer.Cached || count != 1 {
+		t.Errorf("first question is cached = %v, server is called %d times, want 1", answer.Cached, count)
+	}
+	if answer := ask(false); !answer.Cached || count != 1 {
+		t.Errorf("second question is cached = %v, server is called %d times, want served from cache", answer.Cached, count)
+	}
+	if answer := ask(true); answer.Cached || count != 2 {
+		t.Errorf("refreshed question is cached = %v, server is called %d times, want 2", answer.Cached, count)
+	}
+
+	client := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+	client.SetCache(cache.New(dir, time.Hour), false)
+	if content, err := client.Question("role", "prompt", "input"); err != nil || content != "hello" || count != 2 {
+		t.Errorf("Question() = %q, %v, server is called %d times, want served from cache", content, err, count)
+	}
+}
+
+func TestFunctionCallCached(t *testing.T) {
+	c := cache.New(t.TempDir(), time.Hour)
+	ask := func(script ...openai.ChatCompletionMessage) (*scriptedProvider, []*FunctionCallResult, *Answer, error) {
+		provider := &scriptedProvider{script: script}
+		client := NewClientWithProvider(provider, "gpt-4o", time.Minute)
+		client.SetCache(c, false)
+
+		results, answer, err := client.FunctionCall("role", "prompt", "input", []openai.FunctionDefinition{translateFunc}, "translate")
+		return provider, results, answer, err
+	}
+
+	// invalid attempts are not cached, so that the next run asks the model again
+	if _, _, _, err := ask(call("translate", `{}`), call("translate", `{"text":1}`), call("translate", `{"lang":"ja"}`)); err == nil {
+		t.Fatalf("FunctionCall() of invalid calls returned no error")
+	}
+	if stats, _ := c.Stats(); stats.Entries != 0 {
+		t.Errorf("%d entries are cached, want no invalid responses", stats.Entries)
+	}
+
+	// the valid response after re-asked is cached by the original request
+	provider, _, _, err := ask(call("translate", `{"text":"hello"}`), call("translate", `{"text":"hello","lang":"ja"}`))
+	if err != nil || len(provider.requests) != 2 {
+		t.Fatalf("FunctionCall() = %v after %d requests, want valid after 2 requests", err, len(provider.requests))
+	}
+	if stats, _ := c.Stats(); stats.Entries != 1 {
+		t.Errorf("%d entries are cached, want only the valid response", stats.Entries)
+	}
+
+	provider, results, answer, err := ask()
+	if err != nil || len(provider.requests) != 0 || !answer.Cached {
+		t.Fatalf("FunctionCall() = %v after %d requests, want served from cache", err, len(provider.requests))
+	}
+	if want := map[string]interface{}{"text": "hello", "lang": "ja"}; !reflect.DeepEqual(results[0].Arguments, want) {
+		t.Errorf("arguments = %v, want %v", results[0].Arguments, want)
+	}
+}
+
+func TestStructuredOutputCached(t *testing.T) {
+	c := cache.New(t.TempDir(), time.Hour)
+	format := &OutputFormat{Name: "lang", Schema: json.RawMessage(`{"type":"object","properties":{"lang":{"type":"string"}},"required":["lang"]}`)}
+	ask := func(script ...openai.ChatCompletionMessage) (*scriptedProvider, interface{}, *Answer, error) {
+		provider := &scriptedProvider{script: script}
+		client := NewClientWithProvider(provider, "gpt-4o", time.Minute)
+		client.SetCache(c, false)
+
+		output, answer, err := client.StructuredOutput("role", "prompt", "input", format)
+		return provider, output, answer, err
+	}
+
+	provider, _, _, err := ask(text(`not json`), text(`{"language":"ja"}`), text(`{"lang":"ja"}`))
+	if err != nil || len(provider.requests) != 3 {
+		t.Fatalf("StructuredOutput() = %v after %d requests, want valid after 3 requests", err, len(provider.requests))
+	}
+	if stats, _ := c.Stats(); stats.Entries != 1 {
+		t.Errorf("%d entries are cached, want only the valid response", stats.Entries)
+	}
+
+	provider, output, answer, err := ask()
+	if err != nil || len(provider.requests) != 0 || !answer.Cached {
+		t.Fatalf("StructuredOutput() = %v after %d requests, want served from cache", err, len(provider.requests))
+	}
+	if want := map[string]interface{}{"lang": "ja"}; !reflect.DeepEqual(output, want) {
+		t.Errorf("output = %v, want %v", output, want)
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature *float32
+		sent        bool
+	}{
+		{name: "not set", sent: false},
+		{name: "zero", temperature: new(float32), sent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("request is not JSON: %s", err)
+				}
+				_, _ = io.WriteString(w, `{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`)
+			}))
+			defer server.Close()
+
+			client := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+			client.SetParameters(Parameters{Temperature: tt.temperature})
+			if _, err := client.Question("role", "prompt", "input"); err != nil {
+				t.Fatalf("Question() returned error: %s", err)
+			}
+
+			// zero is sent as the smallest non-zero value, as zero is omitted from the request
+			temperature, sent := body["temperature"]
+			if sent != tt.sent {
+				t.Fatalf("temperature is sent = %v, want %v", sent, tt.sent)
+			}
+			if sent && (temperature.(float64) <= 0 || temperature.(float64) > 1e-6) {
+				t.Errorf("temperature = %v, want the smallest non-zero value", temperature)
+			}
+		})
+	}
+}
@@ -1,28 +1,65 @@
 package chatgpt
 
 import (
+	"fmt"
+	"net/http"
 	"time"
 
+	"github.com/HatsuneMiku3939/pipegpt/pkg/cache"
+
 	openai "github.com/sashabaranov/go-openai"
 )
 
 // Client is a client for ChatGPT client
 type Client struct {
-	client  *openai.Client
+	client  Provider
 	timeout time.Duration
 	model   string
+	params  Parameters
+
+	// transport retries failed requests, nil if the provider is given by the caller
+	transport *retryTransport
+
+	// endpoint identifies the provider and its endpoint, it is a part of cache key
+	endpoint string
+	// cache stores responses of questions, nil means responses are not cached
+	cache   *cache.Cache
+	refresh bool
+
+	// usage is called with usage of each request sent to the model, nil means usage is not reported
+	usage func(model string, usage openai.Usage)
+}
+
+// Parameters are model parameters of chat completion, nil or empty means the default of the model
+type Parameters struct {
+	Temperature      *float32
+	TopP             *float32
+	MaxTokens        *int
+	PresencePenalty  *float32
+	FrequencyPenalty *float32
+	Stop             []string
+	Seed             *int
 }
 
 // NewClient creates a new GPTClient
 func NewClient(apiKey string, model string, timeout time.Duration) *Client {
-	// create client
-	client := openai.NewClient(apiKey)
+	return NewClientWithBaseURL(apiKey, "", model, timeout)
+}
 
-	return &Client{
-		client:  client,
-		timeout: timeout,
-		model:   model,
+// NewClientWithBaseURL creates a new GPTClient for OpenAI compatible API served at baseURL.
+// the default base URL of OpenAI API is used if baseURL is empty.
+func NewClientWithBaseURL(apiKey string, baseURL string, model string, timeout time.Duration) *Client {
+	// create client
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
 	}
+
+	transport := newRetryTransport()
+	config.HTTPClient = &http.Client{Transport: transport}
+
+	client := openai.NewClientWithConfig(config)
+	return newClientWithTransport(&openAIProvider{client: client, streamUsage: true}, transport, "openai "+config.BaseURL, model, timeout)
 }
 
 // NewAzureOpenAIClient creates a new GPTClient
@@ -37,10 +74,100 @@ func NewAzureOpenAIClient(apiKey string, endpoint string, model string, modelMap
 		return model
 	}
 
+	transport := newRetryTransport()
+	config.HTTPClient = &http.Client{Transport: transport}
+
 	client := openai.NewClientWithConfig(config)
+	return newClientWithTransport(&openAIProvider{client: client}, transport, fmt.Sprint("azure ", endpoint, " ", modelMapping), model, timeout)
+}
+
+// NewAnthropicClient creates a new GPTClient for Anthropic Messages API.
+// the default base URL of Anthropic API is used if baseURL is empty.
+func NewAnthropicClient(apiKey string, baseURL string, model string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = defaultAnthropicBaseURL
+	}
+
+	transport := newRetryTransport()
+	provider := &anthropicProvider{
+		client:  &http.Client{Transport: transport},
+		baseURL: baseURL,
+		apiKey:  apiKey,
+	}
+	return newClientWithTransport(provider, transport, "anthropic "+baseURL, model, timeout)
+}
+
+// NewOllamaClient creates a new GPTClient for Ollama API.
+// the default base URL of local Ollama server is used if baseURL is empty.
+func NewOllamaClient(baseURL string, model string, timeout time.Duration) *Client {
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+
+	transport := newRetryTransport()
+	provider := &ollamaProvider{
+		client:  &http.Client{Transport: transport},
+		baseURL: baseURL,
+	}
+	return newClientWithTransport(provider, transport, "ollama "+baseURL, model, timeout)
+}
+
+// NewClientWithProvider creates a new GPTClient with given provider
+func NewClientWithProvider(provider Provider, model string, timeout time.Duration) *Client {
 	return &Client{
-		client:  client,
-		timeout: timeout,
-		model:   model,
+		client:   provider,
+		timeout:  timeout,
+		model:    model,
+		endpoint: fmt.Sprintf("%T", provider),
+	}
+}
+
+// newClientWithTransport creates a new GPTClient with given provider, which sends requests through the transport.
+// endpoint identifies the provider and its endpoint.
+func newClientWithTransport(provider Provider, transport *retryTransport, endpoint string, model string, timeout time.Duration) *Client {
+	client := NewClientWithProvider(provider, model, timeout)
+	client.transport = transport
+	client.endpoint = endpoint
+	return client
+}
+
+// SetRetryPolicy sets how failed requests are retried, it has no effect on the client with provider given by the caller
+func (gpt *Client) SetRetryPolicy(policy RetryPolicy) {
+	if gpt.transport != nil {
+		gpt.transport.policy = policy
+	}
+}
+
+// SetParameters sets model parameters used for every request of the client
+func (gpt *Client) SetParameters(params Parameters) {
+	gpt.params = params
+}
+
+// SetUsageHook sets the function called with usage of each request sent to the model, nil disables it.
+// answers from cache are not sent, so that they are not reported.
+// the function may be called concurrently by questions asked concurrently.
+func (gpt *Client) SetUsageHook(hook func(model string, usage openai.Usage)) {
+	gpt.usage = hook
+}
+
+// reportUsage calls the usage hook with usage of the response, model of the client is used if the response has no model
+func (gpt *Client) reportUsage(model string, usage openai.Usage) {
+	if gpt.usage == nil {
+		return
+	}
+	if model == "" {
+		model = gpt.model
 	}
+
+	gpt.usage(model, usage)
+}
+
+// Model returns the model of the client
+func (gpt *Client) Model() string {
+	return gpt.model
+}
+
+// Parameters returns model parameters of the client
+func (gpt *Client) Parameters() Parameters {
+	return gpt.params
 }
@@ -0,0 +1,307 @@
+package chatgpt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultOllamaBaseURL is the base URL of local Ollama server
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// ollamaProvider is a provider of Ollama API
+type ollamaProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+// ollamaRequest is a request of Ollama chat API
+type ollamaRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ollamaMessage        `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Tools    []ollamaTool           `json:"tools,omitempty"`
+	Format   json.RawMessage        `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+// ollamaMessage is a message of Ollama chat API
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	// ToolName is the name of called tool of tool message
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// ollamaTool is a tool definition of Ollama chat API
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaToolCall is a tool call of Ollama chat API
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaResponse is a response of Ollama chat API, a stream consists of responses of partial message
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// CreateChatCompletion creates a chat completion
+func (p *ollamaProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := toOllamaRequest(req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	resp, err := p.post(ctx, body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	var res ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	// Ollama gives no ID of tool call, it is numbered in order
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: res.Message.Content,
+	}
+	finishReason := ollamaFinishReason(res.DoneReason)
+	for i, call := range res.Message.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+			ID:   fmt.Sprintf("call_%d", i),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(call.Function.Arguments),
+			},
+		})
+		finishReason = openai.FinishReasonToolCalls
+	}
+
+	return openai.ChatCompletionResponse{
+		Model: res.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message:      message,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     res.PromptEvalCount,
+			CompletionTokens: res.EvalCount,
+			TotalTokens:      res.PromptEvalCount + res.EvalCount,
+		},
+	}, nil
+}
+
+// CreateChatCompletionStream creates a chat completion stream
+func (p *ollamaProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	body, err := toOllamaRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	body.Stream = true
+
+	resp, err := p.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ollamaStream{
+		body:    resp.Body,
+		decoder: json.NewDecoder(bufio.NewReader(resp.Body)),
+	}, nil
+}
+
+// post sends the request to chat API
+func (p *ollamaProvider) post(ctx context.Context, body ollamaRequest) (*http.Response, error) {
+	return postJSON(ctx, p.client, strings.TrimSuffix(p.baseURL, "/")+"/api/chat", http.Header{}, body, func(body []byte) string {
+		var res ollamaResponse
+		if err := json.Unmarshal(body, &res); err != nil {
+			return ""
+		}
+		return res.Error
+	})
+}
+
+// ollamaStream is a stream of Ollama chat API, it consists of JSON objects separated by newline
+type ollamaStream struct {
+	body    io.ReadCloser
+	decoder *json.Decoder
+	done    bool
+}
+
+// Recv receives next delta
+func (s *ollamaStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if s.done {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+
+	var res ollamaResponse
+	if err := s.decoder.Decode(&res); err != nil {
+		return openai.ChatCompletionStreamResponse{}, err
+	}
+
+	if res.Error != "" {
+		return openai.ChatCompletionStreamResponse{}, &openai.APIError{Message: res.Error}
+	}
+
+	s.done = res.Done
+	var usage *openai.Usage
+	if res.Done {
+		usage = &openai.Usage{
+			PromptTokens:     res.PromptEvalCount,
+			CompletionTokens: res.EvalCount,
+			TotalTokens:      res.PromptEvalCount + res.EvalCount,
+		}
+	}
+
+	return openai.ChatCompletionStreamResponse{
+		Model: res.Model,
+		Usage: usage,
+		Choices: []openai.ChatCompletionStreamChoice{
+			{
+				Delta: openai.ChatCompletionStreamChoiceDelta{
+					Role:    res.Message.Role,
+					Content: res.Message.Content,
+				},
+				FinishReason: ollamaFinishReason(res.DoneReason),
+			},
+		},
+	}, nil
+}
+
+// Close closes the stream
+func (s *ollamaStream) Close() error {
+	return s.body.Close()
+}
+
+// toOllamaRequest translates OpenAI request into Ollama request
+func toOllamaRequest(req openai.ChatCompletionRequest) (ollamaRequest, error) {
+	res := ollamaRequest{
+		Model:   req.Model,
+		Options: map[string]interface{}{},
+	}
+
+	// tool message is given with the name of called tool instead of ID of tool call
+	called := map[string]string{}
+	for _, msg := range req.Messages {
+		message := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		if msg.Role == openai.ChatMessageRoleTool {
+			message.ToolName = called[msg.ToolCallID]
+		}
+		for _, call := range msg.ToolCalls {
+			arguments := json.RawMessage(call.Function.Arguments)
+			if len(arguments) == 0 {
+				arguments = json.RawMessage("{}")
+			}
+			if !json.Valid(arguments) {
+				return ollamaRequest{}, fmt.Errorf("invalid arguments of tool call %s: %s", call.Function.Name, call.Function.Arguments)
+			}
+
+			called[call.ID] = call.Function.Name
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Function.Name
+			toolCall.Function.Arguments = arguments
+			message.ToolCalls = append(message.ToolCalls, toolCall)
+		}
+		res.Messages = append(res.Messages, message)
+	}
+
+	// Ollama has no tool choice, tools are not given or only the chosen one is given instead
+	call := functionChoice(req)
+	for _, f := range functions(req) {
+		if call == FunctionCallNone || (call != FunctionCallAuto && call != f.Name) {
+			continue
+		}
+
+		schema, err := toJSON(f.Parameters)
+		if err != nil {
+			return ollamaRequest{}, err
+		}
+
+		tool := ollamaTool{Type: "function"}
+		tool.Function.Name = f.Name
+		tool.Function.Description = f.Description
+		tool.Function.Parameters = schema
+		res.Tools = append(res.Tools, tool)
+	}
+
+	// response format is given as "json" or JSON schema
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case openai.ChatCompletionResponseFormatTypeJSONObject:
+			res.Format = json.RawMessage(`"json"`)
+		case openai.ChatCompletionResponseFormatTypeJSONSchema:
+			schema, err := toJSON(req.ResponseFormat.JSONSchema.Schema)
+			if err != nil {
+				return ollamaRequest{}, err
+			}
+			res.Format = schema
+		}
+	}
+
+	// model parameters are given as options
+	if req.Temperature != 0 {
+		res.Options["temperature"] = req.Temperature
+	}
+	if req.TopP != 0 {
+		res.Options["top_p"] = req.TopP
+	}
+	if req.MaxTokens != 0 {
+		res.Options["num_predict"] = req.MaxTokens
+	}
+	if len(req.Stop) > 0 {
+		res.Options["stop"] = req.Stop
+	}
+	if req.PresencePenalty != 0 {
+		res.Options["presence_penalty"] = req.PresencePenalty
+	}
+	if req.FrequencyPenalty != 0 {
+		res.Options["frequency_penalty"] = req.FrequencyPenalty
+	}
+	if req.Seed != nil {
+		res.Options["seed"] = *req.Seed
+	}
+
+	return res, nil
+}
+
+// ollamaFinishReason translates done reason of Ollama into finish reason of OpenAI
+func ollamaFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "":
+		return ""
+	case "length":
+		return openai.FinishReasonLength
+	}
+
+	return openai.FinishReasonStop
+}
@@ -0,0 +1,365 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestToOllamaRequest(t *testing.T) {
+	client := NewClientWithProvider(nil, "llama3", time.Minute)
+	funcs := []openai.FunctionDefinition{
+		{Name: "f", Description: "call f", Parameters: json.RawMessage(`{"type":"object"}`)},
+		{Name: "g", Parameters: json.RawMessage(`{"type":"object"}`)},
+	}
+	seed := 42
+
+	tests := []struct {
+		name string
+		req  openai.ChatCompletionRequest
+		want string
+	}{
+		{
+			name: "messages and options",
+			req: openai.ChatCompletionRequest{
+				Model:            "llama3",
+				Temperature:      0.5,
+				TopP:             0.9,
+				MaxTokens:        100,
+				Stop:             []string{"END"},
+				PresencePenalty:  0.25,
+				FrequencyPenalty: 0.75,
+				Seed:             &seed,
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+					{Role: openai.ChatMessageRoleUser, Content: "q"},
+				},
+			},
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "system", "content": "be brief"},
+					{"role": "user", "content": "q"}
+				],
+				"stream": false,
+				"options": {
+					"temperature": 0.5,
+					"top_p": 0.9,
+					"num_predict": 100,
+					"stop": ["END"],
+					"presence_penalty": 0.25,
+					"frequency_penalty": 0.75,
+					"seed": 42
+				}
+			}`,
+		},
+		{
+			name: "tool calls and their results",
+			req: openai.ChatCompletionRequest{
+				Model: "llama3",
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleUser, Content: "q"},
+					{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+						{ID: "call_0", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "f", Arguments: `{"a":1}`}},
+						{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "g"}},
+					}},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "call_0", Content: "r1"},
+					{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "r2"},
+				},
+				Tools: []openai.Tool{
+					{Type: openai.ToolTypeFunction, Function: &funcs[0]},
+					{Type: openai.ToolTypeFunction, Function: &funcs[1]},
+				},
+			},
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "user", "content": "q"},
+					{"role": "assistant", "content": "", "tool_calls": [
+						{"function": {"name": "f", "arguments": {"a": 1}}},
+						{"function": {"name": "g", "arguments": {}}}
+					]},
+					{"role": "tool", "content": "r1", "tool_name": "f"},
+					{"role": "tool", "content": "r2", "tool_name": "g"}
+				],
+				"stream": false,
+				"tools": [
+					{"type": "function", "function": {"name": "f", "description": "call f", "parameters": {"type": "object"}}},
+					{"type": "function", "function": {"name": "g", "parameters": {"type": "object"}}}
+				]
+			}`,
+		},
+		{
+			name: "only forced function is given",
+			req:  client.FunctionCallRequest("role", "prompt", "", funcs, "g"),
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "system", "content": "role"},
+					{"role": "user", "content": "prompt"}
+				],
+				"stream": false,
+				"tools": [{"type": "function", "function": {"name": "g", "parameters": {"type": "object"}}}]
+			}`,
+		},
+		{
+			name: "no function is given without function call",
+			req:  client.FunctionCallRequest("role", "prompt", "", funcs, FunctionCallNone),
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "system", "content": "role"},
+					{"role": "user", "content": "prompt"}
+				],
+				"stream": false
+			}`,
+		},
+		{
+			name: "JSON mode",
+			req:  client.StructuredOutputRequest("role", "prompt", "", &OutputFormat{Name: "any"}),
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "system", "content": "role\n\nRespond only with a JSON object."},
+					{"role": "user", "content": "prompt"}
+				],
+				"stream": false,
+				"format": "json"
+			}`,
+		},
+		{
+			name: "JSON schema",
+			req: client.StructuredOutputRequest("role", "prompt", "", &OutputFormat{
+				Name:   "person",
+				Schema: json.RawMessage(`{"type":"object","required":["name"]}`),
+			}),
+			want: `{
+				"model": "llama3",
+				"messages": [
+					{"role": "system", "content": "role"},
+					{"role": "user", "content": "prompt"}
+				],
+				"stream": false,
+				"format": {"type": "object", "required": ["name"]}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toOllamaRequest(tt.req)
+			if err != nil {
+				t.Fatalf("toOllamaRequest() returned error: %s", err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := toOllamaRequest(openai.ChatCompletionRequest{
+			Model: "llama3",
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+					{ID: "call_0", Function: openai.FunctionCall{Name: "f", Arguments: "not json"}},
+				}},
+			},
+		})
+		if want := "invalid arguments of tool call f: not json"; err == nil || err.Error() != want {
+			t.Errorf("toOllamaRequest() error = %v, want %q", err, want)
+		}
+	})
+}
+
+// ollamaServer returns a server of chat API which answers the body of the model in the request
+func ollamaServer(t *testing.T, bodies map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+
+		var req struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %s", err)
+		}
+		if req.Stream != strings.HasPrefix(req.Model, "stream") {
+			t.Errorf("stream = %v of model %s", req.Stream, req.Model)
+		}
+
+		body, ok := bodies[req.Model]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			body = `{"error":"model '` + req.Model + `' not found"}`
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestOllamaCreateChatCompletion(t *testing.T) {
+	server := ollamaServer(t, map[string]string{
+		"text": `{"model":"llama3","message":{"role":"assistant","content":"Hello world"},"done":true,"done_reason":"stop",
+			"prompt_eval_count":3,"eval_count":4}`,
+		"tools": `{"model":"llama3","message":{"role":"assistant","content":"","tool_calls":[
+			{"function":{"name":"f","arguments":{"a":1}}},{"function":{"name":"g","arguments":{}}}]},
+			"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":6}`,
+		"long": `{"model":"llama3","message":{"role":"assistant","content":"Hello"},"done":true,"done_reason":"length",
+			"prompt_eval_count":1,"eval_count":2}`,
+	})
+	provider := &ollamaProvider{client: server.Client(), baseURL: server.URL + "/"}
+
+	request := func(model string) openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{Model: model, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "q"}}}
+	}
+
+	tests := []struct {
+		name    string
+		model   string
+		message openai.ChatCompletionMessage
+		reason  openai.FinishReason
+		usage   openai.Usage
+	}{
+		{
+			name:    "text",
+			model:   "text",
+			message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello world"},
+			reason:  openai.FinishReasonStop,
+			usage:   openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+		},
+		{
+			name:  "tool calls are numbered",
+			model: "tools",
+			message: openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{
+					{ID: "call_0", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "f", Arguments: `{"a":1}`}},
+					{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "g", Arguments: `{}`}},
+				},
+			},
+			reason: openai.FinishReasonToolCalls,
+			usage:  openai.Usage{PromptTokens: 5, CompletionTokens: 6, TotalTokens: 11},
+		},
+		{
+			name:    "length",
+			model:   "long",
+			message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "Hello"},
+			reason:  openai.FinishReasonLength,
+			usage:   openai.Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := provider.CreateChatCompletion(context.Background(), request(tt.model))
+			if err != nil {
+				t.Fatalf("CreateChatCompletion() returned error: %s", err)
+			}
+			if resp.Model != "llama3" || len(resp.Choices) != 1 {
+				t.Fatalf("CreateChatCompletion() = %+v, want a choice of llama3", resp)
+			}
+			if !reflect.DeepEqual(resp.Choices[0].Message, tt.message) {
+				t.Errorf("message = %+v, want %+v", resp.Choices[0].Message, tt.message)
+			}
+			if resp.Choices[0].FinishReason != tt.reason {
+				t.Errorf("finish reason = %s, want %s", resp.Choices[0].FinishReason, tt.reason)
+			}
+			if resp.Usage != tt.usage {
+				t.Errorf("usage = %+v, want %+v", resp.Usage, tt.usage)
+			}
+		})
+	}
+
+	t.Run("error body", func(t *testing.T) {
+		_, err := provider.CreateChatCompletion(context.Background(), request("missing"))
+		assertAPIError(t, err, http.StatusNotFound, "model 'missing' not found")
+	})
+}
+
+func TestOllamaStreamRecv(t *testing.T) {
+	server := ollamaServer(t, map[string]string{
+		"stream": strings.Join([]string{
+			`{"model":"llama3","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"model":"llama3","message":{"role":"assistant","content":"lo"},"done":false}`,
+			`{"model":"llama3","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":3,"eval_count":4}`,
+			``,
+		}, "\n"),
+		"stream-error": strings.Join([]string{
+			`{"model":"llama3","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"error":"model runner has unexpectedly stopped"}`,
+			``,
+		}, "\n"),
+	})
+	provider := &ollamaProvider{client: server.Client(), baseURL: server.URL}
+
+	request := func(model string) openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{Model: model, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "q"}}}
+	}
+
+	t.Run("deltas", func(t *testing.T) {
+		stream, err := provider.CreateChatCompletionStream(context.Background(), request("stream"))
+		if err != nil {
+			t.Fatalf("CreateChatCompletionStream() returned error: %s", err)
+		}
+		defer stream.Close()
+
+		responses, err := receiveAll(stream)
+		if err != nil {
+			t.Fatalf("Recv() returned error: %s", err)
+		}
+		if len(responses) != 3 {
+			t.Fatalf("Recv() returned %d responses, want 3: %+v", len(responses), responses)
+		}
+
+		content := ""
+		for _, resp := range responses {
+			content += resp.Choices[0].Delta.Content
+		}
+		if content != "Hello" {
+			t.Errorf("content = %q, want %q", content, "Hello")
+		}
+
+		for _, resp := range responses[:2] {
+			if resp.Usage != nil || resp.Choices[0].FinishReason != "" {
+				t.Errorf("response before done = %+v, want no usage and finish reason", resp)
+			}
+		}
+		last := responses[2]
+		if last.Choices[0].FinishReason != openai.FinishReasonStop {
+			t.Errorf("finish reason = %s, want %s", last.Choices[0].FinishReason, openai.FinishReasonStop)
+		}
+		if want := (openai.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7}); last.Usage == nil || *last.Usage != want {
+			t.Errorf("usage = %+v, want %+v", last.Usage, want)
+		}
+	})
+
+	t.Run("error in stream", func(t *testing.T) {
+		stream, err := provider.CreateChatCompletionStream(context.Background(), request("stream-error"))
+		if err != nil {
+			t.Fatalf("CreateChatCompletionStream() returned error: %s", err)
+		}
+		defer stream.Close()
+
+		responses, err := receiveAll(stream)
+		if len(responses) != 1 {
+			t.Errorf("Recv() returned %d responses before error, want 1", len(responses))
+		}
+		assertAPIError(t, err, 0, "model runner has unexpectedly stopped")
+	})
+
+	t.Run("error body", func(t *testing.T) {
+		_, err := provider.CreateChatCompletionStream(context.Background(), request("stream-missing"))
+		assertAPIError(t, err, http.StatusNotFound, "model 'stream-missing' not found")
+	})
+}
@@ -0,0 +1,71 @@
+package chatgpt
+
+import (
+	"context"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// openAIProvider is a provider of OpenAI and Azure OpenAI API
+type openAIProvider struct {
+	client *openai.Client
+	// streamUsage requests usage in the last chunk of streams, Azure OpenAI API of older versions doesn't accept it
+	streamUsage bool
+}
+
+// CreateChatCompletion creates a chat completion
+func (p *openAIProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+// CreateChatCompletionStream creates a chat completion stream
+func (p *openAIProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error) {
+	if p.streamUsage {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openAIStream{stream: stream}, nil
+}
+
+// openAIStream is a stream of OpenAI API
+type openAIStream struct {
+	stream *openai.ChatCompletionStream
+}
+
+// Recv receives next delta
+func (s *openAIStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	return s.stream.Recv()
+}
+
+// Close closes the stream
+func (s *openAIStream) Close() error {
+	return s.stream.Close()
+}
+
+// CreateBatch uploads requests and creates a batch of them
+func (p *openAIProvider) CreateBatch(ctx context.Context, req openai.CreateBatchWithUploadFileRequest) (openai.Batch, error) {
+	resp, err := p.client.CreateBatchWithUploadFile(ctx, req)
+	return resp.Batch, err
+}
+
+// RetrieveBatch retrieves the batch
+func (p *openAIProvider) RetrieveBatch(ctx context.Context, id string) (openai.Batch, error) {
+	resp, err := p.client.RetrieveBatch(ctx, id)
+	return resp.Batch, err
+}
+
+// FileContent downloads content of the file
+func (p *openAIProvider) FileContent(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := p.client.GetFileContent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.ReadCloser, nil
+}
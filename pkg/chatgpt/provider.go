@@ -0,0 +1,119 @@
+package chatgpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Provider is a backend of chat completion API.
+// requests and responses are represented in OpenAI format, providers of other vendors translate them.
+type Provider interface {
+	// CreateChatCompletion creates a chat completion
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	// CreateChatCompletionStream creates a chat completion stream
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (Stream, error)
+}
+
+// Stream is a stream of chat completion deltas, Recv returns io.EOF when the stream is finished
+type Stream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// errorDecoder decodes error message from the response body of a failed request
+type errorDecoder func(body []byte) string
+
+// postJSON sends body as JSON to url, and returns the response if it succeeds.
+// otherwise, the error is returned as *openai.APIError so that it is handled in the same way regardless of provider.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}, decodeError errorDecoder) (*http.Response, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		errBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		message := decodeError(errBody)
+		if message == "" {
+			message = strings.TrimSpace(string(errBody))
+		}
+
+		return nil, &openai.APIError{
+			HTTPStatusCode: resp.StatusCode,
+			Message:        message,
+		}
+	}
+
+	return resp, nil
+}
+
+// toJSON marshals v into raw JSON, v is used as it is if it is already raw JSON
+func toJSON(v interface{}) (json.RawMessage, error) {
+	switch raw := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return raw, nil
+	case json.RawMessage:
+		return raw, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid function parameters: %w", err)
+	}
+
+	return raw, nil
+}
+
+// functions returns function definitions of tools of the request
+func functions(req openai.ChatCompletionRequest) []openai.FunctionDefinition {
+	funcs := []openai.FunctionDefinition{}
+	for _, tool := range req.Tools {
+		if tool.Type == openai.ToolTypeFunction && tool.Function != nil {
+			funcs = append(funcs, *tool.Function)
+		}
+	}
+
+	return funcs
+}
+
+// functionChoice returns the function to call of the request, FunctionCallAuto, FunctionCallNone or a name of function
+func functionChoice(req openai.ChatCompletionRequest) string {
+	switch choice := req.ToolChoice.(type) {
+	case string:
+		return choice
+	case openai.ToolChoice:
+		return choice.Function.Name
+	}
+
+	return FunctionCallAuto
+}
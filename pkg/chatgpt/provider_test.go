@@ -0,0 +1,81 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// assertJSON fails the test unless got is encoded in the same JSON as want, regardless of order of keys
+func assertJSON(t *testing.T, got interface{}, want string) {
+	t.Helper()
+
+	raw, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to encode %#v: %s", got, err)
+	}
+
+	var g, w interface{}
+	if err := json.Unmarshal(raw, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON of want: %s", err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", raw, want)
+	}
+}
+
+// assertAPIError fails the test unless err is *openai.APIError of the status code and the message
+func assertAPIError(t *testing.T, err error, status int, message string) {
+	t.Helper()
+
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *openai.APIError", err)
+	}
+	if apiErr.HTTPStatusCode != status || apiErr.Message != message {
+		t.Errorf("error = %d %q, want %d %q", apiErr.HTTPStatusCode, apiErr.Message, status, message)
+	}
+}
+
+func TestPostJSONError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"decoded message", http.StatusBadRequest, `{"error":"model is required"}`, "model is required"},
+		{"body without message", http.StatusInternalServerError, "upstream failed\n", "upstream failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			decode := func(body []byte) string {
+				var res struct {
+					Error string `json:"error"`
+				}
+				_ = json.Unmarshal(body, &res)
+				return res.Error
+			}
+
+			_, err := postJSON(context.Background(), server.Client(), server.URL, http.Header{}, map[string]string{}, decode)
+			assertAPIError(t, err, tt.status, tt.message)
+		})
+	}
+}
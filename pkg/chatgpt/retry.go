@@ -0,0 +1,295 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// baseBackoff is the backoff before the first retry, it is doubled for each retry
+const baseBackoff = time.Second
+
+// RetryPolicy decides how failed requests are retried
+type RetryPolicy struct {
+	// Retries is the maximum number of retries, 0 means no retry
+	Retries int
+	// MaxBackoff is the maximum duration to wait before a retry
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used unless the policy is given
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:    3,
+	MaxBackoff: 60 * time.Second,
+}
+
+// retryCountKey is the key of context value which counts retries of requests made with the context
+type retryCountKey struct{}
+
+// countRetries returns the context which counts retries of requests made with it
+func countRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryCountKey{}, new(int32))
+}
+
+// retries returns the number of retries of requests made with the context, 0 if it does not count retries
+func retries(ctx context.Context) int {
+	if n, ok := ctx.Value(retryCountKey{}).(*int32); ok {
+		return int(atomic.LoadInt32(n))
+	}
+
+	return 0
+}
+
+// retryTransport is a http.RoundTripper which retries rate limited and failed requests with exponential backoff and jitter.
+// it also holds requests until the rate limit is reset when the limit is exhausted.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// newRetryTransport creates a retryTransport with the default policy
+func newRetryTransport() *retryTransport {
+	return &retryTransport{
+		base:   http.DefaultTransport,
+		policy: DefaultRetryPolicy,
+	}
+}
+
+// RoundTrip sends the request, and retries it if it is retryable
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if err := t.hold(ctx); err != nil {
+			return nil, err
+		}
+
+		// the body is consumed by the previous attempt, so that the request is cloned with new body
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if resp != nil {
+			t.observe(resp.Header)
+		}
+
+		canRewind := req.Body == nil || req.GetBody != nil
+		if attempt >= t.policy.Retries || !canRewind || !retryable(resp, err) {
+			return resp, err
+		}
+
+		if n, ok := ctx.Value(retryCountKey{}).(*int32); ok {
+			atomic.AddInt32(n, 1)
+		}
+
+		wait := t.backoff(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// hold waits until the rate limit is reset if it is exhausted
+func (t *retryTransport) hold(ctx context.Context) error {
+	t.mu.Lock()
+	wait := time.Until(t.until)
+	t.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	if wait > t.policy.MaxBackoff {
+		wait = t.policy.MaxBackoff
+	}
+
+	return sleep(ctx, wait)
+}
+
+// observe records when the rate limit is reset if the remaining requests or tokens are exhausted
+func (t *retryTransport) observe(header http.Header) {
+	wait := rateLimitReset(header)
+	if wait <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// backoff returns the duration to wait before the retry of given attempt.
+// Retry-After and x-ratelimit-reset-* headers are honoured, otherwise exponential backoff with jitter is used.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	wait := time.Duration(0)
+	if resp != nil {
+		wait = retryAfter(resp.Header)
+		if wait == 0 && resp.StatusCode == http.StatusTooManyRequests {
+			wait = rateLimitReset(resp.Header)
+		}
+	}
+
+	if wait == 0 {
+		// exponential backoff with jitter, between a half and the whole of the backoff
+		exp := baseBackoff << uint(attempt)
+		if exp <= 0 || exp > t.policy.MaxBackoff {
+			exp = t.policy.MaxBackoff
+		}
+		wait = exp/2 + time.Duration(rand.Int63n(int64(exp/2)+1))
+	}
+
+	if wait > t.policy.MaxBackoff {
+		wait = t.policy.MaxBackoff
+	}
+
+	return wait
+}
+
+// retryable returns whether the request is worth retrying by its response or error
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented:
+		return false
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter returns the duration given by retry-after-ms or Retry-After header, 0 if it is not given
+func retryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+
+	return 0
+}
+
+// rateLimitReset returns the duration until the exhausted rate limit is reset by x-ratelimit-* headers of OpenAI,
+// 0 if neither requests nor tokens are exhausted
+func rateLimitReset(header http.Header) time.Duration {
+	wait := time.Duration(0)
+	for _, limit := range []string{"requests", "tokens"} {
+		if header.Get("x-ratelimit-remaining-"+limit) != "0" {
+			continue
+		}
+
+		reset, err := time.ParseDuration(header.Get("x-ratelimit-reset-" + limit))
+		if err == nil && reset > wait {
+			wait = reset
+		}
+	}
+
+	return wait
+}
+
+// sleep waits for given duration, or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// classify wraps error of API request with the category of the failure, so that the cause is clear to the user.
+// ctx is the context of the request, which tells how many times the request is retried.
+func (gpt *Client) classify(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	status, message := 0, ""
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status, message = apiErr.HTTPStatusCode, fmt.Sprint(apiErr.Code, " ", apiErr.Message)
+	case errors.As(err, &reqErr):
+		status, message = reqErr.HTTPStatusCode, string(reqErr.Body)
+	}
+
+	retried := ""
+	if n := retries(ctx); n > 0 {
+		retried = fmt.Sprintf(", retried %d times", n)
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("request timed out after %s%s: %w", gpt.timeout, retried, err)
+	case status == http.StatusBadRequest && isContextLength(message):
+		return fmt.Errorf("context length exceeded, reduce the input: %w", err)
+	case status == http.StatusBadRequest:
+		return fmt.Errorf("bad request: %w", err)
+	case status == http.StatusUnauthorized:
+		return fmt.Errorf("authentication failed, check the API key: %w", err)
+	case status == http.StatusForbidden:
+		return fmt.Errorf("permission denied: %w", err)
+	case status == http.StatusNotFound:
+		return fmt.Errorf("not found, check the model and endpoint: %w", err)
+	case status == http.StatusTooManyRequests:
+		return fmt.Errorf("rate limit exceeded%s: %w", retried, err)
+	case status >= http.StatusInternalServerError:
+		return fmt.Errorf("server error%s: %w", retried, err)
+	}
+
+	return err
+}
+
+// isContextLength returns whether the error message tells that the prompt exceeds the context window
+func isContextLength(message string) bool {
+	message = strings.ToLower(message)
+	for _, s := range []string{"context_length_exceeded", "maximum context length", "prompt is too long", "context window"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+
+	return false
+}
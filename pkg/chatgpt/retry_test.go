@@ -0,0 +1,298 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// statusServer answers each request with the next status of the list, and the last status for the rest.
+// the body of each request is recorded.
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *[]string) {
+	var count int32
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		i := int(atomic.AddInt32(&count, 1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statuses[i])
+		_, _ = fmt.Fprintf(w, `{"error":{"message":"status %d"}}`, statuses[i])
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &bodies
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		statuses []int
+		status   int
+		attempts int
+		// wait is the minimum duration of retries
+		wait time.Duration
+	}{
+		{
+			name:     "rate limit with Retry-After",
+			header:   http.Header{"Retry-After": {"0.2"}},
+			statuses: []int{http.StatusTooManyRequests, http.StatusOK},
+			status:   http.StatusOK,
+			attempts: 2,
+			wait:     200 * time.Millisecond,
+		},
+		{
+			name:     "server error is retried until success",
+			statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK},
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "server error is retried up to the limit",
+			statuses: []int{http.StatusServiceUnavailable},
+			status:   http.StatusServiceUnavailable,
+			attempts: 4,
+		},
+		{
+			name:     "bad request fails fast",
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			status:   http.StatusBadRequest,
+			attempts: 1,
+		},
+		{
+			name:     "not implemented fails fast",
+			statuses: []int{http.StatusNotImplemented, http.StatusOK},
+			status:   http.StatusNotImplemented,
+			attempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, bodies := statusServer(t, tt.header, tt.statuses...)
+			transport := newRetryTransport()
+			transport.policy = RetryPolicy{Retries: 3, MaxBackoff: 10 * time.Millisecond}
+			if tt.wait > 0 {
+				transport.policy.MaxBackoff = time.Second
+			}
+
+			ctx := countRetries(context.Background())
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(`{"model":"gpt-4o"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err != nil {
+				t.Fatalf("request returned error: %s", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if len(*bodies) != tt.attempts {
+				t.Errorf("attempts = %d, want %d", len(*bodies), tt.attempts)
+			}
+			if got := retries(ctx); got != tt.attempts-1 {
+				t.Errorf("retries() = %d, want %d", got, tt.attempts-1)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wait {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.wait)
+			}
+
+			// the body is given again to each retry
+			for i, body := range *bodies {
+				if body != `{"model":"gpt-4o"}` {
+					t.Errorf("body of attempt %d = %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportCanceled(t *testing.T) {
+	server, bodies := statusServer(t, http.Header{"Retry-After": {"30"}}, http.StatusTooManyRequests)
+	transport := newRetryTransport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = (&http.Client{Transport: transport}).Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %s for Retry-After after the context is done", elapsed)
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("attempts = %d, want 1", len(*bodies))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", http.Header{}, 0},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"9"}}, 1500 * time.Millisecond},
+		{"seconds", http.Header{"Retry-After": {"2"}}, 2 * time.Second},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.header); got != tt.want {
+				t.Errorf("retryAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("date", func(t *testing.T) {
+		header := http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}
+		if got := retryAfter(header); got <= 50*time.Second || got > time.Minute {
+			t.Errorf("retryAfter() = %s, want about a minute", got)
+		}
+	})
+}
+
+func TestRateLimitReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"not exhausted", http.Header{"X-Ratelimit-Remaining-Requests": {"10"}, "X-Ratelimit-Reset-Requests": {"1s"}}, 0},
+		{"requests exhausted", http.Header{"X-Ratelimit-Remaining-Requests": {"0"}, "X-Ratelimit-Reset-Requests": {"1s"}}, time.Second},
+		{"longer reset of both", http.Header{
+			"X-Ratelimit-Remaining-Requests": {"0"}, "X-Ratelimit-Reset-Requests": {"1s"},
+			"X-Ratelimit-Remaining-Tokens": {"0"}, "X-Ratelimit-Reset-Tokens": {"6m0s"},
+		}, 6 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateLimitReset(tt.header); got != tt.want {
+				t.Errorf("rateLimitReset() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	client := NewClientWithProvider(nil, "gpt-4o", 30*time.Second)
+	apiError := func(status int, message string) error {
+		return &openai.APIError{HTTPStatusCode: status, Message: message}
+	}
+
+	// retried is the context of the request which is retried twice
+	retried := countRetries(context.Background())
+	n := retried.Value(retryCountKey{}).(*int32)
+	*n = 2
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{"timeout without retry", context.Background(), context.DeadlineExceeded, "request timed out after 30s: "},
+		{"timeout after retries", retried, fmt.Errorf("post: %w", context.DeadlineExceeded), "request timed out after 30s, retried 2 times: "},
+		{"context length", context.Background(), apiError(400, "This model's maximum context length is 8192 tokens."), "context length exceeded, reduce the input: "},
+		{"context length of anthropic", context.Background(), apiError(400, "prompt is too long: 210000 tokens > 200000 maximum"), "context length exceeded, reduce the input: "},
+		{"bad request", context.Background(), apiError(400, "invalid temperature"), "bad request: "},
+		{"authentication", context.Background(), apiError(401, "invalid api key"), "authentication failed, check the API key: "},
+		{"permission", context.Background(), apiError(403, "forbidden"), "permission denied: "},
+		{"not found", context.Background(), apiError(404, "model not found"), "not found, check the model and endpoint: "},
+		{"rate limit without retry", context.Background(), apiError(429, "slow down"), "rate limit exceeded: "},
+		{"rate limit after retries", retried, apiError(429, "slow down"), "rate limit exceeded, retried 2 times: "},
+		{"server error after retries", retried, apiError(503, "overloaded"), "server error, retried 2 times: "},
+		{"request error", context.Background(), &openai.RequestError{HTTPStatusCode: 502, Body: []byte("bad gateway")}, "server error: "},
+		{"other error", context.Background(), errors.New("connection refused"), "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := client.classify(tt.ctx, tt.err)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("classify() = %v, want %q", err, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify() does not wrap %v", tt.err)
+			}
+		})
+	}
+
+	if err := client.classify(context.Background(), nil); err != nil {
+		t.Errorf("classify() of nil = %v, want nil", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `{"error":{"message":"try again"}}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+	client.SetRetryPolicy(RetryPolicy{Retries: 2, MaxBackoff: 10 * time.Millisecond})
+
+	answer, err := client.Ask("role", "prompt", "")
+	if err != nil || answer.Content != "hello" {
+		t.Errorf("Ask() = %+v, %v, want hello after a retry", answer, err)
+	}
+
+	t.Run("server error after retries", func(t *testing.T) {
+		server, _ := statusServer(t, nil, http.StatusInternalServerError)
+		client := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute)
+		client.SetRetryPolicy(RetryPolicy{Retries: 2, MaxBackoff: 10 * time.Millisecond})
+
+		_, err := client.Ask("role", "prompt", "")
+		if err == nil || !strings.HasPrefix(err.Error(), "server error, retried 2 times: ") {
+			t.Errorf("Ask() error = %v, want server error after 2 retries", err)
+		}
+	})
+
+	t.Run("context length", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":{"message":"This model's maximum context length is 8192 tokens.","code":"context_length_exceeded"}}`)
+		}))
+		defer server.Close()
+
+		_, err := NewClientWithBaseURL("test", server.URL, "gpt-4o", time.Minute).Ask("role", "prompt", "")
+		if err == nil || !strings.HasPrefix(err.Error(), "context length exceeded, reduce the input: ") {
+			t.Errorf("Ask() error = %v, want context length exceeded", err)
+		}
+	})
+}
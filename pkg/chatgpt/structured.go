@@ -0,0 +1,150 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/schema"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxStructuredOutputAttempts is the maximum number of attempts to get an answer which satisfies the schema
+const maxStructuredOutputAttempts = 3
+
+// jsonObjectInstruction is added to the system message of JSON object request, OpenAI requires JSON to be mentioned in messages
+const jsonObjectInstruction = "Respond only with a JSON object."
+
+// OutputFormat is the format of structured output
+type OutputFormat struct {
+	// Name is the name of the schema
+	Name string
+	// Schema is JSON schema of the output, nil means any JSON object
+	Schema json.RawMessage
+	// Strict enables strict schema adherence of the model
+	Strict bool
+}
+
+// StructuredOutput question to OpenAI with given prompt and user input, and returns the answer in JSON of the format.
+// the answer is validated against the schema, and the model is asked again with validation errors
+// until it returns a valid answer or maxStructuredOutputAttempts is reached.
+// the answer has metadata of the responses, and tokens of all attempts are summed up in its usage.
+func (gpt *Client) StructuredOutput(role string, prompt string, input string, format *OutputFormat) (interface{}, *Answer, error) {
+	original := gpt.StructuredOutputRequest(role, prompt, input, format)
+	req, msgs := original, original.Messages
+
+	// only the valid response is cached by the original request, so that invalid attempts are never replayed
+	var resp openai.ChatCompletionResponse
+	cached := gpt.lookup(original, &resp)
+
+	answer := &Answer{}
+	var invalid error
+	for attempt := 0; attempt < maxStructuredOutputAttempts; attempt++ {
+		if !cached {
+			var err error
+			if resp, err = gpt.completion(req); err != nil {
+				return nil, answer, err
+			}
+		}
+
+		attempted, err := newAnswer(resp)
+		if err != nil {
+			return nil, answer, err
+		}
+		attempted.Cached = cached
+		answer.Add(attempted)
+
+		output, err := ParseStructuredOutput(answer.Content, format)
+		if err == nil {
+			if !cached {
+				gpt.store(original, resp)
+			}
+			return output, answer, nil
+		}
+		invalid = err
+		cached = false
+
+		// ask again with the invalid answer and its errors, previous attempts are not kept to save tokens
+		req.Messages = append(msgs[:len(msgs):len(msgs)],
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer.Content},
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("the answer is invalid: %s\nAnswer again with JSON which satisfies the schema.", err),
+			},
+		)
+	}
+
+	return nil, answer, fmt.Errorf("invalid output after %d attempts: %w", maxStructuredOutputAttempts, invalid)
+}
+
+// StructuredOutputRequest builds chat completion request of the question with response format of the output format
+func (gpt *Client) StructuredOutputRequest(role string, prompt string, input string, format *OutputFormat) openai.ChatCompletionRequest {
+	req := gpt.request(messages(role, prompt, input))
+
+	if format.Schema == nil {
+		req.Messages[0].Content = strings.TrimSpace(req.Messages[0].Content + "\n\n" + jsonObjectInstruction)
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		return req
+	}
+
+	req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   format.Name,
+			Schema: format.Schema,
+			Strict: format.Strict,
+		},
+	}
+	return req
+}
+
+// ParseStructuredOutput parses the answer in JSON, and validates it against the schema of the format.
+// a code fence around JSON is removed, as models without native JSON mode often add it.
+func ParseStructuredOutput(answer string, format *OutputFormat) (interface{}, error) {
+	text := strings.TrimSpace(answer)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+		text = strings.TrimSuffix(text, "```")
+		if i := strings.Index(text, "\n"); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSpace(text)
+	}
+
+	var output interface{}
+	if err := json.Unmarshal([]byte(text), &output); err != nil {
+		return nil, fmt.Errorf("answer is not JSON: %w", err)
+	}
+
+	if format.Schema == nil {
+		if _, ok := output.(map[string]interface{}); !ok {
+			return nil, errors.New("answer is not a JSON object")
+		}
+		return output, nil
+	}
+
+	def, err := schema.FromParameters(format.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(def, output); err != nil {
+		return nil, fmt.Errorf("answer does not match the schema: %w", err)
+	}
+
+	return output, nil
+}
+
+// jsonSchema returns JSON schema of the response format of the request, nil if the request has no JSON schema
+func jsonSchema(req openai.ChatCompletionRequest) *openai.ChatCompletionResponseFormatJSONSchema {
+	if req.ResponseFormat == nil || req.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeJSONSchema {
+		return nil
+	}
+
+	return req.ResponseFormat.JSONSchema
+}
+
+// schemaInstruction returns instruction to answer in JSON of the schema, for providers without native JSON schema support
+func schemaInstruction(schema json.RawMessage) string {
+	return "Respond only with JSON which satisfies the following JSON schema, without any explanation.\n" + string(schema)
+}
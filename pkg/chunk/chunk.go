@@ -0,0 +1,176 @@
+package chunk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/token"
+)
+
+// Modes of splitting input into chunks
+const (
+	// ByLines splits input at line boundaries
+	ByLines = "lines"
+	// ByTokens splits input at token boundaries, regardless of lines
+	ByTokens = "tokens"
+	// ByHunks splits unified diff at hunk boundaries, each hunk keeps the header of its file
+	ByHunks = "hunks"
+	// ByFiles splits unified diff or attached files at file boundaries
+	ByFiles = "files"
+)
+
+// Modes is list of supported modes
+var Modes = []string{ByLines, ByTokens, ByHunks, ByFiles}
+
+// Split splits text into chunks of at most size tokens of the encoding.
+// units of the mode are packed into a chunk as many as possible, and a unit larger than size is split by lines.
+func Split(enc *token.Encoding, text string, mode string, size int) ([]string, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", size)
+	}
+
+	switch mode {
+	case ByLines:
+		return Pack(enc, lines(text), size), nil
+	case ByTokens:
+		return splitTokens(enc, text, size), nil
+	case ByHunks:
+		return Pack(enc, hunks(text), size), nil
+	case ByFiles:
+		return Pack(enc, files(text), size), nil
+	default:
+		return nil, fmt.Errorf("unknown chunk mode: %s, must be one of %s", mode, strings.Join(Modes, ", "))
+	}
+}
+
+// Pack packs units into chunks of at most size tokens, a unit larger than size is split by lines
+func Pack(enc *token.Encoding, units []string, size int) []string {
+	chunks := []string{}
+	var current strings.Builder
+	count := 0
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			count = 0
+		}
+	}
+
+	for _, unit := range units {
+		n := enc.Count(unit)
+		if count+n > size {
+			flush()
+		}
+
+		// a unit larger than size is split by lines, and a line larger than size by tokens
+		if n > size {
+			more := lines(unit)
+			if len(more) == 1 {
+				chunks = append(chunks, splitTokens(enc, unit, size)...)
+				continue
+			}
+			chunks = append(chunks, Pack(enc, more, size)...)
+			continue
+		}
+
+		current.WriteString(unit)
+		count += n
+	}
+	flush()
+
+	return chunks
+}
+
+// splitTokens splits text at every size tokens
+func splitTokens(enc *token.Encoding, text string, size int) []string {
+	tokens := enc.Encode(text)
+	chunks := []string{}
+	for len(tokens) > 0 {
+		n := size
+		if n > len(tokens) {
+			n = len(tokens)
+		}
+		chunks = append(chunks, enc.Decode(tokens[:n]))
+		tokens = tokens[n:]
+	}
+
+	return chunks
+}
+
+// lines splits text into lines, each of them keeps its newline
+func lines(text string) []string {
+	units := strings.SplitAfter(text, "\n")
+	if len(units) > 0 && units[len(units)-1] == "" {
+		units = units[:len(units)-1]
+	}
+
+	return units
+}
+
+// hunks splits unified diff into hunks, the header of file is prepended to each hunk of the file.
+// text which is not a part of hunk, such as commit message, becomes a unit by itself.
+func hunks(text string) []string {
+	units := []string{}
+	header, hunk := "", ""
+	inHeader := false
+	flush := func() {
+		if hunk != "" {
+			units = append(units, hunk)
+			hunk = ""
+		}
+	}
+
+	for _, line := range lines(text) {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			if inHeader {
+				units = append(units, header)
+			}
+			header, inHeader = line, true
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			hunk, inHeader = header+line, false
+		case inHeader:
+			header += line
+		case hunk != "":
+			hunk += line
+		default:
+			units = append(units, line)
+		}
+	}
+	flush()
+
+	// a file without hunks, such as binary or renamed file, is kept as its header
+	if inHeader {
+		units = append(units, header)
+	}
+
+	return units
+}
+
+// files splits unified diff or attached files into files.
+// a file starts with 'diff --git' line, or '### path' line followed by an empty line and a code fence.
+func files(text string) []string {
+	all := lines(text)
+	units := []string{}
+	var current strings.Builder
+
+	for i, line := range all {
+		start := strings.HasPrefix(line, "diff --git ")
+		if strings.HasPrefix(line, "### ") && i+2 < len(all) && strings.TrimSpace(all[i+1]) == "" && strings.HasPrefix(all[i+2], "```") {
+			start = true
+		}
+
+		if start && current.Len() > 0 {
+			units = append(units, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		units = append(units, current.String())
+	}
+
+	return units
+}
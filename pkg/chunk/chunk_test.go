@@ -0,0 +1,203 @@
+package chunk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/token"
+)
+
+// diff is unified diff of tests, with a commit message, a binary file and a file of two hunks
+const diff = `commit 0123456
+    fix typo
+
+diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -1,2 +1,2 @@
+-packge a
++package a
+
+@@ -10,1 +10,1 @@
+-// Hello is fucntion
++// Hello is function
+diff --git a/logo.png b/logo.png
+index 3333333..4444444 100644
+Binary files a/logo.png and b/logo.png differ
+diff --git a/b.go b/b.go
+index 5555555..6666666 100644
+--- a/b.go
++++ b/b.go
+@@ -1 +1 @@
+-packge b
++package b
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+`
+
+func TestHunks(t *testing.T) {
+	headerA := "diff --git a/a.go b/a.go\nindex 1111111..2222222 100644\n--- a/a.go\n+++ b/a.go\n"
+	headerB := "diff --git a/b.go b/b.go\nindex 5555555..6666666 100644\n--- a/b.go\n+++ b/b.go\n"
+	want := []string{
+		"commit 0123456\n",
+		"    fix typo\n",
+		"\n",
+		headerA + "@@ -1,2 +1,2 @@\n-packge a\n+package a\n\n",
+		headerA + "@@ -10,1 +10,1 @@\n-// Hello is fucntion\n+// Hello is function\n",
+		"diff --git a/logo.png b/logo.png\nindex 3333333..4444444 100644\nBinary files a/logo.png and b/logo.png differ\n",
+		headerB + "@@ -1 +1 @@\n-packge b\n+package b\n",
+		"diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n",
+	}
+
+	if got := hunks(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("hunks() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "diff",
+			text: diff,
+			want: []string{
+				"commit 0123456\n    fix typo\n\n",
+				"diff --git a/a.go b/a.go\nindex 1111111..2222222 100644\n--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,2 @@\n-packge a\n+package a\n\n@@ -10,1 +10,1 @@\n-// Hello is fucntion\n+// Hello is function\n",
+				"diff --git a/logo.png b/logo.png\nindex 3333333..4444444 100644\nBinary files a/logo.png and b/logo.png differ\n",
+				"diff --git a/b.go b/b.go\nindex 5555555..6666666 100644\n--- a/b.go\n+++ b/b.go\n@@ -1 +1 @@\n-packge b\n+package b\n",
+				"diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n",
+			},
+		},
+		{
+			name: "attached files",
+			text: "### a.go\n\n```go\npackage a\n\n### not a file\n```\n\n### b.md\n\n```md\n# title\n```\n",
+			want: []string{
+				"### a.go\n\n```go\npackage a\n\n### not a file\n```\n\n",
+				"### b.md\n\n```md\n# title\n```\n",
+			},
+		},
+		{
+			name: "plain text",
+			text: "no file\nin text",
+			want: []string{"no file\nin text"},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := files(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPack(t *testing.T) {
+	enc, err := token.GetEncoding(token.Cl100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each line of the tests is 2 to 4 tokens, and long is 11 tokens without newline
+	long := "alpha beta gamma delta epsilon zeta eta theta iota kappa"
+	tests := []struct {
+		name  string
+		units []string
+		size  int
+		want  []string
+	}{
+		{
+			name:  "units are packed",
+			units: []string{"one two\n", "three four\n", "five six seven\n"},
+			size:  6,
+			want:  []string{"one two\nthree four\n", "five six seven\n"},
+		},
+		{
+			name:  "unit of exact size",
+			units: []string{"one two\n", "three four\n"},
+			size:  3,
+			want:  []string{"one two\n", "three four\n"},
+		},
+		{
+			name:  "large unit is split by lines",
+			units: []string{"one\n", "one\ntwo\nthree\n", "two\n"},
+			size:  4,
+			want:  []string{"one\n", "one\ntwo\n", "three\n", "two\n"},
+		},
+		{
+			name:  "no units",
+			units: nil,
+			size:  4,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Pack(enc, tt.units, tt.size)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pack() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("large line is split by tokens", func(t *testing.T) {
+		got := Pack(enc, []string{"one\n", long}, 4)
+		if len(got) != 4 || got[0] != "one\n" || strings.Join(got[1:], "") != long {
+			t.Errorf("Pack() = %q, want one and %q split into 3 chunks", got, long)
+		}
+		for _, chunk := range got {
+			if n := enc.Count(chunk); n > 4 {
+				t.Errorf("chunk %q is %d tokens, larger than 4", chunk, n)
+			}
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	enc, err := token.GetEncoding(token.Cl100kBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range Modes {
+		t.Run(mode, func(t *testing.T) {
+			chunks, err := Split(enc, diff, mode, 40)
+			if err != nil {
+				t.Fatalf("Split() returned error: %s", err)
+			}
+			if len(chunks) < 2 {
+				t.Errorf("Split() = %d chunks, want more than one", len(chunks))
+			}
+			for _, chunk := range chunks {
+				if n := enc.Count(chunk); n > 40 {
+					t.Errorf("chunk %q is %d tokens, larger than 40", chunk, n)
+				}
+			}
+
+			// hunks repeat headers of files, the others keep the text as is
+			if mode != ByHunks && strings.Join(chunks, "") != diff {
+				t.Errorf("chunks do not make the original text")
+			}
+		})
+	}
+
+	if _, err := Split(enc, diff, ByLines, 0); err == nil || err.Error() != "invalid chunk size: 0" {
+		t.Errorf("Split() error = %v, want invalid chunk size", err)
+	}
+	if _, err := Split(enc, diff, "words", 40); err == nil || !strings.HasPrefix(err.Error(), "unknown chunk mode: words") {
+		t.Errorf("Split() error = %v, want unknown chunk mode", err)
+	}
+}
@@ -0,0 +1,581 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Subcommand types
+const (
+	// TypeGeneric is a subcommand which asks a question with predefined role and prompt
+	TypeGeneric = "generic"
+	// TypeFunctionCall is a subcommand which asks a question in function calling format
+	TypeFunctionCall = "function-call"
+	// TypeOutputSchema is a subcommand which asks a question to answer in JSON of a schema
+	TypeOutputSchema = "output-schema"
+	// TypeAgent is a subcommand which lets the model call local tools in a loop until it answers
+	TypeAgent = "agent"
+)
+
+// Types are available subcommand types
+var Types = []string{TypeGeneric, TypeFunctionCall, TypeOutputSchema, TypeAgent}
+
+// Run modes of command generated by function-call subcommand
+const (
+	// RunNever prints the result of function call without executing it
+	RunNever = "never"
+	// RunConfirm executes the command after the user confirms it on the terminal
+	RunConfirm = "confirm"
+	// RunAuto executes the command without confirmation, unless it is dangerous
+	RunAuto = "auto"
+)
+
+// RunModes are available run modes
+var RunModes = []string{RunNever, RunConfirm, RunAuto}
+
+// Providers are available API providers
+var Providers = []string{"openai", "azure", "anthropic", "ollama"}
+
+// reservedKeys are top-level keys of config file which are not subcommand definitions
+var reservedKeys = []string{"api", "apis", "default", "cache", "prices"}
+
+// Subcommand is a definition of subcommand in config file
+type Subcommand struct {
+	// Name is the name of subcommand, it is the top-level key of the definition
+	Name string `mapstructure:"-"`
+
+	// Type is the type of subcommand, inferred from other keys if it is not given
+	Type         string                   `mapstructure:"type"`
+	Role         string                   `mapstructure:"role"`
+	Prompt       string                   `mapstructure:"prompt"`
+	FunctionCall []map[string]interface{} `mapstructure:"function-call"`
+	// Tools are functions in the shape of tools API, {type: function, function: {name, description, parameters}}
+	Tools []map[string]interface{} `mapstructure:"tools"`
+
+	// FunctionCallMode chooses the function to call, one of auto, none or a name of declared function
+	FunctionCallMode string `mapstructure:"function_call"`
+	// Envelope wraps arguments of function call with the name of called function in output
+	Envelope bool `mapstructure:"envelope"`
+	// Array outputs function calls as an array even if a function is called, it is implied by Tools
+	Array bool `mapstructure:"array"`
+	// Run executes the command in RunField of function call result, one of never, confirm or auto, empty means never
+	Run string `mapstructure:"run"`
+	// RunField is the argument of function call which has the command to execute, default is command
+	RunField string `mapstructure:"run_field"`
+
+	// OutputSchema is the schema of answer of output-schema subcommand
+	OutputSchema *OutputSchema `mapstructure:"output-schema"`
+
+	// LocalTools are tools of agent subcommand, each of them is executed on this machine when the model calls it
+	LocalTools []LocalTool `mapstructure:"local-tools"`
+	// MaxSteps is the maximum number of model calls of agent subcommand, default is 10
+	MaxSteps *int `mapstructure:"max_steps"`
+
+	// Files are files or glob patterns attached as context by default
+	Files []string `mapstructure:"files"`
+
+	// Profile is the name of API profile defined in apis
+	Profile string `mapstructure:"profile"`
+
+	// Template renders role and prompt as templates, it is implied by Vars
+	Template bool `mapstructure:"template"`
+	// Vars are template variables of the subcommand, each of them becomes a flag of the subcommand
+	Vars []Var `mapstructure:"vars"`
+
+	// model parameters, nil or empty means the default
+	Temperature      *float64 `mapstructure:"temperature"`
+	TopP             *float64 `mapstructure:"top_p"`
+	MaxTokens        *int     `mapstructure:"max_tokens"`
+	PresencePenalty  *float64 `mapstructure:"presence_penalty"`
+	FrequencyPenalty *float64 `mapstructure:"frequency_penalty"`
+	Stop             []string `mapstructure:"stop"`
+	Seed             *int     `mapstructure:"seed"`
+
+	// MaxInputTokens is the token budget of prompt, default is the context window of the model
+	MaxInputTokens *int `mapstructure:"max_input_tokens"`
+	// Overflow is the strategy used when input exceeds the token budget
+	Overflow string `mapstructure:"overflow"`
+
+	// map-reduce chunking, input is split by Chunk and the answers are combined by ReducePrompt
+	Chunk        string `mapstructure:"chunk"`
+	ChunkSize    *int   `mapstructure:"chunk_size"`
+	Concurrency  *int   `mapstructure:"concurrency"`
+	ReducePrompt string `mapstructure:"reduce_prompt"`
+
+	// Output is the output format of the answer
+	Output string `mapstructure:"output"`
+}
+
+// OutputSchema is the schema of answer in JSON
+type OutputSchema struct {
+	// Name is the name of the schema, default is the name of subcommand
+	Name string `mapstructure:"name"`
+	// Schema is JSON schema of the answer, the answer is any JSON object if it is not given
+	Schema map[string]interface{} `mapstructure:"schema"`
+	// Strict enables strict schema adherence of the model
+	Strict bool `mapstructure:"strict"`
+}
+
+// LocalTool is a tool of agent subcommand, exactly one of Shell, HTTP and File is the executor of it.
+// templates of executor are rendered with arguments of the call.
+type LocalTool struct {
+	Name        string                 `mapstructure:"name"`
+	Description string                 `mapstructure:"description"`
+	Parameters  map[string]interface{} `mapstructure:"parameters"`
+
+	// Shell is the template of shell command
+	Shell string `mapstructure:"shell"`
+	// HTTP is the request to a server on localhost
+	HTTP *HTTPTool `mapstructure:"http"`
+	// File is the file read within an allowed directory
+	File *FileTool `mapstructure:"file"`
+}
+
+// HTTPTool is a request to a server on localhost
+type HTTPTool struct {
+	// Method is HTTP method, default is GET
+	Method string `mapstructure:"method"`
+	// URL is the template of URL, its host must be localhost
+	URL string `mapstructure:"url"`
+	// Body is the template of request body
+	Body    string            `mapstructure:"body"`
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// FileTool is a file read within an allowed directory
+type FileTool struct {
+	// Dir is the directory which files are read from, files out of it are never read
+	Dir string `mapstructure:"dir"`
+	// Path is the template of file path relative to Dir
+	Path string `mapstructure:"path"`
+}
+
+// Var is a template variable declared by subcommand
+type Var struct {
+	Name        string `mapstructure:"name"`
+	Description string `mapstructure:"description"`
+	Default     string `mapstructure:"default"`
+	Required    bool   `mapstructure:"required"`
+}
+
+// APIProfile is a definition of named API profile in apis of config file
+type APIProfile struct {
+	Name string `mapstructure:"-"`
+
+	Provider   string `mapstructure:"provider"`
+	Key        string `mapstructure:"key"`
+	Model      string `mapstructure:"model"`
+	Endpoint   string `mapstructure:"endpoint"`
+	Conversion string `mapstructure:"conversion"`
+	Timeout    string `mapstructure:"timeout"`
+	Retries    string `mapstructure:"retries"`
+	MaxBackoff string `mapstructure:"max_backoff"`
+}
+
+// Price is the price of tokens of a model in prices of config file, in USD per 1M tokens
+type Price struct {
+	Prompt     float64 `mapstructure:"prompt"`
+	Completion float64 `mapstructure:"completion"`
+}
+
+// ValidationError is a problem found in a definition of config file
+type ValidationError struct {
+	// Section is the top-level key of the definition, such as subcommand name
+	Section string
+	// Key is the offending key, empty if the problem is not specific to a key
+	Key     string
+	Message string
+}
+
+// Error returns the error message with the section and the key
+func (e *ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("invalid definition of '%s': %s", e.Section, e.Message)
+	}
+
+	return fmt.Sprintf("invalid definition of '%s': '%s' %s", e.Section, e.Key, e.Message)
+}
+
+// ValidationErrors is a list of problems found in config file
+type ValidationErrors []*ValidationError
+
+// Error returns error messages separated by newline
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// IsReserved returns true if the top-level key is not a subcommand definition
+func IsReserved(key string) bool {
+	return contains(reservedKeys, key)
+}
+
+// contains checks if a string slice contains a string
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subcommands decodes and validates all subcommand definitions in settings, sorted by name.
+// valid definitions are returned along with ValidationErrors of invalid ones.
+func Subcommands(settings map[string]interface{}) ([]*Subcommand, error) {
+	subcmds := []*Subcommand{}
+	errs := ValidationErrors{}
+
+	for name, raw := range settings {
+		if IsReserved(name) {
+			continue
+		}
+
+		subcmd, err := DecodeSubcommand(name, raw)
+		if err != nil {
+			errs = append(errs, err...)
+			continue
+		}
+
+		subcmds = append(subcmds, subcmd)
+	}
+
+	sort.Slice(subcmds, func(i, j int) bool {
+		return subcmds[i].Name < subcmds[j].Name
+	})
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Section < errs[j].Section
+	})
+
+	if len(errs) > 0 {
+		return subcmds, errs
+	}
+
+	return subcmds, nil
+}
+
+// DecodeSubcommand decodes and validates a subcommand definition
+func DecodeSubcommand(name string, raw interface{}) (*Subcommand, ValidationErrors) {
+	subcmd := &Subcommand{Name: name}
+	if errs := decode(name, raw, subcmd); len(errs) > 0 {
+		return nil, errs
+	}
+
+	// infer type if it is not given
+	if subcmd.Type == "" {
+		subcmd.Type = TypeGeneric
+		if len(subcmd.FunctionCall) > 0 || len(subcmd.Tools) > 0 {
+			subcmd.Type = TypeFunctionCall
+		} else if subcmd.OutputSchema != nil {
+			subcmd.Type = TypeOutputSchema
+		} else if len(subcmd.LocalTools) > 0 {
+			subcmd.Type = TypeAgent
+		}
+	}
+
+	errs := ValidationErrors{}
+	invalid := func(key string, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Section: name, Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if subcmd.Role == "" {
+		invalid("role", "is required")
+	}
+	if subcmd.Prompt == "" {
+		invalid("prompt", "is required")
+	}
+
+	// keys of function calls are only for function-call subcommand
+	if subcmd.Type != TypeFunctionCall {
+		if len(subcmd.FunctionCall) > 0 {
+			invalid("function-call", "is not available for %s subcommand", subcmd.Type)
+		}
+		if len(subcmd.Tools) > 0 {
+			invalid("tools", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.FunctionCallMode != "" {
+			invalid("function_call", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.Envelope {
+			invalid("envelope", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.Array {
+			invalid("array", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.Run != "" {
+			invalid("run", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.RunField != "" {
+			invalid("run_field", "is not available for %s subcommand", subcmd.Type)
+		}
+	}
+	if subcmd.Type != TypeOutputSchema && subcmd.OutputSchema != nil {
+		invalid("output-schema", "is not available for %s subcommand", subcmd.Type)
+	}
+	if subcmd.Type != TypeAgent {
+		if len(subcmd.LocalTools) > 0 {
+			invalid("local-tools", "is not available for %s subcommand", subcmd.Type)
+		}
+		if subcmd.MaxSteps != nil {
+			invalid("max_steps", "is not available for %s subcommand", subcmd.Type)
+		}
+	}
+
+	switch subcmd.Type {
+	case TypeGeneric:
+	case TypeOutputSchema:
+		// without schema, the answer is any JSON object
+		if subcmd.OutputSchema != nil && subcmd.OutputSchema.Strict && subcmd.OutputSchema.Schema == nil {
+			invalid("output-schema.strict", "requires 'output-schema.schema'")
+		}
+	case TypeFunctionCall:
+		if len(subcmd.FunctionCall) == 0 && len(subcmd.Tools) == 0 {
+			invalid("function-call", "or 'tools' is required for %s subcommand", subcmd.Type)
+		}
+		names := []string{"auto", "none"}
+		for i, f := range subcmd.FunctionCall {
+			name, ok := f["name"].(string)
+			if !ok || name == "" {
+				invalid(fmt.Sprintf("function-call[%d].name", i), "is required")
+				continue
+			}
+			names = append(names, name)
+		}
+		for i, tool := range subcmd.Tools {
+			if t, ok := tool["type"]; ok && t != "function" {
+				invalid(fmt.Sprintf("tools[%d].type", i), "must be function: %v", t)
+				continue
+			}
+			f, ok := tool["function"].(map[string]interface{})
+			if !ok {
+				invalid(fmt.Sprintf("tools[%d].function", i), "is required")
+				continue
+			}
+			name, ok := f["name"].(string)
+			if !ok || name == "" {
+				invalid(fmt.Sprintf("tools[%d].function.name", i), "is required")
+				continue
+			}
+			names = append(names, name)
+		}
+		if subcmd.FunctionCallMode != "" && !contains(names, subcmd.FunctionCallMode) {
+			invalid("function_call", "must be one of %s: %s", strings.Join(names, ", "), subcmd.FunctionCallMode)
+		}
+		if subcmd.Run != "" && !contains(RunModes, subcmd.Run) {
+			invalid("run", "must be one of %s: %s", strings.Join(RunModes, ", "), subcmd.Run)
+		}
+	case TypeAgent:
+		if len(subcmd.LocalTools) == 0 {
+			invalid("local-tools", "is required for %s subcommand", subcmd.Type)
+		}
+		if subcmd.MaxSteps != nil && *subcmd.MaxSteps < 1 {
+			invalid("max_steps", "must be positive: %d", *subcmd.MaxSteps)
+		}
+		tools := map[string]bool{}
+		for i, tool := range subcmd.LocalTools {
+			key := fmt.Sprintf("local-tools[%d]", i)
+			switch {
+			case tool.Name == "":
+				invalid(key+".name", "is required")
+			case tools[tool.Name]:
+				invalid(key+".name", "is already declared: %s", tool.Name)
+			}
+			tools[tool.Name] = true
+
+			executors := 0
+			if tool.Shell != "" {
+				executors++
+			}
+			if tool.HTTP != nil {
+				executors++
+				if tool.HTTP.URL == "" {
+					invalid(key+".http.url", "is required")
+				}
+			}
+			if tool.File != nil {
+				executors++
+				if tool.File.Dir == "" {
+					invalid(key+".file.dir", "is required")
+				}
+				if tool.File.Path == "" {
+					invalid(key+".file.path", "is required")
+				}
+			}
+			if executors != 1 {
+				invalid(key, "must have exactly one of 'shell', 'http' and 'file'")
+			}
+		}
+	default:
+		invalid("type", "must be one of %s: %s", strings.Join(Types, ", "), subcmd.Type)
+	}
+
+	declared := map[string]bool{}
+	for i, v := range subcmd.Vars {
+		switch {
+		case v.Name == "":
+			invalid(fmt.Sprintf("vars[%d].name", i), "is required")
+		case strings.ContainsAny(v.Name, " =") || strings.HasPrefix(v.Name, "-"):
+			invalid(fmt.Sprintf("vars[%d].name", i), "must be a valid flag name: %s", v.Name)
+		case declared[v.Name]:
+			invalid(fmt.Sprintf("vars[%d].name", i), "is already declared: %s", v.Name)
+		}
+		declared[v.Name] = true
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return subcmd, nil
+}
+
+// APIProfiles decodes and validates all API profiles in apis of settings, sorted by name
+func APIProfiles(settings map[string]interface{}) ([]*APIProfile, error) {
+	profiles := []*APIProfile{}
+	errs := ValidationErrors{}
+
+	apis, ok := settings["apis"]
+	if !ok {
+		return profiles, nil
+	}
+
+	definitions, ok := apis.(map[string]interface{})
+	if !ok {
+		return nil, ValidationErrors{{Section: "apis", Message: "must be a map of API profiles"}}
+	}
+
+	for name, raw := range definitions {
+		section := fmt.Sprintf("apis.%s", name)
+		profile := &APIProfile{Name: name}
+		if err := decode(section, raw, profile); len(err) > 0 {
+			errs = append(errs, err...)
+			continue
+		}
+
+		if profile.Provider != "" && !contains(Providers, profile.Provider) {
+			errs = append(errs, &ValidationError{
+				Section: section,
+				Key:     "provider",
+				Message: fmt.Sprintf("must be one of %s: %s", strings.Join(Providers, ", "), profile.Provider),
+			})
+			continue
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Section < errs[j].Section
+	})
+
+	if len(errs) > 0 {
+		return profiles, errs
+	}
+
+	return profiles, nil
+}
+
+// Prices decodes and validates prices of models, raw is prices of config file keyed by model name or its prefix.
+// raw must be taken by the key of prices, as names of models may contain dots which split keys of all settings.
+// valid prices are returned along with ValidationErrors of invalid ones.
+func Prices(raw interface{}) (map[string]Price, error) {
+	prices := map[string]Price{}
+	errs := ValidationErrors{}
+
+	if raw == nil {
+		return prices, nil
+	}
+
+	definitions, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, ValidationErrors{{Section: "prices", Message: "must be a map of prices by model"}}
+	}
+
+	for model, definition := range definitions {
+		section := fmt.Sprintf("prices.%s", model)
+		price := Price{}
+		if err := decode(section, definition, &price); len(err) > 0 {
+			errs = append(errs, err...)
+			continue
+		}
+
+		if price.Prompt < 0 || price.Completion < 0 {
+			errs = append(errs, &ValidationError{Section: section, Message: "must not be negative"})
+			continue
+		}
+
+		prices[model] = price
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Section < errs[j].Section
+	})
+
+	if len(errs) > 0 {
+		return prices, errs
+	}
+
+	return prices, nil
+}
+
+// invalidKeysPattern matches the error message of unknown keys reported by decoder
+var invalidKeysPattern = regexp.MustCompile(`^'(.*)' has invalid keys: (.*)$`)
+
+// decode decodes raw definition into result, unknown keys and type mismatches are reported
+func decode(section string, raw interface{}, result interface{}) ValidationErrors {
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return ValidationErrors{{Section: section, Message: "must be a map of keys and values"}}
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           result,
+	})
+	if err != nil {
+		return ValidationErrors{{Section: section, Message: err.Error()}}
+	}
+
+	if err := decoder.Decode(raw); err != nil {
+		var decodeErr *mapstructure.Error
+		if !errors.As(err, &decodeErr) {
+			return ValidationErrors{{Section: section, Message: err.Error()}}
+		}
+
+		errs := ValidationErrors{}
+		for _, message := range decodeErr.Errors {
+			// report each unknown key with its path
+			if match := invalidKeysPattern.FindStringSubmatch(message); match != nil {
+				for _, key := range strings.Split(match[2], ", ") {
+					if match[1] != "" {
+						key = fmt.Sprintf("%s.%s", match[1], key)
+					}
+					errs = append(errs, &ValidationError{Section: section, Key: key, Message: "is unknown key"})
+				}
+				continue
+			}
+
+			errs = append(errs, &ValidationError{Section: section, Message: message})
+		}
+
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Key != "" && errs[j].Key == ""
+		})
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// definition returns a map of a subcommand definition with role and prompt, overridden by keys and values
+func definition(keyAndValues ...interface{}) map[string]interface{} {
+	raw := map[string]interface{}{"role": "role", "prompt": "prompt"}
+	for i := 0; i < len(keyAndValues); i += 2 {
+		key := keyAndValues[i].(string)
+		if keyAndValues[i+1] == nil {
+			delete(raw, key)
+			continue
+		}
+		raw[key] = keyAndValues[i+1]
+	}
+
+	return raw
+}
+
+// function returns a function definition of function-call subcommand
+func function(name string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "parameters": map[string]interface{}{"type": "object"}}
+}
+
+func TestDecodeSubcommandType(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		want string
+	}{
+		{"generic by default", definition(), TypeGeneric},
+		{"function-call by functions", definition("function-call", []interface{}{function("run")}), TypeFunctionCall},
+		{"function-call by tools", definition("tools", []interface{}{
+			map[string]interface{}{"type": "function", "function": function("run")},
+		}), TypeFunctionCall},
+		{"output-schema by schema", definition("output-schema", map[string]interface{}{"strict": false}), TypeOutputSchema},
+		{"agent by local tools", definition("local-tools", []interface{}{
+			map[string]interface{}{"name": "date", "shell": "date"},
+		}), TypeAgent},
+		{"explicit type", definition("type", TypeOutputSchema), TypeOutputSchema},
+		{"explicit generic type", definition("type", TypeGeneric, "temperature", 0.5), TypeGeneric},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subcmd, errs := DecodeSubcommand("cmd", tt.raw)
+			if errs != nil {
+				t.Fatalf("DecodeSubcommand() returned error: %s", errs)
+			}
+			if subcmd.Name != "cmd" || subcmd.Type != tt.want {
+				t.Errorf("DecodeSubcommand() = %s of type %s, want cmd of type %s", subcmd.Name, subcmd.Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSubcommandValues(t *testing.T) {
+	raw := definition(
+		"temperature", "0.2",
+		"max_tokens", 100,
+		"stop", []interface{}{"END"},
+		"files", []interface{}{"*.go"},
+		"vars", []interface{}{map[string]interface{}{"name": "to", "default": "en", "required": true}},
+	)
+
+	subcmd, errs := DecodeSubcommand("translate", raw)
+	if errs != nil {
+		t.Fatalf("DecodeSubcommand() returned error: %s", errs)
+	}
+	if subcmd.Temperature == nil || *subcmd.Temperature != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", subcmd.Temperature)
+	}
+	if subcmd.MaxTokens == nil || *subcmd.MaxTokens != 100 {
+		t.Errorf("max_tokens = %v, want 100", subcmd.MaxTokens)
+	}
+	if subcmd.TopP != nil || subcmd.Seed != nil {
+		t.Errorf("parameters which are not given are not nil: top_p = %v, seed = %v", subcmd.TopP, subcmd.Seed)
+	}
+	if !reflect.DeepEqual(subcmd.Stop, []string{"END"}) || !reflect.DeepEqual(subcmd.Files, []string{"*.go"}) {
+		t.Errorf("stop = %q, files = %q", subcmd.Stop, subcmd.Files)
+	}
+	if want := []Var{{Name: "to", Default: "en", Required: true}}; !reflect.DeepEqual(subcmd.Vars, want) {
+		t.Errorf("vars = %+v, want %+v", subcmd.Vars, want)
+	}
+}
+
+func TestDecodeSubcommandInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  interface{}
+		// want are messages of errors in order
+		want []string
+	}{
+		{
+			name: "not a map",
+			raw:  "ask a question",
+			want: []string{"invalid definition of 'cmd': must be a map of keys and values"},
+		},
+		{
+			name: "missing role and prompt",
+			raw:  definition("role", nil, "prompt", nil),
+			want: []string{"invalid definition of 'cmd': 'role' is required", "invalid definition of 'cmd': 'prompt' is required"},
+		},
+		{
+			name: "unknown keys",
+			raw:  definition("temprature", 0.5, "promt", "typo"),
+			want: []string{"invalid definition of 'cmd': 'promt' is unknown key", "invalid definition of 'cmd': 'temprature' is unknown key"},
+		},
+		{
+			name: "unknown nested key",
+			raw:  definition("output-schema", map[string]interface{}{"schema": map[string]interface{}{}, "stict": true}),
+			want: []string{"invalid definition of 'cmd': 'output-schema.stict' is unknown key"},
+		},
+		{
+			name: "unknown type",
+			raw:  definition("type", "chat"),
+			want: []string{"invalid definition of 'cmd': 'type' must be one of generic, function-call, output-schema, agent: chat"},
+		},
+		{
+			name: "keys of other type",
+			raw:  definition("type", TypeGeneric, "run", "auto", "max_steps", 3),
+			want: []string{
+				"invalid definition of 'cmd': 'run' is not available for generic subcommand",
+				"invalid definition of 'cmd': 'max_steps' is not available for generic subcommand",
+			},
+		},
+		{
+			name: "function-call without functions",
+			raw:  definition("type", TypeFunctionCall),
+			want: []string{"invalid definition of 'cmd': 'function-call' or 'tools' is required for function-call subcommand"},
+		},
+		{
+			name: "invalid function call mode and run",
+			raw:  definition("function-call", []interface{}{function("run")}, "function_call", "exec", "run", "always"),
+			want: []string{
+				"invalid definition of 'cmd': 'function_call' must be one of auto, none, run: exec",
+				"invalid definition of 'cmd': 'run' must be one of never, confirm, auto: always",
+			},
+		},
+		{
+			name: "invalid tools",
+			raw: definition("tools", []interface{}{
+				map[string]interface{}{"type": "retrieval"},
+				map[string]interface{}{"type": "function"},
+				map[string]interface{}{"function": map[string]interface{}{"description": "no name"}},
+			}),
+			want: []string{
+				"invalid definition of 'cmd': 'tools[0].type' must be function: retrieval",
+				"invalid definition of 'cmd': 'tools[1].function' is required",
+				"invalid definition of 'cmd': 'tools[2].function.name' is required",
+			},
+		},
+		{
+			name: "strict without schema",
+			raw:  definition("output-schema", map[string]interface{}{"strict": true}),
+			want: []string{"invalid definition of 'cmd': 'output-schema.strict' requires 'output-schema.schema'"},
+		},
+		{
+			name: "invalid local tools",
+			raw: definition("max_steps", 0, "local-tools", []interface{}{
+				map[string]interface{}{"name": "date", "shell": "date"},
+				map[string]interface{}{"name": "date", "shell": "date", "file": map[string]interface{}{"dir": "."}},
+			}),
+			want: []string{
+				"invalid definition of 'cmd': 'max_steps' must be positive: 0",
+				"invalid definition of 'cmd': 'local-tools[1].name' is already declared: date",
+				"invalid definition of 'cmd': 'local-tools[1].file.path' is required",
+				"invalid definition of 'cmd': 'local-tools[1]' must have exactly one of 'shell', 'http' and 'file'",
+			},
+		},
+		{
+			name: "invalid vars",
+			raw: definition("vars", []interface{}{
+				map[string]interface{}{"description": "no name"},
+				map[string]interface{}{"name": "--to"},
+				map[string]interface{}{"name": "to"},
+				map[string]interface{}{"name": "to"},
+			}),
+			want: []string{
+				"invalid definition of 'cmd': 'vars[0].name' is required",
+				"invalid definition of 'cmd': 'vars[1].name' must be a valid flag name: --to",
+				"invalid definition of 'cmd': 'vars[3].name' is already declared: to",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subcmd, errs := DecodeSubcommand("cmd", tt.raw)
+			if subcmd != nil {
+				t.Errorf("DecodeSubcommand() = %+v, want nil", subcmd)
+			}
+			assertErrors(t, errs, tt.want)
+
+			for _, err := range errs {
+				if err.Section != "cmd" {
+					t.Errorf("section of %q = %s, want cmd", err, err.Section)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeSubcommandWrongTypes(t *testing.T) {
+	tests := []struct {
+		key   string
+		value interface{}
+	}{
+		{"role", []interface{}{"a", "b"}},
+		{"temperature", "hot"},
+		{"max_tokens", "many"},
+		{"files", map[string]interface{}{"a": "b"}},
+		{"envelope", "sometimes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			_, errs := DecodeSubcommand("cmd", definition(tt.key, tt.value))
+			if len(errs) != 1 {
+				t.Fatalf("DecodeSubcommand() = %v, want an error of %s", errs, tt.key)
+			}
+			if errs[0].Section != "cmd" || !strings.Contains(errs[0].Message, tt.key) {
+				t.Errorf("error = %q, want error of %s in cmd", errs[0], tt.key)
+			}
+		})
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	settings := map[string]interface{}{
+		"translate": definition(),
+		"broken":    definition("promt", "typo"),
+		"ask":       definition(),
+		"bad":       "not a map",
+		// reserved keys are not subcommands
+		"api":     map[string]interface{}{"key": "sk-test"},
+		"apis":    map[string]interface{}{},
+		"default": map[string]interface{}{"model": "gpt-4o"},
+		"cache":   map[string]interface{}{"ttl": "1h"},
+		"prices":  map[string]interface{}{"gpt-4o": map[string]interface{}{"prompt": 2.5}},
+	}
+
+	subcmds, err := Subcommands(settings)
+	names := []string{}
+	for _, subcmd := range subcmds {
+		names = append(names, subcmd.Name)
+	}
+	if want := []string{"ask", "translate"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Subcommands() = %q, want valid ones %q", names, want)
+	}
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Subcommands() error = %v, want ValidationErrors", err)
+	}
+	assertErrors(t, errs, []string{
+		"invalid definition of 'bad': must be a map of keys and values",
+		"invalid definition of 'broken': 'promt' is unknown key",
+	})
+
+	if _, err := Subcommands(map[string]interface{}{"ask": definition()}); err != nil {
+		t.Errorf("Subcommands() returned error: %s", err)
+	}
+}
+
+func TestIsReserved(t *testing.T) {
+	for _, key := range []string{"api", "apis", "default", "cache", "prices"} {
+		if !IsReserved(key) {
+			t.Errorf("IsReserved(%q) = false, want true", key)
+		}
+	}
+	if IsReserved("translate") {
+		t.Errorf("IsReserved(translate) = true, want false")
+	}
+}
+
+func TestAPIProfiles(t *testing.T) {
+	settings := map[string]interface{}{
+		"apis": map[string]interface{}{
+			"local": map[string]interface{}{"provider": "ollama", "model": "llama3", "endpoint": "http://localhost:11434"},
+			"work":  map[string]interface{}{"provider": "azure", "key": "k", "timeout": "30s", "retries": 5},
+			"typo":  map[string]interface{}{"provider": "openai", "modle": "gpt-4o"},
+			"other": map[string]interface{}{"provider": "gemini"},
+			"flat":  "gpt-4o",
+		},
+	}
+
+	profiles, err := APIProfiles(settings)
+	want := []*APIProfile{
+		{Name: "local", Provider: "ollama", Model: "llama3", Endpoint: "http://localhost:11434"},
+		{Name: "work", Provider: "azure", Key: "k", Timeout: "30s", Retries: "5"},
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("APIProfiles() = %+v, want %+v", profiles, want)
+	}
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("APIProfiles() error = %v, want ValidationErrors", err)
+	}
+	assertErrors(t, errs, []string{
+		"invalid definition of 'apis.flat': must be a map of keys and values",
+		"invalid definition of 'apis.other': 'provider' must be one of openai, azure, anthropic, ollama: gemini",
+		"invalid definition of 'apis.typo': 'modle' is unknown key",
+	})
+
+	if profiles, err := APIProfiles(map[string]interface{}{}); err != nil || len(profiles) != 0 {
+		t.Errorf("APIProfiles() without apis = %v, %v, want no profiles", profiles, err)
+	}
+	if _, err := APIProfiles(map[string]interface{}{"apis": []interface{}{"local"}}); err == nil || err.Error() != "invalid definition of 'apis': must be a map of API profiles" {
+		t.Errorf("APIProfiles() error = %v, want apis must be a map", err)
+	}
+}
+
+func TestPrices(t *testing.T) {
+	raw := map[string]interface{}{
+		"gpt-4o":      map[string]interface{}{"prompt": 2.5, "completion": 10},
+		"gpt-4o-mini": map[string]interface{}{"prompt": "0.15", "completion": "0.6"},
+		"free":        map[string]interface{}{},
+		"typo":        map[string]interface{}{"input": 1},
+		"negative":    map[string]interface{}{"prompt": -1},
+		"cheap":       map[string]interface{}{"prompt": "free"},
+		"flat":        3,
+	}
+
+	prices, err := Prices(raw)
+	want := map[string]Price{
+		"gpt-4o":      {Prompt: 2.5, Completion: 10},
+		"gpt-4o-mini": {Prompt: 0.15, Completion: 0.6},
+		"free":        {},
+	}
+	if !reflect.DeepEqual(prices, want) {
+		t.Errorf("Prices() = %+v, want %+v", prices, want)
+	}
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Prices() error = %v, want ValidationErrors", err)
+	}
+	sections := []string{}
+	for _, err := range errs {
+		sections = append(sections, err.Section)
+	}
+	if want := []string{"prices.cheap", "prices.flat", "prices.negative", "prices.typo"}; !reflect.DeepEqual(sections, want) {
+		t.Errorf("sections of errors = %q, want %q", sections, want)
+	}
+	if !strings.Contains(errs[0].Message, "prompt") {
+		t.Errorf("error = %q, want error of prompt", errs[0])
+	}
+	assertErrors(t, errs[1:], []string{
+		"invalid definition of 'prices.flat': must be a map of keys and values",
+		"invalid definition of 'prices.negative': must not be negative",
+		"invalid definition of 'prices.typo': 'input' is unknown key",
+	})
+
+	if prices, err := Prices(nil); err != nil || len(prices) != 0 {
+		t.Errorf("Prices(nil) = %v, %v, want no prices", prices, err)
+	}
+	if _, err := Prices("gpt-4o"); err == nil || err.Error() != "invalid definition of 'prices': must be a map of prices by model" {
+		t.Errorf("Prices() error = %v, want prices must be a map", err)
+	}
+}
+
+// assertErrors checks messages of the errors in order
+func assertErrors(t *testing.T, errs ValidationErrors, want []string) {
+	t.Helper()
+
+	got := []string{}
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,275 @@
+package in
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// binarySniffLen is the length of leading bytes to detect binary file, same as git
+const binarySniffLen = 8000
+
+// languages maps file extensions and names to language hints of fenced code blocks
+var languages = map[string]string{
+	".go":         "go",
+	".py":         "python",
+	".js":         "javascript",
+	".jsx":        "jsx",
+	".ts":         "typescript",
+	".tsx":        "tsx",
+	".rs":         "rust",
+	".java":       "java",
+	".kt":         "kotlin",
+	".rb":         "ruby",
+	".php":        "php",
+	".c":          "c",
+	".h":          "c",
+	".cc":         "cpp",
+	".cpp":        "cpp",
+	".hpp":        "cpp",
+	".cs":         "csharp",
+	".swift":      "swift",
+	".sh":         "bash",
+	".bash":       "bash",
+	".zsh":        "zsh",
+	".sql":        "sql",
+	".html":       "html",
+	".css":        "css",
+	".xml":        "xml",
+	".json":       "json",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".toml":       "toml",
+	".md":         "markdown",
+	".tf":         "hcl",
+	".proto":      "protobuf",
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "makefile",
+	"go.mod":      "go",
+	".gitignore":  "gitignore",
+	".properties": "properties",
+}
+
+// Glob expands patterns into paths of files. '**' matches zero or more directories.
+// files ignored by .gitignore are skipped for patterns with wildcards, and explicitly given paths are always included.
+func Glob(patterns []string) ([]string, error) {
+	paths := []string{}
+	seen := map[string]bool{}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(filepath.Clean(pattern))
+
+		// explicitly given path
+		if !hasMeta(pattern) {
+			stat, err := os.Stat(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if stat.IsDir() {
+				return nil, fmt.Errorf("%s is a directory, use glob pattern such as '%s/**' instead", pattern, pattern)
+			}
+			add(filepath.FromSlash(pattern))
+			continue
+		}
+
+		matched, err := walk(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no files matched: %s", pattern)
+		}
+		for _, p := range matched {
+			add(p)
+		}
+	}
+
+	return paths, nil
+}
+
+// walk walks from the directory which the pattern starts with, and returns sorted paths of files matched by the pattern
+func walk(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+
+	// the leading segments without wildcards are the root of the walk
+	i := 0
+	for i < len(segments)-1 && !hasMeta(segments[i]) {
+		i++
+	}
+	root := "."
+	if i > 0 {
+		root = strings.Join(segments[:i], "/")
+		if root == "" {
+			root = "/"
+		}
+	}
+	segments = segments[i:]
+
+	// rules of .gitignore are relative to working directory if the root is under it, otherwise relative to the root
+	base := root
+	parents := parentDirs(root)
+	if len(parents) > 0 {
+		base = "."
+	}
+
+	rules := ignoreRules{}
+	for _, dir := range parents {
+		rules = rules.load(dir, filepath.ToSlash(dir))
+	}
+
+	paths := []string{}
+	if _, err := os.Stat(root); errors.Is(err, os.ErrNotExist) {
+		return paths, nil
+	}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := relSlash(root, p)
+		if err != nil {
+			return err
+		}
+		ignoreRel, err := relSlash(base, p)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel != "." && (d.Name() == ".git" || rules.ignored(ignoreRel, true)) {
+				return filepath.SkipDir
+			}
+			rules = rules.load(p, ignoreRel)
+			return nil
+		}
+
+		if !d.Type().IsRegular() || rules.ignored(ignoreRel, false) {
+			return nil
+		}
+
+		if matchSegments(segments, strings.Split(rel, "/")) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parentDirs returns parent directories of dir from working directory, dir itself is not included.
+// nothing is returned if dir is not under working directory.
+func parentDirs(dir string) []string {
+	rel := filepath.ToSlash(filepath.Clean(dir))
+	if filepath.IsAbs(rel) || rel == "." || strings.HasPrefix(rel, "../") {
+		return []string{}
+	}
+
+	dirs := []string{"."}
+	segments := strings.Split(rel, "/")
+	for i := 1; i < len(segments); i++ {
+		dirs = append(dirs, filepath.FromSlash(strings.Join(segments[:i], "/")))
+	}
+
+	return dirs
+}
+
+// relSlash returns slash separated path of target relative to base
+func relSlash(base string, target string) (string, error) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// hasMeta returns true if the pattern contains wildcards
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
+
+// Attach reads files matched by patterns, and formats them as markdown with path headers and fenced code blocks.
+// binary files are skipped.
+func Attach(patterns []string) (string, error) {
+	paths, err := Glob(patterns)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+
+		if isBinary(content) {
+			continue
+		}
+
+		fence := fenceFor(content)
+		fmt.Fprintf(&b, "\n### %s\n\n%s%s\n%s", filepath.ToSlash(p), fence, language(p), content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n", fence)
+	}
+
+	return b.String(), nil
+}
+
+// isBinary returns true if leading bytes of the content contain NUL byte
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// fenceFor returns a fence which is longer than any backtick sequence in the content
+func fenceFor(content []byte) string {
+	longest, current := 0, 0
+	for _, c := range content {
+		if c != '`' {
+			current = 0
+			continue
+		}
+		current++
+		if current > longest {
+			longest = current
+		}
+	}
+
+	const minFenceLen = 3
+	if longest < minFenceLen {
+		return "```"
+	}
+
+	return strings.Repeat("`", longest+1)
+}
+
+// language returns the language hint of the file, empty if it is unknown
+func language(p string) string {
+	if lang, ok := languages[filepath.Base(p)]; ok {
+		return lang
+	}
+
+	return languages[strings.ToLower(filepath.Ext(p))]
+}
@@ -0,0 +1,160 @@
+package in
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chdir changes working directory to dir until the end of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestGlob(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, ".", map[string]string{
+		".gitignore":      "*.log\nvendor/\n",
+		".git/config":     "[core]\n",
+		"main.go":         "package main\n",
+		"a.log":           "log\n",
+		"vendor/v.go":     "package v\n",
+		"pkg/.gitignore":  "!debug.log\n/gen.go\n",
+		"pkg/p.go":        "package pkg\n",
+		"pkg/debug.log":   "debug\n",
+		"pkg/gen.go":      "package pkg\n",
+		"pkg/sub/gen.go":  "package sub\n",
+		"pkg/sub/app.log": "log\n",
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		err      string
+	}{
+		{
+			name:     "ignored files are skipped",
+			patterns: []string{"**/*.go"},
+			want:     []string{"main.go", "pkg/p.go", "pkg/sub/gen.go"},
+		},
+		{
+			name:     "negation of nested .gitignore",
+			patterns: []string{"**/*.log"},
+			want:     []string{"pkg/debug.log"},
+		},
+		{
+			name:     "rules of parent directories apply to the root of the walk",
+			patterns: []string{"pkg/sub/*"},
+			want:     []string{"pkg/sub/gen.go"},
+		},
+		{
+			name:     "all files except .git",
+			patterns: []string{"**"},
+			want:     []string{".gitignore", "main.go", "pkg/.gitignore", "pkg/debug.log", "pkg/p.go", "pkg/sub/gen.go"},
+		},
+		{
+			name:     "explicit paths are always included",
+			patterns: []string{"a.log", "vendor/v.go", "main.go", "*.go"},
+			want:     []string{"a.log", "vendor/v.go", "main.go"},
+		},
+		{
+			name:     "directory",
+			patterns: []string{"pkg"},
+			err:      "pkg is a directory, use glob pattern such as 'pkg/**' instead",
+		},
+		{
+			name:     "no match",
+			patterns: []string{"**/*.txt"},
+			err:      "no files matched: **/*.txt",
+		},
+		{
+			name:     "missing root",
+			patterns: []string{"missing/*.go"},
+			err:      "no files matched: missing/*.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := Glob(tt.patterns)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Glob() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Glob() returned error: %s", err)
+			}
+
+			want := []string{}
+			for _, p := range tt.want {
+				want = append(want, filepath.FromSlash(p))
+			}
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("Glob() = %q, want %q", paths, want)
+			}
+		})
+	}
+}
+
+func TestAttach(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, ".", map[string]string{
+		"docs/a.md":   "```go\nx\n```",
+		"docs/b.bin":  "PNG\x00\x01",
+		"docs/c.sh":   "echo hi\n",
+		"docs/d.conf": "",
+	})
+
+	got, err := Attach([]string{"docs/*"})
+	if err != nil {
+		t.Fatalf("Attach() returned error: %s", err)
+	}
+
+	want := "\n### docs/a.md\n\n````markdown\n```go\nx\n```\n````\n" +
+		"\n### docs/c.sh\n\n```bash\necho hi\n```\n" +
+		"\n### docs/d.conf\n\n```\n```\n"
+	if got != want {
+		t.Errorf("Attach() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{name: "text", content: "hello\n", want: false},
+		{name: "empty", content: "", want: false},
+		{name: "utf-8", content: "初音ミク\n", want: false},
+		{name: "NUL", content: "PNG\x00", want: true},
+		{name: "NUL in the sniffed bytes", content: strings.Repeat("a", binarySniffLen-1) + "\x00", want: true},
+		{name: "NUL after the sniffed bytes", content: strings.Repeat("a", binarySniffLen) + "\x00", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinary([]byte(tt.content)); got != tt.want {
+				t.Errorf("isBinary() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
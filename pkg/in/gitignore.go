@@ -0,0 +1,124 @@
+package in
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreFile is the name of the file which contains ignore rules
+const gitignoreFile = ".gitignore"
+
+// ignoreRule is a rule of .gitignore file
+type ignoreRule struct {
+	// base is the slash separated directory of .gitignore file, relative to the root of the walk
+	base string
+	// segments are the pattern split by slash
+	segments []string
+	negate   bool
+	dirOnly  bool
+	// anchored is true if the pattern is matched relative to base, otherwise it is matched against the name
+	anchored bool
+}
+
+// ignoreRules is a list of rules in order of precedence, the last matching rule wins
+type ignoreRules []ignoreRule
+
+// load appends rules of .gitignore file in dir, base is the slash separated dir relative to the root of the walk
+func (rules ignoreRules) load(dir string, base string) ignoreRules {
+	f, err := os.Open(filepath.Join(dir, gitignoreFile))
+	if err != nil {
+		return rules
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// a pattern which contains slash is anchored to the directory of .gitignore file
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// ignored returns true if the slash separated path relative to the root of the walk is ignored
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		// rules only apply to paths under the directory of .gitignore file
+		p := rel
+		if rule.base != "." {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(rel, rule.base+"/")
+		}
+
+		var matched bool
+		if rule.anchored {
+			matched = matchSegments(rule.segments, strings.Split(p, "/"))
+		} else {
+			matched, _ = path.Match(rule.segments[0], path.Base(p))
+		}
+
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// matchSegments matches path segments against pattern segments, '**' matches zero or more segments
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,97 @@
+package in
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore": `# comment
+
+*.log
+!keep.log
+build/
+/root.txt
+docs/*.md
+**/gen/*.go
+tmp
+`,
+		"sub/.gitignore": "!a.log\n/local.txt\n",
+	})
+
+	rules := ignoreRules{}.load(root, ".").load(filepath.Join(root, "sub"), "sub")
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		// unanchored patterns match the name at any depth
+		{rel: "a.log", want: true},
+		{rel: "x/y/a.log", want: true},
+		{rel: "main.go", want: false},
+		{rel: "tmp", want: true},
+		{rel: "x/tmp", isDir: true, want: true},
+
+		// negation
+		{rel: "keep.log", want: false},
+		{rel: "x/keep.log", want: false},
+
+		// dir-only rules
+		{rel: "build", isDir: true, want: true},
+		{rel: "x/build", isDir: true, want: true},
+		{rel: "build", want: false},
+
+		// anchored patterns match relative to the directory of .gitignore file
+		{rel: "root.txt", want: true},
+		{rel: "x/root.txt", want: false},
+		{rel: "docs/a.md", want: true},
+		{rel: "x/docs/a.md", want: false},
+		{rel: "docs/x/a.md", want: false},
+		{rel: "gen/a.go", want: true},
+		{rel: "x/y/gen/a.go", want: true},
+		{rel: "gen/x/a.go", want: false},
+
+		// nested .gitignore file applies only under its directory, and overrides the parent
+		{rel: "sub/a.log", want: false},
+		{rel: "sub/x/a.log", want: false},
+		{rel: "sub/b.log", want: true},
+		{rel: "sub/local.txt", want: true},
+		{rel: "sub/x/local.txt", want: false},
+		{rel: "local.txt", want: false},
+		{rel: "subdir/a.log", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := rules.ignored(tt.rel, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnoredWithoutFile(t *testing.T) {
+	rules := ignoreRules{}.load(t.TempDir(), ".")
+	if len(rules) != 0 || rules.ignored("a.log", false) {
+		t.Errorf("rules = %+v, want no rules without .gitignore file", rules)
+	}
+}
+
+// writeFiles writes files of the map from slash separated paths to contents under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for p, content := range files {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package out
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// CodeBlock is a fenced code block of markdown
+type CodeBlock struct {
+	// Lang is the language of info string, empty if it is not given
+	Lang string
+	Code string
+}
+
+// CodeBlocks returns fenced code blocks of the markdown in order, including ones in lists and quotes
+func CodeBlocks(markdown string) []CodeBlock {
+	source := []byte(markdown)
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	found := []CodeBlock{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		block, ok := n.(*ast.FencedCodeBlock)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		found = append(found, CodeBlock{Lang: string(block.Language(source)), Code: lines(block, source)})
+		return ast.WalkSkipChildren, nil
+	})
+
+	return found
+}
+
+// ExtractCode returns the code of fenced code blocks of the markdown.
+// empty lang matches any block, otherwise the language is compared case-insensitively.
+// block is the number of matched block starting from 1, and 0 means all matched blocks are joined.
+func ExtractCode(markdown string, lang string, block int) (string, error) {
+	matched := []CodeBlock{}
+	for _, b := range CodeBlocks(markdown) {
+		if lang == "" || strings.EqualFold(b.Lang, lang) {
+			matched = append(matched, b)
+		}
+	}
+
+	kind := "code block"
+	if lang != "" {
+		kind = lang + " code block"
+	}
+
+	switch {
+	case len(matched) == 0:
+		return "", fmt.Errorf("no %s is found in the answer", kind)
+	case block > len(matched):
+		return "", fmt.Errorf("%s %d is requested, but the answer has %d", kind, block, len(matched))
+	case block > 0:
+		return matched[block-1].Code, nil
+	}
+
+	var code strings.Builder
+	for _, b := range matched {
+		code.WriteString(b.Code)
+	}
+	return code.String(), nil
+}
@@ -0,0 +1,59 @@
+package out
+
+import (
+	"reflect"
+	"testing"
+)
+
+const answerWithCode = "Here is the config.\n\n```yaml\nname: miku\n```\n\nAnd the script:\n\n```sh\necho hello\n\necho bye\n```\n\n- in a list\n\n  ```YAML\n  age: 16\n  ```\n\n~~~\nplain\n~~~\n\n    indented is not fenced\n"
+
+func TestCodeBlocks(t *testing.T) {
+	want := []CodeBlock{
+		{Lang: "yaml", Code: "name: miku\n"},
+		{Lang: "sh", Code: "echo hello\n\necho bye\n"},
+		{Lang: "YAML", Code: "age: 16\n"},
+		{Lang: "", Code: "plain\n"},
+	}
+
+	if got := CodeBlocks(answerWithCode); !reflect.DeepEqual(got, want) {
+		t.Errorf("CodeBlocks() = %#v, want %#v", got, want)
+	}
+}
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		lang   string
+		block  int
+		code   string
+		err    string
+	}{
+		{"all blocks", answerWithCode, "", 0, "name: miku\necho hello\n\necho bye\nage: 16\nplain\n", ""},
+		{"language", answerWithCode, "sh", 0, "echo hello\n\necho bye\n", ""},
+		{"language is case-insensitive", answerWithCode, "yaml", 0, "name: miku\nage: 16\n", ""},
+		{"block of language", answerWithCode, "yaml", 2, "age: 16\n", ""},
+		{"block", answerWithCode, "", 4, "plain\n", ""},
+		{"no block of language", answerWithCode, "json", 0, "", "no json code block is found in the answer"},
+		{"block out of range", answerWithCode, "sh", 2, "", "sh code block 2 is requested, but the answer has 1"},
+		{"no code block", "just text\n", "", 0, "", "no code block is found in the answer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := ExtractCode(tt.answer, tt.lang, tt.block)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("ExtractCode() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCode() returned error: %s", err)
+			}
+			if code != tt.code {
+				t.Errorf("ExtractCode() = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
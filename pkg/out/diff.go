@@ -0,0 +1,203 @@
+package out
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes in a hunk
+const diffContext = 3
+
+// maxEditDistance is the maximum number of changed lines to find the shortest edit,
+// texts which differ more are shown as all lines removed and added
+const maxEditDistance = 2000
+
+// edit is an operation of a line to change old text into new text
+type edit struct {
+	// op is ' ' for an unchanged line, '-' for a removed line and '+' for an added line
+	op   byte
+	line string
+}
+
+// Diff returns unified diff of old and new text, empty if they are the same
+func Diff(oldName string, newName string, old string, new string) string {
+	if old == new {
+		return ""
+	}
+
+	edits := editScript(splitLines(old), splitLines(new))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(edits) {
+		b.WriteString(h)
+	}
+
+	return b.String()
+}
+
+// splitLines splits the text into lines, each line keeps its newline
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// editScript returns the shortest edit to change a into b by Myers' algorithm
+func editScript(a []string, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+
+	// v[offset+k] is the furthest x on diagonal k, trace[d] keeps v of diagonals -d to d after d edits
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	trace := [][]int{}
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrack(trace, a, b)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	// too many changes, all lines are replaced
+	edits := make([]edit, 0, n+m)
+	for _, line := range a {
+		edits = append(edits, edit{op: '-', line: line})
+	}
+	for _, line := range b {
+		edits = append(edits, edit{op: '+', line: line})
+	}
+	return edits
+}
+
+// backtrack follows the trace of editScript back from the end, and returns the edits in order
+func backtrack(trace [][]int, a []string, b []string) []edit {
+	edits := []edit{}
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{op: ' ', line: a[x-1]})
+			x--
+			y--
+		}
+		if prevK == k+1 {
+			edits = append(edits, edit{op: '+', line: b[prevY]})
+		} else {
+			edits = append(edits, edit{op: '-', line: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 {
+		edits = append(edits, edit{op: ' ', line: a[x-1]})
+		x--
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// hunks groups the edits into hunks of unified diff, changes close to each other are put into one hunk
+func hunks(edits []edit) []string {
+	// oldLine and newLine are the number of lines before each edit
+	oldLine := make([]int, len(edits)+1)
+	newLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if e.op != '+' {
+			oldLine[i+1]++
+		}
+		if e.op != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	result := []string{}
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// extend the hunk while the next change is within the context of the last one
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+		for j := i; j < len(edits) && j <= end+2*diffContext+1; j++ {
+			if edits[j].op != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]),
+		)
+		for _, e := range edits[start:stop] {
+			b.WriteByte(e.op)
+			b.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		result = append(result, b.String())
+
+		i = stop
+	}
+
+	return result
+}
+
+// hunkRange returns the range of lines in hunk header, the start is the line before the hunk if it has no lines
+func hunkRange(before int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
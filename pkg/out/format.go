@@ -0,0 +1,98 @@
+package out
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// output formats
+const (
+	// FormatRaw writes the answer as it is
+	FormatRaw = "raw"
+	// FormatMarkdown renders the answer as markdown if the output is a tty
+	FormatMarkdown = "markdown"
+	// FormatJSON writes the answer in an envelope of JSON with metadata of the response
+	FormatJSON = "json"
+	// FormatYAML writes the answer in an envelope of YAML with metadata of the response
+	FormatYAML = "yaml"
+	// FormatText writes the answer with markdown stripped
+	FormatText = "text"
+)
+
+// Formats are available output formats
+var Formats = []string{FormatRaw, FormatMarkdown, FormatJSON, FormatYAML, FormatText}
+
+// Envelope is the answer with metadata of the response, written in json and yaml format
+type Envelope struct {
+	// Content is the answer in text, or the result in JSON of function call and output schema
+	Content      interface{} `json:"content" yaml:"content"`
+	Model        string      `json:"model,omitempty" yaml:"model,omitempty"`
+	Usage        *Usage      `json:"usage,omitempty" yaml:"usage,omitempty"`
+	FinishReason string      `json:"finish_reason,omitempty" yaml:"finish_reason,omitempty"`
+	// Cached is true if the answer is taken from cache, its usage is of the request which cached it
+	Cached bool `json:"cached,omitempty" yaml:"cached,omitempty"`
+}
+
+// Usage is the number of tokens used by the answer
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens" yaml:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens" yaml:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens" yaml:"total_tokens"`
+	// Cost is estimated cost in USD, nil if the price of the model is unknown
+	Cost *float64 `json:"cost,omitempty" yaml:"cost,omitempty"`
+}
+
+// IsEnvelope returns whether the answer is written in an envelope in the format
+func IsEnvelope(format string) bool {
+	return format == FormatJSON || format == FormatYAML
+}
+
+// NewFormat returns a new Output struct which writes text answers in the format.
+// answers in envelope formats are written by EmitEnvelope instead.
+func NewFormat(out *os.File, format string) *Out {
+	switch format {
+	case FormatMarkdown:
+		return New(out, MarkdownFormatter)
+	case FormatText:
+		o := New(out, TextFormatter)
+		o.always = true
+		return o
+	}
+
+	return New(out, nil)
+}
+
+// EmitEnvelope writes the envelope in the format, an envelope of JSON is written in a line.
+// envelopes of YAML are separated as documents if more than one are written.
+func (o *Out) EmitEnvelope(format string, envelope *Envelope) error {
+	var raw []byte
+	var err error
+
+	switch format {
+	case FormatJSON:
+		raw, err = json.Marshal(envelope)
+		raw = append(raw, '\n')
+	case FormatYAML:
+		var b bytes.Buffer
+		if o.documents > 0 {
+			b.WriteString("---\n")
+		}
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(2)
+		err = encoder.Encode(envelope)
+		raw = b.Bytes()
+		o.documents++
+	default:
+		return fmt.Errorf("%s format has no envelope", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = o.Out.Write(raw)
+	return err
+}
@@ -0,0 +1,102 @@
+package out
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		text     string
+	}{
+		{"empty", "", ""},
+		{"paragraph", "Hello **world** and `code`.\n", "Hello world and code.\n"},
+		{"heading", "# Title\n\nbody\n", "Title\n\nbody\n"},
+		{"soft line break", "first\nsecond\n", "first\nsecond\n"},
+		{"fenced code", "```go\nfmt.Println(1)\n\nx := 2\n```\n", "fmt.Println(1)\n\nx := 2\n"},
+		{"link", "see [docs](https://example.com)\n", "see docs (https://example.com)\n"},
+		{"autolink", "<https://example.com>\n", "https://example.com\n"},
+		{"tight list", "- one\n- *two*\n", "- one\n- two\n"},
+		{"ordered list", "3. one\n4. two\n", "3. one\n4. two\n"},
+		{"nested list", "- one\n  - inner\n- two\n", "- one\n  - inner\n- two\n"},
+		{"blockquote", "> quoted\n", "quoted\n"},
+		{"thematic break", "a\n\n---\n\nb\n", "a\n\nb\n"},
+		{"block terminated by blank line", "block\n\n", "block\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripMarkdown(tt.markdown); got != tt.text {
+				t.Errorf("StripMarkdown(%q) = %q, want %q", tt.markdown, got, tt.text)
+			}
+		})
+	}
+}
+
+func TestEmitEnvelope(t *testing.T) {
+	envelope := &Envelope{
+		Content:      "answer",
+		Model:        "gpt-4",
+		Usage:        &Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+		FinishReason: "stop",
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatJSON, `{"content":"answer","model":"gpt-4","usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7},"finish_reason":"stop"}
+{"content":"answer","model":"gpt-4","usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7},"finish_reason":"stop"}
+`},
+		{FormatYAML, `content: answer
+model: gpt-4
+usage:
+  prompt_tokens: 3
+  completion_tokens: 4
+  total_tokens: 7
+finish_reason: stop
+---
+content: answer
+model: gpt-4
+usage:
+  prompt_tokens: 3
+  completion_tokens: 4
+  total_tokens: 7
+finish_reason: stop
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			o := NewFormat(file, tt.format)
+			for i := 0; i < 2; i++ {
+				if err := o.EmitEnvelope(tt.format, envelope); err != nil {
+					t.Fatalf("EmitEnvelope returned error: %s", err)
+				}
+			}
+
+			raw, err := os.ReadFile(file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != tt.want {
+				t.Errorf("EmitEnvelope wrote %q, want %q", raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmitEnvelopeWithoutEnvelopeFormat(t *testing.T) {
+	if err := NewFormat(os.Stdout, FormatRaw).EmitEnvelope(FormatRaw, &Envelope{}); err == nil {
+		t.Error("EmitEnvelope in raw format returned no error")
+	}
+}
@@ -11,6 +11,11 @@ type Formatter func(*os.File, string) string
 type Out struct {
 	Out       *os.File
 	Formatter Formatter
+
+	// always applies the formatter to the stream even if the output is not a tty
+	always bool
+	// documents is the number of YAML documents written
+	documents int
 }
 
 // NewOutput returns a new Output struct.
@@ -0,0 +1,97 @@
+package out
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Stream returns a writer that emits chunks to the output destination as they are written.
+// if the output is not a tty or no formatter is provided, chunks are passed through as they are,
+// unless the formatter is applied regardless of tty.
+// otherwise, chunks are buffered and formatted block by block. the writer must be closed to flush remaining block.
+func (o *Out) Stream() io.WriteCloser {
+	if o.Formatter == nil || (!o.always && !isatty.IsTerminal(o.Out.Fd())) {
+		return &rawWriter{out: o.Out}
+	}
+
+	return &blockWriter{out: o}
+}
+
+// rawWriter is a writer that passes chunks through to the output destination.
+type rawWriter struct {
+	out *os.File
+}
+
+// Write writes chunk to the output destination.
+func (w *rawWriter) Write(p []byte) (int, error) {
+	return w.out.Write(p)
+}
+
+// Close does nothing, there is nothing to flush.
+func (w *rawWriter) Close() error {
+	return nil
+}
+
+// blockWriter is a writer that formats chunks block by block.
+// a block is terminated by a blank line outside of fenced code block.
+type blockWriter struct {
+	out *Out
+
+	// line is the incomplete line which is not terminated by newline yet
+	line strings.Builder
+	// block is the incomplete block which is not terminated by blank line yet
+	block strings.Builder
+	// fenced is true if current line is inside of fenced code block
+	fenced bool
+}
+
+// Write buffers chunk, and emits every completed block.
+func (w *blockWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		w.line.WriteByte(c)
+		if c != '\n' {
+			continue
+		}
+
+		// a line is completed
+		line := w.line.String()
+		w.line.Reset()
+		w.block.WriteString(line)
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			w.fenced = !w.fenced
+		}
+
+		// a block is completed
+		if trimmed == "" && !w.fenced {
+			w.flush()
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close emits the remaining block.
+func (w *blockWriter) Close() error {
+	w.block.WriteString(w.line.String())
+	w.line.Reset()
+	w.flush()
+
+	return nil
+}
+
+// flush emits buffered block if it has any content.
+func (w *blockWriter) flush() {
+	block := w.block.String()
+	w.block.Reset()
+
+	if strings.TrimSpace(block) == "" {
+		return
+	}
+
+	w.out.Emit(block)
+}
@@ -0,0 +1,153 @@
+package out
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// TextFormatter is a Formatter that strips markdown from a string, regardless of tty.
+func TextFormatter(out *os.File, s string) string {
+	return StripMarkdown(s)
+}
+
+// StripMarkdown returns plain text of the markdown.
+// blocks are separated by a blank line, code blocks are kept as they are, and list items keep their markers.
+func StripMarkdown(s string) string {
+	source := []byte(s)
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	stripped := blocks(doc, source, true)
+	if stripped == "" {
+		return ""
+	}
+
+	// a block terminated by a blank line is kept terminated, so that streamed blocks are still separated
+	if strings.HasSuffix(s, "\n\n") {
+		stripped += "\n"
+	}
+	return stripped
+}
+
+// blocks returns plain text of child blocks of the node, each block is terminated by a newline.
+// blocks are separated by a blank line if loose is true.
+func blocks(n ast.Node, source []byte, loose bool) string {
+	var b strings.Builder
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		block := plainBlock(child, source)
+		if block == "" {
+			continue
+		}
+
+		if loose && b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(block)
+	}
+
+	return b.String()
+}
+
+// plainBlock returns plain text of the block terminated by a newline, empty if the block has no text
+func plainBlock(n ast.Node, source []byte) string {
+	switch n := n.(type) {
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		return lines(n, source)
+	case *ast.HTMLBlock:
+		html := lines(n, source)
+		if n.HasClosure() {
+			html += string(n.ClosureLine.Value(source))
+		}
+		return html
+	case *ast.ThematicBreak:
+		return ""
+	case *ast.Blockquote:
+		return blocks(n, source, true)
+	case *ast.List:
+		var b strings.Builder
+		number := n.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			marker := "- "
+			if n.IsOrdered() {
+				marker = fmt.Sprintf("%d. ", number)
+				number++
+			}
+			if !n.IsTight && b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(indent(blocks(item, source, !n.IsTight), marker))
+		}
+		return b.String()
+	}
+
+	inline := strings.TrimRight(inlines(n, source), "\n")
+	if inline == "" {
+		return ""
+	}
+	return inline + "\n"
+}
+
+// lines returns raw lines of the block
+func lines(n ast.Node, source []byte) string {
+	var b strings.Builder
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		b.Write(line.Value(source))
+	}
+
+	return b.String()
+}
+
+// inlines returns plain text of inline children of the node, the destination of link follows its text
+func inlines(n ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if link, ok := child.(*ast.Link); ok && string(link.Destination) != string(link.Text(source)) {
+				fmt.Fprintf(&b, " (%s)", link.Destination)
+			}
+			return ast.WalkContinue, nil
+		}
+
+		switch child := child.(type) {
+		case *ast.Text:
+			b.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				b.WriteString("\n")
+			}
+		case *ast.String:
+			b.Write(child.Value)
+		case *ast.AutoLink:
+			b.Write(child.URL(source))
+		case *ast.RawHTML:
+			for i := 0; i < child.Segments.Len(); i++ {
+				segment := child.Segments.At(i)
+				b.Write(segment.Value(source))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return b.String()
+}
+
+// indent prefixes the first line of the text with the marker, and the rest with spaces of the same width
+func indent(text string, marker string) string {
+	var b strings.Builder
+	for i, line := range strings.SplitAfter(text, "\n") {
+		switch {
+		case line == "" || line == "\n":
+			b.WriteString(line)
+		case i == 0:
+			b.WriteString(marker + line)
+		default:
+			b.WriteString(strings.Repeat(" ", len(marker)) + line)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data is the data given to role and prompt templates
+type Data struct {
+	// Args are positional arguments of the command
+	Args []string
+	// Vars are variables given by flags or defaults of subcommand
+	Vars map[string]string
+	// Env are environment variables
+	Env map[string]string
+
+	input       string
+	inputPlaced bool
+
+	record       map[string]interface{}
+	recordPlaced bool
+}
+
+// NewData returns a new Data with given input, arguments and variables
+func NewData(input string, args []string, vars map[string]string) *Data {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	if args == nil {
+		args = []string{}
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	return &Data{
+		Args:  args,
+		Vars:  vars,
+		Env:   env,
+		input: input,
+	}
+}
+
+// Input returns the input, and marks that it is placed by the template
+func (d *Data) Input() string {
+	d.inputPlaced = true
+	return d.input
+}
+
+// InputPlaced returns true if the input is placed by any rendered template
+func (d *Data) InputPlaced() bool {
+	return d.inputPlaced
+}
+
+// WithRecord sets the record of batch mode, and returns the data
+func (d *Data) WithRecord(record map[string]interface{}) *Data {
+	d.record = record
+	return d
+}
+
+// Record returns fields of the record in batch mode, and marks that it is placed by the template
+func (d *Data) Record() map[string]interface{} {
+	d.recordPlaced = true
+	return d.record
+}
+
+// RecordPlaced returns true if the record is placed by any rendered template
+func (d *Data) RecordPlaced() bool {
+	return d.recordPlaced
+}
+
+// Render renders the template text with the data, name is used in error messages
+func Render(name string, text string, data *Data) (string, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// funcs are helper functions available in templates
+var funcs = template.FuncMap{
+	"file":       readFile,
+	"now":        now,
+	"git_branch": gitBranch,
+}
+
+// readFile returns the contents of the file
+func readFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
+
+// now returns the current time, monotonic clock reading is stripped to print it in a readable way
+func now() time.Time {
+	return time.Now().Round(0)
+}
+
+// gitBranch returns the current branch of git repository in working directory, empty if HEAD is detached
+func gitBranch() (string, error) {
+	out, err := exec.Command("git", "branch", "--show-current").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("can't get git branch: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("can't get git branch: %w", err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
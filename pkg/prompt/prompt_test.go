@@ -0,0 +1,117 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	t.Setenv("PIPEGPT_TEST_USER", "miku")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "style.md")
+	if err := os.WriteFile(path, []byte("be brief"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		text   string
+		want   string
+		placed bool
+	}{
+		{name: "plain text", text: "Translate the text.", want: "Translate the text."},
+		{name: "input", text: "Translate: {{.Input}}", want: "Translate: hello", placed: true},
+		{name: "args", text: "{{index .Args 0}} of {{len .Args}}", want: "first of 2"},
+		{name: "vars", text: "Translate into {{.Vars.to}}.", want: "Translate into ja."},
+		{name: "default of missing var", text: `{{or (index .Vars "tone") "formal"}}`, want: "formal"},
+		{name: "env", text: "Hello, {{.Env.PIPEGPT_TEST_USER}}.", want: "Hello, miku."},
+		{name: "file", text: `Style: {{file "` + filepath.ToSlash(path) + `"}}`, want: "Style: be brief"},
+		{name: "input in condition", text: `{{if .Input}}given{{end}}`, want: "given", placed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := NewData("hello", []string{"first", "second"}, map[string]string{"to": "ja"})
+
+			got, err := Render("prompt", tt.text, data)
+			if err != nil {
+				t.Fatalf("Render() returned error: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+			if data.InputPlaced() != tt.placed {
+				t.Errorf("InputPlaced() = %v, want %v", data.InputPlaced(), tt.placed)
+			}
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "undeclared var", text: "Translate into {{.Vars.lang}}.", want: `map has no entry for key "lang"`},
+		{name: "missing file", text: `{{file "missing.md"}}`, want: "missing.md: no such file or directory"},
+		{name: "syntax", text: "{{.Vars.to", want: "template: role:1: unclosed action"},
+		{name: "unknown function", text: "{{shell \"date\"}}", want: `function "shell" not defined`},
+		{name: "unknown field", text: "{{.Stdin}}", want: "can't evaluate field Stdin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render("role", tt.text, NewData("", nil, nil))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Render() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputPlaced(t *testing.T) {
+	// input placed by any of templates rendered with the data is not given again
+	data := NewData("hello", nil, nil)
+	if _, err := Render("role", "You are a translator.", data); err != nil {
+		t.Fatal(err)
+	}
+	if data.InputPlaced() {
+		t.Errorf("InputPlaced() = true before input is referenced")
+	}
+	if _, err := Render("prompt", "Translate: {{.Input}}", data); err != nil {
+		t.Fatal(err)
+	}
+	if !data.InputPlaced() {
+		t.Errorf("InputPlaced() = false after input is referenced")
+	}
+}
+
+func TestRecordPlaced(t *testing.T) {
+	data := NewData("", nil, nil).WithRecord(map[string]interface{}{"id": float64(1), "text": "hello"})
+
+	got, err := Render("prompt", "Translate: {{.Input}}", data)
+	if err != nil || got != "Translate: " || data.RecordPlaced() {
+		t.Errorf("Render() = %q, %v, record placed = %v, want no record", got, err, data.RecordPlaced())
+	}
+
+	got, err = Render("prompt", "Translate {{.Record.id}}: {{.Record.text}}", data)
+	if err != nil || got != "Translate 1: hello" || !data.RecordPlaced() {
+		t.Errorf("Render() = %q, %v, record placed = %v, want the record", got, err, data.RecordPlaced())
+	}
+}
+
+func TestNewData(t *testing.T) {
+	t.Setenv("PIPEGPT_TEST_VALUE", "a=b")
+
+	data := NewData("input", nil, nil)
+	if data.Args == nil || data.Vars == nil {
+		t.Errorf("NewData() = %+v, want empty args and vars", data)
+	}
+	if data.Env["PIPEGPT_TEST_VALUE"] != "a=b" {
+		t.Errorf("Env = %q, want the value with '='", data.Env["PIPEGPT_TEST_VALUE"])
+	}
+}
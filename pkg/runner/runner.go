@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// dangerousPatterns are patterns of commands which are always confirmed before they are executed, by description
+var dangerousPatterns = []struct {
+	Description string
+	Match       func(command string) bool
+}{
+	{"recursive removal of root or home", recursiveRemoval},
+	{"removal without root protection", regexp.MustCompile(`\brm\b.*--no-preserve-root`).MatchString},
+	{"filesystem creation", regexp.MustCompile(`\bmkfs(\.\w+)?\b`).MatchString},
+	{"direct write to device", regexp.MustCompile(`\bdd\b.*\bof=/dev/|>\s*/dev/(sd|nvme|hd|disk)`).MatchString},
+	{"downloaded script piped to shell", regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z|da|k|fi)?sh\b`).MatchString},
+	{"fork bomb", regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`).MatchString},
+}
+
+// Dangerous returns the description of dangerous pattern which the command matches, and whether it matches any
+func Dangerous(command string) (string, bool) {
+	for _, p := range dangerousPatterns {
+		if p.Match(command) {
+			return p.Description, true
+		}
+	}
+
+	return "", false
+}
+
+// recursiveRemoval reports whether the command removes root or home directory recursively.
+// flags may be combined (-rf), separated (-r -f) or long (--recursive), and rm anywhere in the command is checked
+// so that it is also found after sudo, xargs or in a subshell.
+func recursiveRemoval(command string) bool {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return strings.ContainsRune(";&|()`\n", r)
+	})
+
+	for _, segment := range segments {
+		words := strings.Fields(segment)
+		for i, word := range words {
+			if path.Base(strings.Trim(word, `"'`)) == "rm" && removesRoot(words[i+1:]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// removesRoot reports whether arguments of rm are recursive and include root or home directory
+func removesRoot(args []string) bool {
+	recursive, root, options := false, false, true
+	for _, arg := range args {
+		arg = strings.Trim(arg, `"'`)
+		switch {
+		case options && arg == "--":
+			options = false
+		case options && arg == "--recursive":
+			recursive = true
+		case options && strings.HasPrefix(arg, "--"):
+		case options && strings.HasPrefix(arg, "-") && len(arg) > 1:
+			recursive = recursive || strings.ContainsAny(arg[1:], "rR")
+		default:
+			root = root || rootPath(arg)
+		}
+	}
+
+	return recursive && root
+}
+
+// rootPath reports whether the path is root or home directory, or all files of them
+func rootPath(p string) bool {
+	if !strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "~") && !strings.HasPrefix(p, "$HOME") && !strings.HasPrefix(p, "${HOME}") {
+		return false
+	}
+
+	p = strings.TrimSuffix(p, "*")
+	p = strings.TrimRight(strings.TrimSuffix(p, "/."), "/")
+	switch p {
+	case "", "~", "$HOME", "${HOME}":
+		return true
+	}
+	return false
+}
+
+// Shell returns the shell to execute commands, $SHELL or sh if it is not set
+func Shell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+
+	return "sh"
+}
+
+// Command returns the command to execute by the shell, it is killed when the context is done
+func Command(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, Shell(), "-c", command)
+}
+
+// Run executes the command by the shell with stdin, stdout and stderr, and returns its exit status.
+// error is returned only if the command can't be started.
+func Run(command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	cmd := Command(context.Background(), command)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, err
+	}
+
+	// the status is -1 if the command is killed by signal
+	if status := exitErr.ExitCode(); status > 0 {
+		return status, nil
+	}
+	return 1, nil
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDangerous(t *testing.T) {
+	tests := []struct {
+		command     string
+		description string
+	}{
+		{"ls -la", ""},
+		{"rm -rf ./build", ""},
+		{"rm -f /tmp/file", ""},
+		{"rm -r /var/tmp/cache", ""},
+		{"rm -rf *", ""},
+		{"echo mkfsx", ""},
+		{"curl -o out.sh https://example.com/install.sh", ""},
+		{"rm -rf /", "recursive removal of root or home"},
+		{"rm -fr /", "recursive removal of root or home"},
+		{"rm -Rf /*", "recursive removal of root or home"},
+		{"rm -r -f /", "recursive removal of root or home"},
+		{"rm -f -r /", "recursive removal of root or home"},
+		{"rm --recursive --force /", "recursive removal of root or home"},
+		{"rm --force --recursive -- /", "recursive removal of root or home"},
+		{"sudo rm -rf ~", "recursive removal of root or home"},
+		{"/bin/rm -rf \"$HOME/\"", "recursive removal of root or home"},
+		{"cd /tmp && rm -r -f ${HOME}", "recursive removal of root or home"},
+		{"find . | xargs rm -rf /", "recursive removal of root or home"},
+		{"rm -f --no-preserve-root x", "removal without root protection"},
+		{"mkfs.ext4 /dev/sdb1", "filesystem creation"},
+		{"dd if=image.iso of=/dev/sdb", "direct write to device"},
+		{"cat image > /dev/nvme0n1", "direct write to device"},
+		{"curl -fsSL https://example.com/install.sh | sh", "downloaded script piped to shell"},
+		{"wget -qO- https://example.com | sudo bash", "downloaded script piped to shell"},
+		{":(){ :|:& };:", "fork bomb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			description, dangerous := Dangerous(tt.command)
+			if dangerous != (tt.description != "") || description != tt.description {
+				t.Errorf("Dangerous(%q) = (%q, %v), want %q", tt.command, description, dangerous, tt.description)
+			}
+		})
+	}
+}
+
+func TestShell(t *testing.T) {
+	t.Setenv("SHELL", "")
+	if got := Shell(); got != "sh" {
+		t.Errorf("Shell() = %q, want sh", got)
+	}
+
+	t.Setenv("SHELL", "/bin/bash")
+	if got := Shell(); got != "/bin/bash" {
+		t.Errorf("Shell() = %q, want /bin/bash", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("SHELL", "sh")
+
+	tests := []struct {
+		name    string
+		command string
+		stdin   string
+		status  int
+		stdout  string
+		stderr  string
+	}{
+		{"success", "echo hello", "", 0, "hello\n", ""},
+		{"stdin", "tr a-z A-Z", "hello", 0, "HELLO", ""},
+		{"stderr", "echo oops >&2", "", 0, "", "oops\n"},
+		{"exit status", "exit 3", "", 3, "", ""},
+		{"failed command", "false", "", 1, "", ""},
+		{"killed by signal", "kill -TERM $$", "", 1, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status, err := Run(tt.command, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("Run(%q) returned error: %s", tt.command, err)
+			}
+			if status != tt.status {
+				t.Errorf("Run(%q) status = %d, want %d", tt.command, status, tt.status)
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("Run(%q) stdout = %q, want %q", tt.command, stdout.String(), tt.stdout)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("Run(%q) stderr = %q, want %q", tt.command, stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
+
+func TestRunNotStarted(t *testing.T) {
+	t.Setenv("SHELL", "/nonexistent/shell")
+
+	if _, err := Run("true", strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("Run with missing shell returned no error")
+	}
+}
@@ -0,0 +1,231 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// Violation is a part of value which does not satisfy the schema
+type Violation struct {
+	// Path is JSON path of the value, such as $.items[0].name
+	Path    string
+	Message string
+}
+
+// String returns the violation in "path: message" form
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// Error is returned if the value does not satisfy the schema, it has all violations of the value
+type Error struct {
+	Violations []Violation
+}
+
+// Error returns violations separated by semicolons
+func (e *Error) Error() string {
+	violations := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		violations = append(violations, v.String())
+	}
+
+	return strings.Join(violations, "; ")
+}
+
+// FromParameters converts parameters of function definition into the schema
+func FromParameters(params interface{}) (jsonschema.Definition, error) {
+	switch p := params.(type) {
+	case jsonschema.Definition:
+		return p, nil
+	case *jsonschema.Definition:
+		return *p, nil
+	}
+
+	raw, ok := params.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(params); err != nil {
+			return jsonschema.Definition{}, err
+		}
+	}
+
+	var def jsonschema.Definition
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return jsonschema.Definition{}, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return def, nil
+}
+
+// Validate validates the value decoded from JSON against the schema.
+// *Error is returned if the value does not satisfy the schema.
+func Validate(def jsonschema.Definition, v interface{}) error {
+	validator := &validator{defs: jsonschema.CollectDefs(def)}
+	validator.validate(def, "$", v)
+
+	if len(validator.violations) > 0 {
+		return &Error{Violations: validator.violations}
+	}
+
+	return nil
+}
+
+// validator collects violations of a value
+type validator struct {
+	defs       map[string]jsonschema.Definition
+	violations []Violation
+}
+
+// violate adds a violation of the value at path
+func (r *validator) violate(path string, format string, a ...interface{}) {
+	r.violations = append(r.violations, Violation{Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// validate validates the value at path against the schema
+func (r *validator) validate(def jsonschema.Definition, path string, v interface{}) {
+	if def.Ref != "" {
+		ref, ok := r.defs[def.Ref]
+		if !ok {
+			r.violate(path, "unresolved reference %s in schema", def.Ref)
+			return
+		}
+		def = ref
+	}
+
+	if v == nil {
+		if def.Type != "" && def.Type != jsonschema.Null && !def.Nullable {
+			r.violate(path, "expected %s, got null", def.Type)
+		}
+		return
+	}
+
+	switch def.Type {
+	case jsonschema.Object:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			r.violate(path, "expected object, got %s", typeOf(v))
+			return
+		}
+		r.validateObject(def, path, obj)
+		return
+	case jsonschema.Array:
+		items, ok := v.([]interface{})
+		if !ok {
+			r.violate(path, "expected array, got %s", typeOf(v))
+			return
+		}
+		if def.Items != nil {
+			for i, item := range items {
+				r.validate(*def.Items, fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+		return
+	case jsonschema.Integer:
+		if n, ok := number(v); !ok || n != math.Trunc(n) {
+			r.violate(path, "expected integer, got %s", typeOf(v))
+			return
+		}
+	case jsonschema.Number:
+		if _, ok := number(v); !ok {
+			r.violate(path, "expected number, got %s", typeOf(v))
+			return
+		}
+	case jsonschema.String, jsonschema.Boolean, jsonschema.Null:
+		if t := typeOf(v); t != string(def.Type) {
+			r.violate(path, "expected %s, got %s", def.Type, t)
+			return
+		}
+	}
+
+	if len(def.Enum) > 0 && !contains(def.Enum, fmt.Sprint(v)) {
+		r.violate(path, "must be one of %s, got %s", strings.Join(def.Enum, ", "), fmt.Sprint(v))
+	}
+}
+
+// validateObject validates required, properties and additional properties of the object
+func (r *validator) validateObject(def jsonschema.Definition, path string, obj map[string]interface{}) {
+	for _, key := range def.Required {
+		if _, ok := obj[key]; !ok {
+			r.violate(path+"."+key, "is required")
+		}
+	}
+
+	// properties are validated in order of keys, so that violations are stable
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if prop, ok := def.Properties[key]; ok {
+			r.validate(prop, path+"."+key, obj[key])
+			continue
+		}
+
+		switch additional := def.AdditionalProperties.(type) {
+		case nil, bool:
+			if additional == false {
+				r.violate(path+"."+key, "is not allowed")
+			}
+		default:
+			prop, err := FromParameters(additional)
+			if err != nil {
+				r.violate(path+"."+key, "%s", err)
+				continue
+			}
+			r.validate(prop, path+"."+key, obj[key])
+		}
+	}
+}
+
+// number returns the value as float64 if it is a number
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// typeOf returns JSON type of the value
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64, int, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// contains is function to check whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,234 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// person is the schema of tests, whose address is given by reference
+const person = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer"},
+		"height": {"type": "number"},
+		"admin": {"type": "boolean"},
+		"role": {"type": "string", "enum": ["owner", "member"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"address": {"$ref": "#/$defs/address"},
+		"nickname": {"type": "string", "nullable": true}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}},
+			"required": ["city"]
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	def, err := FromParameters(json.RawMessage(person))
+	if err != nil {
+		t.Fatalf("FromParameters() returned error: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			value: `{"name":"miku","age":16,"height":158.5,"admin":false,"role":"owner","tags":["a"],"address":{"city":"sapporo"},"nickname":null}`,
+		},
+		{
+			name:  "integer is a number",
+			value: `{"name":"miku","age":16,"height":158}`,
+		},
+		{
+			name:  "missing required",
+			value: `{}`,
+			want:  []string{"$.name: is required", "$.age: is required"},
+		},
+		{
+			name:  "type mismatch",
+			value: `{"name":39,"age":"16","admin":"yes","tags":"a"}`,
+			want: []string{
+				"$.admin: expected boolean, got string",
+				"$.age: expected integer, got string",
+				"$.name: expected string, got number",
+				"$.tags: expected array, got string",
+			},
+		},
+		{
+			name:  "number is not an integer",
+			value: `{"name":"miku","age":16.5,"height":"tall"}`,
+			want:  []string{"$.age: expected integer, got number", "$.height: expected number, got string"},
+		},
+		{
+			name:  "null is not allowed",
+			value: `{"name":null,"age":16}`,
+			want:  []string{"$.name: expected string, got null"},
+		},
+		{
+			name:  "enum",
+			value: `{"name":"miku","age":16,"role":"guest"}`,
+			want:  []string{"$.role: must be one of owner, member, got guest"},
+		},
+		{
+			name:  "items",
+			value: `{"name":"miku","age":16,"tags":["a",1,"b",true]}`,
+			want:  []string{"$.tags[1]: expected string, got number", "$.tags[3]: expected string, got boolean"},
+		},
+		{
+			name:  "reference",
+			value: `{"name":"miku","age":16,"address":{"zip":"060"}}`,
+			want:  []string{"$.address.city: is required"},
+		},
+		{
+			name:  "reference type mismatch",
+			value: `{"name":"miku","age":16,"address":"sapporo"}`,
+			want:  []string{"$.address: expected object, got string"},
+		},
+		{
+			name:  "additional properties",
+			value: `{"name":"miku","age":16,"color":"teal","brand":"crypton"}`,
+			want:  []string{"$.brand: is not allowed", "$.color: is not allowed"},
+		},
+		{
+			name:  "not an object",
+			value: `["miku"]`,
+			want:  []string{"$: expected object, got array"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(tt.value), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			assertViolations(t, Validate(def, v), tt.want)
+		})
+	}
+}
+
+func TestValidateAdditionalProperties(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   []string
+	}{
+		{
+			name:   "allowed by default",
+			schema: `{"type":"object","properties":{"name":{"type":"string"}}}`,
+		},
+		{
+			name:   "allowed explicitly",
+			schema: `{"type":"object","properties":{"name":{"type":"string"}},"additionalProperties":true}`,
+		},
+		{
+			name:   "not allowed",
+			schema: `{"type":"object","properties":{"name":{"type":"string"}},"additionalProperties":false}`,
+			want:   []string{"$.count: is not allowed", "$.label: is not allowed"},
+		},
+		{
+			name:   "schema of additional properties",
+			schema: `{"type":"object","properties":{"name":{"type":"string"}},"additionalProperties":{"type":"integer"}}`,
+			want:   []string{"$.label: expected integer, got string"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def, err := FromParameters(json.RawMessage(tt.schema))
+			if err != nil {
+				t.Fatalf("FromParameters() returned error: %s", err)
+			}
+
+			value := map[string]interface{}{"name": "miku", "count": float64(39), "label": "crypton"}
+			assertViolations(t, Validate(def, value), tt.want)
+		})
+	}
+}
+
+func TestValidateUnresolvedReference(t *testing.T) {
+	def := jsonschema.Definition{
+		Type:       jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{"address": {Ref: "#/$defs/missing"}},
+	}
+
+	err := Validate(def, map[string]interface{}{"address": "sapporo"})
+	assertViolations(t, err, []string{"$.address: unresolved reference #/$defs/missing in schema"})
+}
+
+func TestFromParameters(t *testing.T) {
+	want := jsonschema.Definition{
+		Type:       jsonschema.Object,
+		Properties: map[string]jsonschema.Definition{"name": {Type: jsonschema.String}},
+		Required:   []string{"name"},
+	}
+
+	tests := []struct {
+		name   string
+		params interface{}
+	}{
+		{"definition", want},
+		{"pointer of definition", &want},
+		{"raw message", json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}`)},
+		{"map", map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+			"required":   []string{"name"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromParameters(tt.params)
+			if err != nil {
+				t.Fatalf("FromParameters() returned error: %s", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("FromParameters() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := FromParameters(json.RawMessage(`{"type":`)); err == nil {
+		t.Errorf("FromParameters() of broken schema returned no error")
+	}
+}
+
+// assertViolations checks that err is *Error which has the violations in order, or nil if no violation is wanted
+func assertViolations(t *testing.T, err error, want []string) {
+	t.Helper()
+
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("Validate() returned error: %s", err)
+		}
+		return
+	}
+
+	var invalid *Error
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate() error = %v, want violations %q", err, want)
+	}
+
+	got := make([]string, 0, len(invalid.Violations))
+	for _, v := range invalid.Violations {
+		got = append(got, v.String())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations = %q, want %q", got, want)
+	}
+}
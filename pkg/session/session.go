@@ -0,0 +1,192 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fileExt is the extension of session files
+const fileExt = ".json"
+
+// Session is a named conversation stored on disk
+type Session struct {
+	Name     string
+	Messages []openai.ChatCompletionMessage
+}
+
+// Info is a summary of a stored session
+type Info struct {
+	Name      string
+	Messages  int
+	UpdatedAt time.Time
+}
+
+// Dir returns the directory where sessions are stored.
+// it is $XDG_STATE_HOME/pipegpt/sessions, or $HOME/.local/state/pipegpt/sessions if XDG_STATE_HOME is not set.
+func Dir() (string, error) {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(state, "pipegpt", "sessions"), nil
+}
+
+// Load loads the session of given name, an empty session is returned if it does not exist
+func Load(name string) (*Session, error) {
+	path, err := filePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Session{Name: name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []openai.ChatCompletionMessage
+	if err := json.Unmarshal(raw, &msgs); err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", name, err)
+	}
+
+	return &Session{Name: name, Messages: msgs}, nil
+}
+
+// Exists returns true if the session of given name is stored
+func Exists(name string) (bool, error) {
+	path, err := filePath(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Save stores the session, the directory is created if it does not exist
+func (s *Session) Save() error {
+	path, err := filePath(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(s.Messages, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// Markdown returns the conversation as a markdown document
+func (s *Session) Markdown() string {
+	var b strings.Builder
+	for i, msg := range s.Messages {
+		if i > 0 {
+			b.WriteString("\n---\n\n")
+		}
+		fmt.Fprintf(&b, "**%s**\n\n%s\n", msg.Role, strings.TrimRight(msg.Content, "\n"))
+	}
+
+	return b.String()
+}
+
+// List returns summaries of stored sessions sorted by name
+func List() ([]Info, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []Info{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != fileExt {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), fileExt)
+		s, err := Load(name)
+		if err != nil {
+			return nil, err
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, Info{
+			Name:      name,
+			Messages:  len(s.Messages),
+			UpdatedAt: stat.ModTime(),
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// Remove removes the session of given name
+func Remove(name string) error {
+	path, err := filePath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("session not found: %s", name)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// filePath returns the file path of the session of given name
+func filePath(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid session name: '%s'", name)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name+fileExt), nil
+}
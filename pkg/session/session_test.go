@@ -0,0 +1,192 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// stateDir sets XDG_STATE_HOME to a temporary directory, and returns the directory of sessions in it
+func stateDir(t *testing.T) string {
+	t.Helper()
+
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	return filepath.Join(state, "pipegpt", "sessions")
+}
+
+// message makes a message of the role
+func message(role string, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: role, Content: content}
+}
+
+func TestInvalidName(t *testing.T) {
+	dir := stateDir(t)
+
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "../escape"} {
+		t.Run(name, func(t *testing.T) {
+			want := "invalid session name: '" + name + "'"
+			if _, err := Load(name); err == nil || err.Error() != want {
+				t.Errorf("Load() error = %v, want %q", err, want)
+			}
+			if _, err := Exists(name); err == nil || err.Error() != want {
+				t.Errorf("Exists() error = %v, want %q", err, want)
+			}
+			if err := (&Session{Name: name}).Save(); err == nil || err.Error() != want {
+				t.Errorf("Save() error = %v, want %q", err, want)
+			}
+			if err := Remove(name); err == nil || err.Error() != want {
+				t.Errorf("Remove() error = %v, want %q", err, want)
+			}
+		})
+	}
+
+	// nothing is written by invalid names
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("directory of sessions is created: %v", err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := stateDir(t)
+
+	// a new session is empty
+	s, err := Load("work")
+	if err != nil {
+		t.Fatalf("Load() returned error: %s", err)
+	}
+	if s.Name != "work" || len(s.Messages) != 0 {
+		t.Errorf("Load() of a new session = %+v, want empty", s)
+	}
+	if exists, err := Exists("work"); exists || err != nil {
+		t.Errorf("Exists() = %v, %v, want false before saved", exists, err)
+	}
+
+	s.Messages = append(s.Messages, message(openai.ChatMessageRoleSystem, "role"), message(openai.ChatMessageRoleUser, "hello"))
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() returned error: %s", err)
+	}
+	if exists, err := Exists("work"); !exists || err != nil {
+		t.Errorf("Exists() = %v, %v, want true after saved", exists, err)
+	}
+	if stat, err := os.Stat(filepath.Join(dir, "work.json")); err != nil || stat.Mode().Perm() != 0o600 {
+		t.Errorf("session file is not private: %v, %v", stat, err)
+	}
+
+	// appended messages are kept in order
+	s, err = Load("work")
+	if err != nil {
+		t.Fatalf("Load() returned error: %s", err)
+	}
+	s.Messages = append(s.Messages, message(openai.ChatMessageRoleAssistant, "hi"), message(openai.ChatMessageRoleUser, "bye"))
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() returned error: %s", err)
+	}
+
+	s, err = Load("work")
+	want := []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleSystem, "role"),
+		message(openai.ChatMessageRoleUser, "hello"),
+		message(openai.ChatMessageRoleAssistant, "hi"),
+		message(openai.ChatMessageRoleUser, "bye"),
+	}
+	if err != nil || !reflect.DeepEqual(s.Messages, want) {
+		t.Errorf("Load() = %+v, %v, want %+v", s, err, want)
+	}
+}
+
+func TestLoadBroken(t *testing.T) {
+	dir := stateDir(t)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`[{"role":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load("broken"); err == nil {
+		t.Errorf("Load() of broken session returned no error")
+	}
+}
+
+func TestListAndRemove(t *testing.T) {
+	dir := stateDir(t)
+
+	if infos, err := List(); err != nil || len(infos) != 0 {
+		t.Errorf("List() without directory = %+v, %v, want no sessions", infos, err)
+	}
+
+	for name, count := range map[string]int{"work": 3, "blog": 1, "alpha": 0} {
+		s := &Session{Name: name}
+		for i := 0; i < count; i++ {
+			s.Messages = append(s.Messages, message(openai.ChatMessageRoleUser, "hello"))
+		}
+		if err := s.Save(); err != nil {
+			t.Fatalf("Save() returned error: %s", err)
+		}
+	}
+	updated := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(dir, "blog.json"), updated, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	// other files are not sessions
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "old.json"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := List()
+	if err != nil {
+		t.Fatalf("List() returned error: %s", err)
+	}
+	names, counts := []string{}, []int{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+		counts = append(counts, info.Messages)
+	}
+	if want := []string{"alpha", "blog", "work"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+	if want := []int{0, 1, 3}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("messages = %v, want %v", counts, want)
+	}
+	if !infos[1].UpdatedAt.Equal(updated) {
+		t.Errorf("updated at = %s, want %s", infos[1].UpdatedAt, updated)
+	}
+
+	if err := Remove("blog"); err != nil {
+		t.Errorf("Remove() returned error: %s", err)
+	}
+	if exists, _ := Exists("blog"); exists {
+		t.Errorf("session exists after removed")
+	}
+	if err := Remove("blog"); err == nil || err.Error() != "session not found: blog" {
+		t.Errorf("Remove() of missing session error = %v, want session not found", err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	s := &Session{Name: "work", Messages: []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleSystem, "role"),
+		message(openai.ChatMessageRoleUser, "hello\n\n"),
+		message(openai.ChatMessageRoleAssistant, "```go\nfmt.Println()\n```"),
+	}}
+
+	want := "**system**\n\nrole\n" +
+		"\n---\n\n**user**\n\nhello\n" +
+		"\n---\n\n**assistant**\n\n```go\nfmt.Println()\n```\n"
+	if got := s.Markdown(); got != want {
+		t.Errorf("Markdown() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := (&Session{Name: "empty"}).Markdown(); got != "" {
+		t.Errorf("Markdown() of empty session = %q, want empty", got)
+	}
+}
@@ -0,0 +1,184 @@
+package token
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+)
+
+// tables are BPE encoding tables in tiktoken format, compressed with gzip
+//
+//go:embed data/*.tiktoken.gz
+var tables embed.FS
+
+// Encoding names
+const (
+	Cl100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// patterns are regular expressions which split text into pieces before BPE, same as tiktoken
+var patterns = map[string]string{
+	Cl100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s+(?!\S)|\s+`,
+	O200kBase: `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+}
+
+// Encoding is a byte pair encoding compatible with tiktoken
+type Encoding struct {
+	Name string
+
+	pattern *regexp2.Regexp
+	ranks   map[string]int
+	tokens  map[int]string
+}
+
+var (
+	encodings   = map[string]*Encoding{}
+	encodingsMu sync.Mutex
+)
+
+// GetEncoding returns the encoding of given name, encoding table is loaded at first use
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc, nil
+	}
+
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+
+	ranks, err := loadRanks(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(map[int]string, len(ranks))
+	for piece, rank := range ranks {
+		tokens[rank] = piece
+	}
+
+	enc := &Encoding{
+		Name:    name,
+		pattern: regexp2.MustCompile(pattern, regexp2.None),
+		ranks:   ranks,
+		tokens:  tokens,
+	}
+	encodings[name] = enc
+	return enc, nil
+}
+
+// loadRanks loads embedded encoding table, each line consists of base64 encoded token and its rank
+func loadRanks(name string) (map[string]int, error) {
+	raw, err := tables.ReadFile(fmt.Sprintf("data/%s.tiktoken.gz", name))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := bytes.Fields(scanner.Bytes())
+		const fieldCount = 2
+		if len(fields) != fieldCount {
+			continue
+		}
+
+		piece, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding table %s: %w", name, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid encoding table %s: %w", name, err)
+		}
+
+		ranks[string(piece)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ranks, nil
+}
+
+// Encode encodes text into tokens
+func (e *Encoding) Encode(text string) []int {
+	tokens := []int{}
+
+	m, _ := e.pattern.FindStringMatch(text)
+	for m != nil {
+		tokens = append(tokens, e.encodePiece(m.String())...)
+		m, _ = e.pattern.FindNextMatch(m)
+	}
+
+	return tokens
+}
+
+// Count returns the number of tokens of text
+func (e *Encoding) Count(text string) int {
+	return len(e.Encode(text))
+}
+
+// Decode decodes tokens into text, unknown tokens are ignored
+func (e *Encoding) Decode(tokens []int) string {
+	var b bytes.Buffer
+	for _, t := range tokens {
+		b.WriteString(e.tokens[t])
+	}
+
+	return b.String()
+}
+
+// encodePiece encodes a piece of text by merging the pair of lowest rank repeatedly
+func (e *Encoding) encodePiece(piece string) []int {
+	if rank, ok := e.ranks[piece]; ok {
+		return []int{rank}
+	}
+
+	// boundaries of parts, each part is a byte at first
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+
+	tokens := make([]int, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		tokens = append(tokens, e.ranks[piece[bounds[i]:bounds[i+1]]])
+	}
+
+	return tokens
+}
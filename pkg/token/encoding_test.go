@@ -0,0 +1,109 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+)
+
+// golden tokens are encoded by tiktoken
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text string
+		want map[string][]int
+	}{
+		{
+			text: "hello world",
+			want: map[string][]int{
+				Cl100kBase: {15339, 1917},
+				O200kBase:  {24912, 2375},
+			},
+		},
+		{
+			text: "tiktoken is great!",
+			want: map[string][]int{
+				Cl100kBase: {83, 1609, 5963, 374, 2294, 0},
+				O200kBase:  {83, 8251, 2488, 382, 2212, 0},
+			},
+		},
+		{
+			text: "antidisestablishmentarianism",
+			want: map[string][]int{
+				Cl100kBase: {519, 85342, 34500, 479, 8997, 2191},
+				O200kBase:  {493, 129901, 376, 160388, 21203, 2367},
+			},
+		},
+		{
+			text: "2 + 2 = 4",
+			want: map[string][]int{
+				Cl100kBase: {17, 489, 220, 17, 284, 220, 19},
+				O200kBase:  {17, 659, 220, 17, 314, 220, 19},
+			},
+		},
+		{
+			text: "お誕生日おめでとう",
+			want: map[string][]int{
+				Cl100kBase: {33334, 45918, 243, 21990, 9080, 33334, 62004, 16556, 78699},
+				O200kBase:  {8930, 9697, 243, 128225, 8930, 17693, 4344, 48669},
+			},
+		},
+	}
+
+	for _, name := range []string{Cl100kBase, O200kBase} {
+		enc, err := GetEncoding(name)
+		if err != nil {
+			t.Fatalf("GetEncoding(%s) returned error: %s", name, err)
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.text, func(t *testing.T) {
+				want := tt.want[name]
+				if got := enc.Encode(tt.text); !reflect.DeepEqual(got, want) {
+					t.Errorf("Encode() = %v, want %v", got, want)
+				}
+				if got := enc.Count(tt.text); got != len(want) {
+					t.Errorf("Count() = %d, want %d", got, len(want))
+				}
+				if got := enc.Decode(want); got != tt.text {
+					t.Errorf("Decode() = %q, want %q", got, tt.text)
+				}
+			})
+		}
+	}
+}
+
+func TestGetEncoding(t *testing.T) {
+	if _, err := GetEncoding("p50k_base"); err == nil {
+		t.Errorf("GetEncoding() of unknown encoding returned no error")
+	}
+
+	first, _ := GetEncoding(O200kBase)
+	second, _ := GetEncoding(O200kBase)
+	if first != second {
+		t.Errorf("GetEncoding() loaded the encoding twice")
+	}
+}
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", O200kBase},
+		{"gpt-4o-mini-2024-07-18", O200kBase},
+		{"gpt-4", Cl100kBase},
+		{"gpt-3.5-turbo", Cl100kBase},
+		{"llama3", Cl100kBase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			enc, err := ForModel(tt.model)
+			if err != nil {
+				t.Fatalf("ForModel() returned error: %s", err)
+			}
+			if enc.Name != tt.want {
+				t.Errorf("ForModel(%q) = %s, want %s", tt.model, enc.Name, tt.want)
+			}
+		})
+	}
+}
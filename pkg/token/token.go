@@ -0,0 +1,131 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Overflow strategies which decide what to do when input exceeds token budget
+const (
+	OverflowError          = "error"
+	OverflowTruncateHead   = "truncate-head"
+	OverflowTruncateTail   = "truncate-tail"
+	OverflowTruncateMiddle = "truncate-middle"
+	OverflowChunk          = "chunk"
+)
+
+// Overflows is list of supported overflow strategies
+var Overflows = []string{
+	OverflowError, OverflowTruncateHead, OverflowTruncateTail, OverflowTruncateMiddle, OverflowChunk,
+}
+
+// perMessage is the number of tokens which wraps each chat message
+const perMessage = 3
+
+// model is an entry of the model table, looked up by longest prefix
+type model struct {
+	prefix   string
+	encoding string
+	context  int
+}
+
+// models is table of known models, context is the size of context window in tokens
+var models = []model{
+	{"gpt-5", O200kBase, 400000},
+	{"gpt-4.1", O200kBase, 1047576},
+	{"gpt-4o", O200kBase, 128000},
+	{"gpt-4-turbo", Cl100kBase, 128000},
+	{"gpt-4-1106", Cl100kBase, 128000},
+	{"gpt-4-0125", Cl100kBase, 128000},
+	{"gpt-4-32k", Cl100kBase, 32768},
+	{"gpt-4", Cl100kBase, 8192},
+	{"gpt-3.5-turbo", Cl100kBase, 16385},
+	{"o1", O200kBase, 200000},
+	{"o3", O200kBase, 200000},
+	{"o4", O200kBase, 200000},
+	{"claude", Cl100kBase, 200000},
+}
+
+// lookup returns the model entry of longest matching prefix
+func lookup(name string) (model, bool) {
+	var found model
+	ok := false
+	for _, m := range models {
+		if strings.HasPrefix(name, m.prefix) && len(m.prefix) > len(found.prefix) {
+			found, ok = m, true
+		}
+	}
+
+	return found, ok
+}
+
+// ContextWindow returns the size of context window of model, 0 means unknown
+func ContextWindow(name string) int {
+	m, _ := lookup(name)
+	return m.context
+}
+
+// ForModel returns the encoding used by model, cl100k_base is used for unknown models as approximation
+func ForModel(name string) (*Encoding, error) {
+	m, ok := lookup(name)
+	if !ok {
+		return GetEncoding(Cl100kBase)
+	}
+
+	return GetEncoding(m.encoding)
+}
+
+// Count returns the number of tokens of text for model
+func Count(name string, text string) (int, error) {
+	enc, err := ForModel(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return enc.Count(text), nil
+}
+
+// CountMessages returns the number of prompt tokens of chat messages for model
+func CountMessages(name string, messages ...string) (int, error) {
+	enc, err := ForModel(name)
+	if err != nil {
+		return 0, err
+	}
+
+	count := perMessage
+	for _, msg := range messages {
+		count += perMessage + enc.Count(msg)
+	}
+
+	return count, nil
+}
+
+// Truncate shortens text to at most limit tokens of model by given strategy,
+// truncate-head drops the beginning, truncate-tail drops the end, truncate-middle drops the middle
+func Truncate(name string, text string, limit int, strategy string) (string, error) {
+	enc, err := ForModel(name)
+	if err != nil {
+		return "", err
+	}
+
+	tokens := enc.Encode(text)
+	if len(tokens) <= limit {
+		return text, nil
+	}
+	if limit <= 0 {
+		return "", nil
+	}
+
+	switch strategy {
+	case OverflowTruncateHead:
+		return enc.Decode(tokens[len(tokens)-limit:]), nil
+	case OverflowTruncateTail:
+		return enc.Decode(tokens[:limit]), nil
+	case OverflowTruncateMiddle:
+		head := limit / 2
+		tail := limit - head
+		return enc.Decode(tokens[:head]) + enc.Decode(tokens[len(tokens)-tail:]), nil
+	default:
+		return "", fmt.Errorf("unknown truncate strategy: %s", strategy)
+	}
+}
@@ -0,0 +1,59 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File reads a file within Dir, Path is the template of file path relative to Dir
+type File struct {
+	Dir  string
+	Path string
+}
+
+// Prepare renders the path with arguments, the file must be within the directory after symbolic links are resolved
+func (f *File) Prepare(args map[string]interface{}) (*Action, error) {
+	path, err := render("path", f.Path, args)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := filepath.Abs(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return nil, err
+	}
+
+	// absolute path is also taken as relative to the directory
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, path))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is out of allowed directory %s", path, f.Dir)
+	}
+
+	return &Action{
+		Description: "read file: " + resolved,
+		run: func(ctx context.Context) (string, error) {
+			file, err := os.Open(resolved)
+			if err != nil {
+				return "", err
+			}
+			defer file.Close()
+
+			// size of file is unknown if it is not a regular file
+			size := int64(-1)
+			if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+				size = info.Size()
+			}
+
+			return readOutput(file, size)
+		},
+	}, nil
+}
@@ -0,0 +1,93 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFilePrepare(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "allowed")
+	for path, content := range map[string]string{
+		"allowed/a.txt":     "a",
+		"allowed/sub/b.txt": "b",
+		"secret.txt":        "secret",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.txt"), filepath.Join(dir, "escape.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(dir, "parent")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "sub", "b.txt"), filepath.Join(dir, "inside.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		output string
+		err    string
+	}{
+		{path: "a.txt", output: "a"},
+		{path: "sub/b.txt", output: "b"},
+		{path: "sub/../a.txt", output: "a"},
+		{path: "/a.txt", output: "a"},
+		{path: "inside.txt", output: "b"},
+		{path: "../secret.txt", err: "../secret.txt is out of allowed directory"},
+		{path: "sub/../../secret.txt", err: "sub/../../secret.txt is out of allowed directory"},
+		{path: "..", err: ".. is out of allowed directory"},
+		{path: "escape.txt", err: "escape.txt is out of allowed directory"},
+		{path: "parent/secret.txt", err: "parent/secret.txt is out of allowed directory"},
+		{path: "missing.txt", err: "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			action, err := (&File{Dir: dir, Path: "{{.path}}"}).Prepare(map[string]interface{}{"path": tt.path})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Prepare() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Prepare() returned error: %s", err)
+			}
+
+			output, err := action.Run()
+			if err != nil || output != tt.output {
+				t.Errorf("Run() = %q, %v, want %q", output, err, tt.output)
+			}
+		})
+	}
+}
+
+func TestFileTruncated(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "big.txt"), []byte(strings.Repeat("a", 100000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := (&File{Dir: dir, Path: "big.txt"}).Prepare(nil)
+	if err != nil {
+		t.Fatalf("Prepare() returned error: %s", err)
+	}
+
+	output, err := action.Run()
+	if err != nil {
+		t.Fatalf("Run() returned error: %s", err)
+	}
+	if want := strings.Repeat("a", maxOutputSize) + "\n... (truncated, 100000 bytes in total)"; output != want {
+		t.Errorf("Run() = %d bytes ending with %q, want %d bytes", len(output), output[maxOutputSize:], len(want))
+	}
+}
@@ -0,0 +1,108 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// localHosts are hosts which HTTP tool is allowed to request
+var localHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// HTTP requests a server on localhost, URL and Body are templates of the request
+type HTTP struct {
+	// Method is HTTP method, default is GET
+	Method  string
+	URL     string
+	Body    string
+	Headers map[string]string
+}
+
+// Prepare renders the URL and the body with arguments, the URL must be on localhost
+func (h *HTTP) Prepare(args map[string]interface{}) (*Action, error) {
+	rawURL, err := render("url", h.URL, args)
+	if err != nil {
+		return nil, err
+	}
+	body, err := render("body", h.Body, args)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := localURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	description := fmt.Sprintf("request %s %s", method, u)
+	if body != "" {
+		description += "\n" + body
+	}
+
+	return &Action{
+		Description: description,
+		run: func(ctx context.Context) (string, error) {
+			return h.do(ctx, method, u, body)
+		},
+	}, nil
+}
+
+// do sends the request, and returns the status and the body of response
+func (h *HTTP) do(ctx context.Context, method string, u *url.URL, body string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// redirect to other hosts is not followed
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			_, err := localURL(req.URL.String())
+			return err
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// content length is -1 if it is unknown
+	output, err := readOutput(resp.Body, resp.ContentLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s\n%s", resp.Status, output), nil
+}
+
+// localURL parses the URL, and checks that it is a HTTP URL on localhost
+func localURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("only http and https are allowed: %s", rawURL)
+	}
+	for _, host := range localHosts {
+		if u.Hostname() == host {
+			return u, nil
+		}
+	}
+
+	return nil, errors.New("only localhost is allowed: " + rawURL)
+}
@@ -0,0 +1,104 @@
+package tool
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPPrepare(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{url: "http://localhost:8080/health"},
+		{url: "http://127.0.0.1/health"},
+		{url: "https://[::1]:8443/health"},
+		{url: "http://example.com/health", err: "only localhost is allowed"},
+		{url: "http://localhost.example.com/", err: "only localhost is allowed"},
+		{url: "file:///etc/hostname", err: "only http and https are allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := (&HTTP{URL: "{{.url}}"}).Prepare(map[string]interface{}{"url": tt.url})
+			if tt.err == "" && err != nil {
+				t.Errorf("Prepare() returned error: %s", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Prepare() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestHTTPRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, r.Method+" "+r.Header.Get("X-Token")+" "+string(body))
+		case "/local":
+			http.Redirect(w, r, "/echo", http.StatusFound)
+		case "/remote":
+			http.Redirect(w, r, "http://example.com/", http.StatusFound)
+		case "/big":
+			// content length is unknown for chunked response
+			for i := 0; i < 100; i++ {
+				_, _ = io.WriteString(w, strings.Repeat("a", 1000))
+				w.(http.Flusher).Flush()
+			}
+		case "/sized":
+			w.Header().Set("Content-Length", "100000")
+			_, _ = io.WriteString(w, strings.Repeat("a", 100000))
+		}
+	}))
+	defer server.Close()
+
+	// httptest serves on 127.0.0.1
+	run := func(h *HTTP) (string, error) {
+		action, err := h.Prepare(map[string]interface{}{"base": server.URL, "msg": "hello"})
+		if err != nil {
+			t.Fatalf("Prepare() returned error: %s", err)
+		}
+		return action.Run()
+	}
+
+	t.Run("request", func(t *testing.T) {
+		output, err := run(&HTTP{Method: "post", URL: "{{.base}}/echo", Body: `{"msg":"{{.msg}}"}`, Headers: map[string]string{"X-Token": "t"}})
+		if want := "200 OK\nPOST t {\"msg\":\"hello\"}"; err != nil || output != want {
+			t.Errorf("Run() = %q, %v, want %q", output, err, want)
+		}
+	})
+
+	t.Run("redirect to localhost", func(t *testing.T) {
+		output, err := run(&HTTP{URL: "{{.base}}/local"})
+		if want := "200 OK\nGET  "; err != nil || output != want {
+			t.Errorf("Run() = %q, %v, want %q", output, err, want)
+		}
+	})
+
+	t.Run("redirect to other host", func(t *testing.T) {
+		_, err := run(&HTTP{URL: "{{.base}}/remote"})
+		if err == nil || !strings.Contains(err.Error(), "only localhost is allowed: http://example.com/") {
+			t.Errorf("Run() error = %v, want redirect is not followed", err)
+		}
+	})
+
+	t.Run("truncated of known size", func(t *testing.T) {
+		output, err := run(&HTTP{URL: "{{.base}}/sized"})
+		if want := "200 OK\n" + strings.Repeat("a", maxOutputSize) + "\n... (truncated, 100000 bytes in total)"; err != nil || output != want {
+			t.Errorf("Run() = %d bytes, %v, want %d bytes", len(output), err, len(want))
+		}
+	})
+
+	t.Run("truncated of unknown size", func(t *testing.T) {
+		output, err := run(&HTTP{URL: "{{.base}}/big"})
+		if want := "200 OK\n" + strings.Repeat("a", maxOutputSize) + "\n... (truncated, more than 65536 bytes in total)"; err != nil || output != want {
+			t.Errorf("Run() = %d bytes, %v, want %d bytes", len(output), err, len(want))
+		}
+	})
+}
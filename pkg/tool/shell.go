@@ -0,0 +1,67 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/HatsuneMiku3939/pipegpt/pkg/runner"
+)
+
+// Shell runs a shell command, Command is the template of it.
+// string arguments are quoted as a single word of shell wherever they are written, such as {{.path}},
+// raw function writes the argument without quoting, such as {{raw .pattern}}, it must be used only if it is safe.
+type Shell struct {
+	Command string
+}
+
+// Prepare renders the command with arguments, string arguments are quoted
+func (s *Shell) Prepare(args map[string]interface{}) (*Action, error) {
+	quoted, _ := shellArgs(args).(map[string]interface{})
+	command, err := render("shell", s.Command, quoted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Action{
+		Description: "run shell command: " + command,
+		run: func(ctx context.Context) (string, error) {
+			var output bytes.Buffer
+			cmd := runner.Command(ctx, command)
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+
+			err := cmd.Run()
+			return truncate(output.String(), int64(output.Len())), err
+		},
+	}, nil
+}
+
+// shellString is a string argument of shell template, it is written as a quoted word
+type shellString string
+
+// String returns the quoted string, it is called when the argument is written by template
+func (s shellString) String() string {
+	return quoteString(string(s))
+}
+
+// shellArgs converts strings in arguments into shellString, recursively in objects and arrays
+func shellArgs(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return shellString(v)
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			converted[key] = shellArgs(value)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, value := range v {
+			converted[i] = shellArgs(value)
+		}
+		return converted
+	default:
+		return v
+	}
+}
@@ -0,0 +1,119 @@
+package tool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellPrepare(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "string is quoted",
+			command: "grep -n {{.pattern}} log.txt",
+			args:    map[string]interface{}{"pattern": "a; echo injected"},
+			want:    "grep -n 'a; echo injected' log.txt",
+		},
+		{
+			name:    "single quote is escaped",
+			command: "echo {{.msg}}",
+			args:    map[string]interface{}{"msg": "it's $(echo x)"},
+			want:    `echo 'it'\''s $(echo x)'`,
+		},
+		{
+			name:    "quote does not quote twice",
+			command: "echo {{quote .msg}}",
+			args:    map[string]interface{}{"msg": "a b"},
+			want:    "echo 'a b'",
+		},
+		{
+			name:    "raw opts out of quoting",
+			command: "echo {{raw .flags}} {{.msg}}",
+			args:    map[string]interface{}{"flags": "-n -e", "msg": "a b"},
+			want:    "echo -n -e 'a b'",
+		},
+		{
+			name:    "number and bool are not quoted",
+			command: "head -n {{.lines}} {{.follow}}",
+			args:    map[string]interface{}{"lines": float64(5), "follow": true},
+			want:    "head -n 5 true",
+		},
+		{
+			name:    "strings in array and object are quoted",
+			command: "ls {{range .files}}{{.}} {{end}}{{.opts.dir}}",
+			args: map[string]interface{}{
+				"files": []interface{}{"a b", "c"},
+				"opts":  map[string]interface{}{"dir": "d e"},
+			},
+			want: "ls 'a b' 'c' 'd e'",
+		},
+		{
+			name:    "condition and comparison use the value",
+			command: `ls{{if .all}} -a{{end}}{{if eq .sort "time"}} -t{{end}}`,
+			args:    map[string]interface{}{"all": "", "sort": "time"},
+			want:    "ls -t",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := (&Shell{Command: tt.command}).Prepare(tt.args)
+			if err != nil {
+				t.Fatalf("Prepare() returned error: %s", err)
+			}
+			if want := "run shell command: " + tt.want; action.Description != want {
+				t.Errorf("Description = %q, want %q", action.Description, want)
+			}
+		})
+	}
+
+	t.Run("missing argument", func(t *testing.T) {
+		if _, err := (&Shell{Command: "echo {{.msg}}"}).Prepare(map[string]interface{}{}); err == nil {
+			t.Errorf("Prepare() returned no error of missing argument")
+		}
+	})
+}
+
+func TestShellRun(t *testing.T) {
+	msg := "a; echo injected `echo x` $(echo y) 'z'"
+	action, err := (&Shell{Command: "printf %s {{.msg}}"}).Prepare(map[string]interface{}{"msg": msg})
+	if err != nil {
+		t.Fatalf("Prepare() returned error: %s", err)
+	}
+
+	output, err := action.Run()
+	if err != nil || output != msg {
+		t.Errorf("Run() = %q, %v, want %q", output, err, msg)
+	}
+
+	t.Run("exit status", func(t *testing.T) {
+		action, err := (&Shell{Command: "echo out; echo err >&2; exit 3"}).Prepare(nil)
+		if err != nil {
+			t.Fatalf("Prepare() returned error: %s", err)
+		}
+
+		output, err := action.Run()
+		if err == nil || output != "out\nerr\n" {
+			t.Errorf("Run() = %q, %v, want output and exit status", output, err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		action, err := (&Shell{Command: "head -c 70000 /dev/zero | tr '\\0' a"}).Prepare(nil)
+		if err != nil {
+			t.Fatalf("Prepare() returned error: %s", err)
+		}
+
+		output, err := action.Run()
+		if err != nil {
+			t.Fatalf("Run() returned error: %s", err)
+		}
+		if want := strings.Repeat("a", maxOutputSize) + "\n... (truncated, 70000 bytes in total)"; output != want {
+			t.Errorf("Run() = %d bytes ending with %q, want %d bytes", len(output), output[maxOutputSize:], len(want))
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// timeout is the maximum time of an execution of tool
+const timeout = time.Minute
+
+// maxOutputSize is the maximum size of output of tool, the rest is truncated to save tokens
+const maxOutputSize = 64 * 1024
+
+// Executor executes a tool with arguments of the call
+type Executor interface {
+	// Prepare renders templates of the executor with arguments, and returns the action to execute
+	Prepare(args map[string]interface{}) (*Action, error)
+}
+
+// Action is a prepared execution of tool, it is described before it is executed for confirmation
+type Action struct {
+	// Description is what the action does, such as the command to run
+	Description string
+
+	run func(ctx context.Context) (string, error)
+}
+
+// Run executes the action, and returns its output which is truncated to maxOutputSize.
+// output is returned along with the error if the action fails after it starts, such as exit status of command.
+func (a *Action) Run() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return a.run(ctx)
+}
+
+// render renders the template text with arguments, name is used in error messages
+func render(name string, text string, args map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, args); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// funcs are helper functions available in templates
+var funcs = template.FuncMap{
+	"quote": quote,
+	"raw":   raw,
+}
+
+// quote quotes the value as a single word of shell, so that arguments are never interpreted by shell.
+// argument of shell template is already quoted, so that it is not quoted twice.
+func quote(v interface{}) string {
+	if s, ok := v.(shellString); ok {
+		return s.String()
+	}
+
+	return quoteString(fmt.Sprint(v))
+}
+
+// raw returns the value without quoting, it opts out of quoting of arguments of shell template
+func raw(v interface{}) string {
+	if s, ok := v.(shellString); ok {
+		return string(s)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// quoteString quotes the string as a single word of shell
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// readOutput reads the output up to maxOutputSize, size is the size of whole output, negative if it is unknown
+func readOutput(r io.Reader, size int64) (string, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, maxOutputSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	return truncate(string(raw), size), nil
+}
+
+// truncate truncates the output to maxOutputSize, size is the size of whole output.
+// size which is less than the output means that it is unknown.
+func truncate(output string, size int64) string {
+	if len(output) <= maxOutputSize {
+		return output
+	}
+	if size < int64(len(output)) {
+		return fmt.Sprintf("%s\n... (truncated, more than %d bytes in total)", output[:maxOutputSize], maxOutputSize)
+	}
+
+	return fmt.Sprintf("%s\n... (truncated, %d bytes in total)", output[:maxOutputSize], size)
+}
@@ -0,0 +1,291 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Report groups of summaries
+const (
+	// BySubcommand groups calls by the subcommand which made them
+	BySubcommand = "subcommand"
+	// ByModel groups calls by the model which answered them
+	ByModel = "model"
+	// ByProvider groups calls by API provider
+	ByProvider = "provider"
+	// ByDay groups calls by the local date when they are made
+	ByDay = "day"
+)
+
+// Groups are available groups of summaries
+var Groups = []string{BySubcommand, ByModel, ByProvider, ByDay}
+
+// rootSubcommand is the name of root command in summaries
+const rootSubcommand = "(root)"
+
+// Price is the price of tokens of a model in USD per 1M tokens
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// Cost returns the cost of tokens in USD
+func (p Price) Cost(promptTokens int, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Prompt + float64(completionTokens)*p.Completion) / 1_000_000
+}
+
+// Prices are prices by model name or prefix of model name
+type Prices map[string]Price
+
+// DefaultPrices are list prices of well-known models, they are estimates and can be overridden by config file
+var DefaultPrices = Prices{
+	"gpt-4o":            {Prompt: 2.5, Completion: 10},
+	"gpt-4o-mini":       {Prompt: 0.15, Completion: 0.6},
+	"gpt-4.1":           {Prompt: 2, Completion: 8},
+	"gpt-4.1-mini":      {Prompt: 0.4, Completion: 1.6},
+	"gpt-4.1-nano":      {Prompt: 0.1, Completion: 0.4},
+	"gpt-4-turbo":       {Prompt: 10, Completion: 30},
+	"gpt-4":             {Prompt: 30, Completion: 60},
+	"gpt-4-32k":         {Prompt: 60, Completion: 120},
+	"gpt-3.5-turbo":     {Prompt: 0.5, Completion: 1.5},
+	"o1":                {Prompt: 15, Completion: 60},
+	"o1-mini":           {Prompt: 1.1, Completion: 4.4},
+	"o3-mini":           {Prompt: 1.1, Completion: 4.4},
+	"claude-3-5-sonnet": {Prompt: 3, Completion: 15},
+	"claude-3-5-haiku":  {Prompt: 0.8, Completion: 4},
+	"claude-3-7-sonnet": {Prompt: 3, Completion: 15},
+	"claude-3-opus":     {Prompt: 15, Completion: 75},
+	"claude-3-haiku":    {Prompt: 0.25, Completion: 1.25},
+}
+
+// Merge returns prices which have prices of other in addition to p, prices of other take precedence
+func (p Prices) Merge(other Prices) Prices {
+	merged := Prices{}
+	for model, price := range p {
+		merged[model] = price
+	}
+	for model, price := range other {
+		merged[model] = price
+	}
+
+	return merged
+}
+
+// Lookup returns the price of the model.
+// the price of the exact name is preferred, otherwise the longest name which the model starts with is taken,
+// so that versioned models such as gpt-4o-2024-08-06 are priced as gpt-4o.
+func (p Prices) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	found, ok := "", false
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(found) {
+			found, ok = name, true
+		}
+	}
+
+	return p[found], ok
+}
+
+// Cost returns the cost of tokens of the model in USD, nil if the price of the model is unknown
+func (p Prices) Cost(model string, promptTokens int, completionTokens int) *float64 {
+	price, ok := p.Lookup(model)
+	if !ok {
+		return nil
+	}
+
+	cost := price.Cost(promptTokens, completionTokens)
+	return &cost
+}
+
+// Entry is usage of a request sent to the model, recorded in the ledger
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Subcommand is the name of subcommand which sent the request, empty means root command
+	Subcommand       string `json:"subcommand"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	// Cost is estimated cost in USD, nil if the price of the model is unknown
+	Cost *float64 `json:"cost,omitempty"`
+}
+
+// LedgerPath returns the path of the ledger file.
+// it is $XDG_STATE_HOME/pipegpt/usage.jsonl, or $HOME/.local/state/pipegpt/usage.jsonl if XDG_STATE_HOME is not set.
+func LedgerPath() (string, error) {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(state, "pipegpt", "usage.jsonl"), nil
+}
+
+// Append appends the entry to the ledger file in a line of JSON, the file is created if it doesn't exist
+func Append(path string, entry *Entry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	// a line is written at once, so that lines of concurrent processes are not mixed
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Read reads entries of the ledger file made at or after since, no entries are returned if the file doesn't exist.
+// broken lines, such as a line cut by a crash, are skipped.
+func Read(path string, since time.Time) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []*Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ParseSince parses the start of the report relative to now.
+// it is a number of days such as 7d, a duration such as 12h, or a date such as 2006-01-02 in local time.
+func ParseSince(since string, now time.Time) (time.Time, error) {
+	if days := strings.TrimSuffix(since, "d"); days != since {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days: %s", since)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("duration must not be negative: %s", since)
+		}
+		return now.Add(-d), nil
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", since, now.Location()); err == nil {
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("must be days such as 7d, a duration such as 12h or a date such as 2006-01-02: %s", since)
+}
+
+// Summary is the sum of usage of calls in a group
+type Summary struct {
+	// Key is the subcommand, model, provider or date which the calls are grouped by
+	Key              string
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	// Cost is the sum of estimated cost of calls whose price is known
+	Cost float64
+	// Unpriced is the number of calls whose price is unknown, they are not included in Cost
+	Unpriced int
+}
+
+// Add adds usage of the entry to the summary
+func (s *Summary) Add(entry *Entry) {
+	s.Calls++
+	s.PromptTokens += entry.PromptTokens
+	s.CompletionTokens += entry.CompletionTokens
+	s.TotalTokens += entry.TotalTokens
+	if entry.Cost == nil {
+		s.Unpriced++
+		return
+	}
+	s.Cost += *entry.Cost
+}
+
+// Summarize sums up usage of entries by the group, and returns summaries sorted by key
+func Summarize(entries []*Entry, by string) ([]*Summary, error) {
+	var key func(entry *Entry) string
+	switch by {
+	case BySubcommand:
+		key = func(entry *Entry) string {
+			if entry.Subcommand == "" {
+				return rootSubcommand
+			}
+			return entry.Subcommand
+		}
+	case ByModel:
+		key = func(entry *Entry) string { return entry.Model }
+	case ByProvider:
+		key = func(entry *Entry) string { return entry.Provider }
+	case ByDay:
+		key = func(entry *Entry) string { return entry.Time.Local().Format("2006-01-02") }
+	default:
+		return nil, fmt.Errorf("must be one of %s: %s", strings.Join(Groups, ", "), by)
+	}
+
+	groups := map[string]*Summary{}
+	for _, entry := range entries {
+		k := key(entry)
+		if _, ok := groups[k]; !ok {
+			groups[k] = &Summary{Key: k}
+		}
+		groups[k].Add(entry)
+	}
+
+	summaries := make([]*Summary, 0, len(groups))
+	for _, s := range groups {
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Key < summaries[j].Key
+	})
+
+	return summaries, nil
+}
@@ -0,0 +1,178 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPricesLookup(t *testing.T) {
+	prices := Prices{
+		"gpt-4":       {Prompt: 30, Completion: 60},
+		"gpt-4o":      {Prompt: 2.5, Completion: 10},
+		"gpt-4o-mini": {Prompt: 0.15, Completion: 0.6},
+	}
+
+	tests := []struct {
+		model string
+		price Price
+		ok    bool
+	}{
+		{"gpt-4", Price{Prompt: 30, Completion: 60}, true},
+		{"gpt-4-0613", Price{Prompt: 30, Completion: 60}, true},
+		{"gpt-4o-2024-08-06", Price{Prompt: 2.5, Completion: 10}, true},
+		{"gpt-4o-mini-2024-07-18", Price{Prompt: 0.15, Completion: 0.6}, true},
+		{"llama3", Price{}, false},
+		{"", Price{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, ok := prices.Lookup(tt.model)
+			if price != tt.price || ok != tt.ok {
+				t.Errorf("Lookup(%q) = %v, %v, want %v, %v", tt.model, price, ok, tt.price, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPricesCost(t *testing.T) {
+	prices := DefaultPrices.Merge(Prices{"gpt-4": {Prompt: 1, Completion: 2}, "llama3": {}})
+
+	if cost := prices.Cost("gpt-4", 1_000_000, 500_000); cost == nil || *cost != 2 {
+		t.Errorf("Cost() of overridden price = %v, want 2", cost)
+	}
+	if cost := prices.Cost("llama3", 100, 100); cost == nil || *cost != 0 {
+		t.Errorf("Cost() of free model = %v, want 0", cost)
+	}
+	if cost := prices.Cost("unknown", 100, 100); cost != nil {
+		t.Errorf("Cost() of unknown model = %v, want nil", *cost)
+	}
+	if DefaultPrices["gpt-4"] == prices["gpt-4"] {
+		t.Errorf("Merge() modified default prices")
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		since string
+		want  time.Time
+		err   bool
+	}{
+		{"7d", time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC), false},
+		{"0d", now, false},
+		{"12h", time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC), false},
+		{"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"-1d", time.Time{}, true},
+		{"-1h", time.Time{}, true},
+		{"xd", time.Time{}, true},
+		{"week", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			got, err := ParseSince(tt.since, now)
+			if tt.err {
+				if err == nil {
+					t.Errorf("ParseSince(%q) = %v, want error", tt.since, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSince(%q) returned error: %s", tt.since, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseSince(%q) = %v, want %v", tt.since, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	cost := func(v float64) *float64 { return &v }
+	at := time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local)
+	entries := []*Entry{
+		{Time: at, Subcommand: "review", Provider: "openai", Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, Cost: cost(0.5)},
+		{Time: at, Subcommand: "review", Provider: "openai", Model: "gpt-4o", PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30, Cost: cost(1)},
+		{Time: at.AddDate(0, 0, 1), Subcommand: "", Provider: "ollama", Model: "llama3", PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+	}
+
+	tests := []struct {
+		by   string
+		want []*Summary
+	}{
+		{BySubcommand, []*Summary{
+			{Key: "(root)", Calls: 1, PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7, Unpriced: 1},
+			{Key: "review", Calls: 2, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45, Cost: 1.5},
+		}},
+		{ByModel, []*Summary{
+			{Key: "gpt-4o", Calls: 2, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45, Cost: 1.5},
+			{Key: "llama3", Calls: 1, PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7, Unpriced: 1},
+		}},
+		{ByDay, []*Summary{
+			{Key: "2024-06-10", Calls: 2, PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45, Cost: 1.5},
+			{Key: "2024-06-11", Calls: 1, PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7, Unpriced: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			got, err := Summarize(entries, tt.by)
+			if err != nil {
+				t.Fatalf("Summarize() returned error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Summarize(entries, "week"); err == nil {
+		t.Errorf("Summarize() by unknown group returned no error")
+	}
+}
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipegpt", "usage.jsonl")
+
+	entries, err := Read(path, time.Time{})
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Read() of missing ledger = %v, %v, want no entries", entries, err)
+	}
+
+	cost := 0.25
+	old := &Entry{Time: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Model: "gpt-4o", TotalTokens: 1}
+	recent := &Entry{Time: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC), Subcommand: "review", Model: "gpt-4o", TotalTokens: 2, Cost: &cost}
+	for _, entry := range []*Entry{old, recent} {
+		if err := Append(path, entry); err != nil {
+			t.Fatalf("Append() returned error: %s", err)
+		}
+	}
+
+	// a broken line is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2024-06-`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	entries, err = Read(path, time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Read() returned error: %s", err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0], recent) {
+		t.Errorf("Read() = %+v, want [%+v]", entries, recent)
+	}
+
+	entries, err = Read(path, time.Time{})
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Read() of all = %d entries, %v, want 2", len(entries), err)
+	}
+}